@@ -0,0 +1,526 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hlin91/CS4350_Lab4/output"
+	"github.com/hlin91/CS4350_Lab4/server"
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+// Exit codes reported by the command line interface
+const (
+	exitOK       = 0
+	exitError    = 1 // any error not covered below
+	exitUsage    = 2 // unknown command, bad flags or missing arguments
+	exitNotFound = 3 // the addressed row does not exist
+	exitInvalid  = 4 // malformed input such as a bad date
+	exitConflict = 5 // a double-booking or a duplicate or dangling key
+)
+
+// cliParam is a value flag of a command. Values are passed to the REPL
+// command in the order the params are declared.
+type cliParam struct {
+	name     string
+	usage    string
+	optional bool
+	def      string // passed for an unset optional param when a later one is set
+}
+
+// cliCommand maps a command line subcommand onto a REPL command
+type cliCommand struct {
+	path     []string // words naming the subcommand, e.g. add bus
+	repl     []string // REPL command and leading arguments
+	summary  string
+	params   []cliParam
+	switches []string // boolean flags passed through to the REPL command
+	rows     bool     // takes the output flags
+}
+
+func required(name, usage string) cliParam {
+	return cliParam{name: name, usage: usage}
+}
+
+func optional(name, usage, def string) cliParam {
+	return cliParam{name: name, usage: usage, optional: true, def: def}
+}
+
+const forceSwitch = "force"
+
+// dataTables are the tables that can be exported and imported as CSV
+var dataTables = []string{"trip", "offering", "bus", "driver", "stop", "actualinfo", "stopinfo"}
+
+// cliCommands lists every subcommand except interactive and serve, which
+// do not map onto a single REPL command
+var cliCommands = func() []cliCommand {
+	commands := []cliCommand{
+		{path: []string{"schedule"}, repl: []string{"get", "schedule"}, summary: "Show the offerings of every trip between two locations on a date",
+			params: []cliParam{required("from", "start location name"), required("to", "destination name"), required("date", "service date, YYYY-MM-DD")}, rows: true},
+		{path: []string{"stops"}, repl: []string{"get", "stops"}, summary: "Show the stops of a trip",
+			params: []cliParam{required("trip", "trip number")}, rows: true},
+		{path: []string{"weekly"}, repl: []string{"get", "weekly"}, summary: "Show a driver's offerings for the week containing a date",
+			params: []cliParam{required("driver", "driver name"), required("date", "any date in the week, YYYY-MM-DD")}, rows: true},
+		{path: []string{"timetable"}, repl: []string{"get", "timetable"}, summary: "Show stop-by-stop timetables for a date",
+			params: []cliParam{required("date", "service date, YYYY-MM-DD"), optional("trip", "only this trip number", "0")}},
+		{path: []string{"route"}, repl: []string{"get", "route"}, summary: "Plan a journey between two locations, changing trips if needed",
+			params: []cliParam{required("from", "origin location name"), required("to", "destination name"), required("date", "service date, YYYY-MM-DD"), required("after", "earliest departure, HH:MM"), optional("min-transfer", "minutes needed to change trips", strconv.Itoa(transit.DefaultMinTransferTime))}},
+
+		{path: []string{"add", "trip"}, repl: []string{"add", "trip"}, summary: "Add a trip",
+			params: []cliParam{required("trip", "trip number"), required("from", "start location name"), required("to", "destination name")}},
+		{path: []string{"add", "offering"}, repl: []string{"add", "offering"}, summary: "Add an offering of a trip",
+			params:   []cliParam{required("trip", "trip number"), required("date", "service date, YYYY-MM-DD"), required("start", "scheduled start, HH:MM"), required("arrival", "scheduled arrival, HH:MM"), required("driver", "driver name"), required("bus", "bus ID")},
+			switches: []string{forceSwitch}},
+		{path: []string{"add", "bus"}, repl: []string{"add", "bus"}, summary: "Add a bus",
+			params: []cliParam{required("id", "bus ID"), required("model", "model"), required("year", "model year")}},
+		{path: []string{"add", "driver"}, repl: []string{"add", "driver"}, summary: "Add a driver",
+			params: []cliParam{required("name", "driver name"), required("phone", "telephone number")}},
+		{path: []string{"add", "stop"}, repl: []string{"add", "stop"}, summary: "Add a stop",
+			params: []cliParam{required("stop", "stop number"), required("address", "stop address")}},
+		{path: []string{"add", "actualinfo"}, repl: []string{"add", "actualinfo"}, summary: "Record what happened at a stop of an offering",
+			params: []cliParam{required("trip", "trip number"), required("date", "service date, YYYY-MM-DD"), required("start", "scheduled start of the offering, HH:MM"), required("stop", "stop number"), required("arrival", "scheduled arrival at the stop, HH:MM"), required("actual-start", "actual start, HH:MM"), required("actual-arrival", "actual arrival at the stop, HH:MM"), required("in", "passengers boarding"), required("out", "passengers alighting")}},
+		{path: []string{"add", "stopinfo"}, repl: []string{"add", "stopinfo"}, summary: "Add a stop to a trip",
+			params: []cliParam{required("trip", "trip number"), required("stop", "stop number"), required("sequence", "position of the stop in the trip"), required("driving-time", "minutes from the previous stop")}},
+		{path: []string{"add", "pattern"}, repl: []string{"add", "pattern"}, summary: "Add a recurring service pattern",
+			params:   []cliParam{required("name", "pattern name"), required("trip", "trip number"), required("days", "seven letters Monday to Sunday with - for no service, e.g. MTWTF--"), required("start", "scheduled start, HH:MM"), required("arrival", "scheduled arrival, HH:MM"), required("from", "first date, YYYY-MM-DD"), required("to", "last date, YYYY-MM-DD"), required("driver", "driver name"), required("bus", "bus ID")},
+			switches: []string{forceSwitch}},
+		{path: []string{"add", "holiday"}, repl: []string{"add", "holiday"}, summary: "Add a holiday",
+			params: []cliParam{required("date", "date, YYYY-MM-DD"), required("name", "holiday name"), optional("service-as", "weekday whose schedule runs, e.g. Sunday; no service if unset", "")}},
+		{path: []string{"add", "exception"}, repl: []string{"add", "exception"}, summary: "Add or remove service of a trip on a date",
+			params: []cliParam{required("trip", `trip number, or "all"`), required("date", "date, YYYY-MM-DD"), required("type", "added or removed"), required("reason", "reason for the exception")}},
+		{path: []string{"addofferings"}, repl: []string{"addofferings"}, summary: "Add offerings read from standard input, one per line as: trip date start arrival driver bus",
+			switches: []string{forceSwitch}},
+		{path: []string{"generate"}, repl: []string{"generate"}, summary: "Expand a service pattern into offerings",
+			params:   []cliParam{required("pattern", "pattern name"), required("from", "first date, YYYY-MM-DD"), required("to", "last date, YYYY-MM-DD")},
+			switches: []string{"dry-run", forceSwitch}, rows: true},
+
+		{path: []string{"delete", "offering"}, repl: []string{"delete", "offer"}, summary: "Delete an offering and its observations",
+			params:   []cliParam{required("trip", "trip number"), required("date", "service date, YYYY-MM-DD"), required("start", "scheduled start, HH:MM")},
+			switches: []string{"preview"}, rows: true},
+		{path: []string{"delete", "bus"}, repl: []string{"delete", "bus"}, summary: "Delete a bus as the delete policy says, moving its offerings from today on to a replacement first",
+			params:   []cliParam{required("id", "bus ID"), optional("reassign", "ID of the bus taking over its offerings from today on", "")},
+			switches: []string{"preview"}, rows: true},
+		{path: []string{"delete", "pattern"}, repl: []string{"delete", "pattern"}, summary: "Delete a service pattern",
+			params: []cliParam{required("name", "pattern name")}},
+		{path: []string{"delete", "holiday"}, repl: []string{"delete", "holiday"}, summary: "Delete a holiday",
+			params: []cliParam{required("date", "date, YYYY-MM-DD")}},
+		{path: []string{"delete", "exception"}, repl: []string{"delete", "exception"}, summary: "Delete a service exception",
+			params: []cliParam{required("trip", `trip number, or "all"`), required("date", "date, YYYY-MM-DD")}},
+
+		{path: []string{"retire", "bus"}, repl: []string{"retire", "bus"}, summary: "Take a bus out of service",
+			params: []cliParam{required("id", "bus ID"), optional("on", "first date out of service, YYYY-MM-DD; today if unset", "")}},
+		{path: []string{"retire", "driver"}, repl: []string{"retire", "driver"}, summary: "Take a driver out of service",
+			params: []cliParam{required("name", "driver name"), optional("on", "first date out of service, YYYY-MM-DD; today if unset", "")}},
+		{path: []string{"reassign", "bus"}, repl: []string{"reassign", "bus"}, summary: "Move the offerings of a bus to another bus",
+			params:   []cliParam{required("id", "bus ID"), required("replacement", "ID of the bus taking over"), optional("from", "first date to move, YYYY-MM-DD; today if unset", "")},
+			switches: []string{forceSwitch}, rows: true},
+
+		{path: []string{"change", "driver"}, repl: []string{"change", "driver"}, summary: "Change the driver of an offering",
+			params:   []cliParam{required("driver", "new driver name"), required("trip", "trip number"), required("date", "service date, YYYY-MM-DD"), required("start", "scheduled start, HH:MM")},
+			switches: []string{forceSwitch}},
+		{path: []string{"change", "bus"}, repl: []string{"change", "bus"}, summary: "Change the bus of an offering",
+			params:   []cliParam{required("bus", "new bus ID"), required("trip", "trip number"), required("date", "service date, YYYY-MM-DD"), required("start", "scheduled start, HH:MM")},
+			switches: []string{forceSwitch}},
+
+		{path: []string{"history", "offering"}, repl: []string{"history", "offering"}, summary: "Show the recorded changes to an offering",
+			params: []cliParam{required("trip", "trip number"), required("date", "service date, YYYY-MM-DD"), required("start", "scheduled start, HH:MM")}, rows: true},
+		{path: []string{"history", "bus"}, repl: []string{"history", "bus"}, summary: "Show the recorded changes to a bus and to the offerings it was assigned",
+			params: []cliParam{required("id", "bus ID")}, rows: true},
+		{path: []string{"history", "edits"}, repl: []string{"history", "edits"}, summary: "Show the edits the operator can undo or redo at the prompt", rows: true},
+
+		{path: []string{"report", "ontime"}, repl: []string{"report", "ontime"}, summary: "Report on-time performance over a date range",
+			params: []cliParam{required("from", "first date, YYYY-MM-DD"), required("to", "last date, YYYY-MM-DD"), optional("late", "minutes late still counted on time", strconv.Itoa(transit.DefaultLateThreshold)), optional("early", "minutes early still counted on time", strconv.Itoa(transit.DefaultEarlyThreshold))}},
+		{path: []string{"report", "ridership"}, repl: []string{"report", "ridership"}, summary: "Report boardings and loads over a date range",
+			params: []cliParam{required("from", "first date, YYYY-MM-DD"), required("to", "last date, YYYY-MM-DD")}},
+
+		{path: []string{"migrate"}, repl: []string{"migrate"}, summary: "Move the schema to a version, or the latest one",
+			params: []cliParam{optional("version", "schema version", "")}},
+		{path: []string{"export", "gtfs"}, repl: []string{"export", "gtfs"}, summary: "Write the database as a GTFS feed",
+			params: []cliParam{required("file", "zip file to write")}},
+		{path: []string{"export", "ical"}, repl: []string{"export", "ical"}, summary: "Write a driver's schedule as an iCalendar file",
+			params: []cliParam{required("driver", "driver name"), required("from", "first date, YYYY-MM-DD"), required("to", "last date, YYYY-MM-DD"), required("file", "file to write")}},
+		{path: []string{"import", "gtfs"}, repl: []string{"import", "gtfs"}, summary: "Load a GTFS feed",
+			params: []cliParam{required("file", "zip file to read")}},
+		{path: []string{"dump"}, repl: []string{"dump"}, summary: "Snapshot every table as JSON, or YAML for .yaml files",
+			params: []cliParam{required("file", "file to write")}},
+		{path: []string{"restore"}, repl: []string{"restore"}, summary: "Load a snapshot written by dump into an empty database",
+			params: []cliParam{required("file", "file to read")}},
+	}
+	for _, table := range []string{"trip", "offering", "bus", "driver", "stop", "actualinfo", "stopinfo", "pattern", "holiday", "exception"} {
+		commands = append(commands, cliCommand{path: []string{"display", table}, repl: []string{"display", table}, summary: fmt.Sprintf("Show every row of the %s table", table), rows: true})
+	}
+	for _, table := range dataTables {
+		commands = append(commands,
+			cliCommand{path: []string{"export", table}, repl: []string{"export", table}, summary: fmt.Sprintf("Write the %s table as CSV", table),
+				params: []cliParam{required("file", "CSV file to write")}},
+			cliCommand{path: []string{"import", table}, repl: []string{"import", table}, summary: fmt.Sprintf("Load rows of the %s table from CSV", table),
+				params: []cliParam{required("file", "CSV file to read")}, switches: []string{"skip-bad-rows"}})
+	}
+	return commands
+}()
+
+// run executes the command line and returns the process exit code. With no
+// subcommand the interactive prompt is started.
+func run(args []string) int {
+	dbFlags := newDBFlags()
+	global := flag.NewFlagSet(programName(), flag.ContinueOnError)
+	dbFlags.register(global)
+	global.Usage = func() { printUsage(global) }
+	if err := global.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	dbFlags.record(global)
+	args = global.Args()
+	if len(args) == 0 || args[0] == "interactive" {
+		if len(args) > 1 {
+			usageError(global, fmt.Errorf("interactive takes no arguments"))
+			return exitUsage
+		}
+		db, cfg, name, err := dbFlags.open()
+		if err != nil {
+			return reportError(err)
+		}
+		defer db.Close()
+		log.Println("Successfully opened database")
+		interactive(db, cfg, name)
+		return exitOK
+	}
+	if args[0] == "help" {
+		printUsage(global)
+		return exitOK
+	}
+	if args[0] == "serve" {
+		fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+		addr := fs.String("addr", ":8080", "`address` to listen on")
+		trustOperator := fs.Bool("trust-operator-header", false, "record changes under the "+server.OperatorHeader+" header of each request, which any client can set")
+		dbFlags.register(fs)
+		fs.Usage = func() {
+			printCommandUsage(fs, "serve [--addr ADDRESS] [--trust-operator-header]", "Serve the HTTP API")
+		}
+		if err := fs.Parse(args[1:]); err != nil {
+			return parseError(err)
+		}
+		dbFlags.record(fs)
+		// "serve addr" is still accepted
+		if fs.NArg() > 1 {
+			usageError(fs, fmt.Errorf("serve takes at most one argument"))
+			return exitUsage
+		}
+		if fs.NArg() == 1 {
+			*addr = fs.Arg(0)
+		}
+		return withDatabase(dbFlags, func(db *transit.Database) error {
+			log.Printf("Serving HTTP API on %s\n", *addr)
+			return http.ListenAndServe(*addr, server.New(db, server.Options{TrustOperatorHeader: *trustOperator}))
+		})
+	}
+	cmd, rest := findCommand(args)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q, run %s --help for a list of commands\n", strings.Join(args, " "), programName())
+		return exitUsage
+	}
+	replArgs, err := cmd.parse(rest, dbFlags)
+	if err != nil {
+		return parseError(err)
+	}
+	// Only the prompt shows progress messages
+	log.SetOutput(ioutil.Discard)
+	return withDatabase(dbFlags, func(db *transit.Database) error {
+		return processCommand(db, replArgs[0], replArgs[1:])
+	})
+}
+
+// findCommand returns the command named by the longest prefix of args and
+// the arguments that follow it
+func findCommand(args []string) (*cliCommand, []string) {
+	var found *cliCommand
+	for i := range cliCommands {
+		c := &cliCommands[i]
+		if len(c.path) > len(args) || (found != nil && len(found.path) >= len(c.path)) {
+			continue
+		}
+		if strings.Join(c.path, " ") == strings.Join(args[:len(c.path)], " ") {
+			found = c
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	return found, args[len(found.path):]
+}
+
+// parse reads the command's flags from args and returns the equivalent REPL
+// command. Positional arguments fill params not given as flags, in order.
+func (c *cliCommand) parse(args []string, dbFlags *dbFlags) ([]string, error) {
+	fs := flag.NewFlagSet(strings.Join(c.path, " "), flag.ContinueOnError)
+	dbFlags.register(fs)
+	values := make([]*string, len(c.params))
+	for i, p := range c.params {
+		values[i] = fs.String(p.name, "", p.usage)
+	}
+	switches := make([]*bool, len(c.switches))
+	for i, s := range c.switches {
+		switches[i] = fs.Bool(s, false, strings.Replace(s, "-", " ", -1))
+	}
+	var format, columns, sortBy *string
+	if c.rows {
+		format = fs.String("format", "", "output `format`: "+strings.Join(output.Formats, ", "))
+		columns = fs.String("columns", "", "comma separated `columns` to show")
+		sortBy = fs.String("sort", "", "comma separated `columns` to sort by, each prefixed with - for descending")
+	}
+	fs.Usage = func() { printCommandUsage(fs, c.synopsis(), c.summary) }
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	dbFlags.record(fs)
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	positional := fs.Args()
+	for i, p := range c.params {
+		if !set[p.name] && len(positional) > 0 {
+			*values[i], positional = positional[0], positional[1:]
+			set[p.name] = true
+		}
+	}
+	if len(positional) > 0 {
+		return nil, usageError(fs, fmt.Errorf("Unexpected arguments: %s", strings.Join(positional, " ")))
+	}
+	result := append([]string{}, c.repl...)
+	for i, p := range c.params {
+		if set[p.name] {
+			continue
+		}
+		if !p.optional {
+			return nil, usageError(fs, fmt.Errorf("Missing --%s", p.name))
+		}
+		// An unset optional param is left out unless a later one is set
+		later := false
+		for _, q := range c.params[i+1:] {
+			later = later || set[q.name]
+		}
+		if later {
+			*values[i] = p.def
+			set[p.name] = true
+		}
+	}
+	for i, p := range c.params {
+		if set[p.name] {
+			result = append(result, *values[i])
+		}
+	}
+	for i, s := range c.switches {
+		if *switches[i] {
+			result = append(result, "--"+s)
+		}
+	}
+	if c.rows {
+		for _, f := range []struct {
+			name  string
+			value *string
+		}{{"format", format}, {"columns", columns}, {"sort", sortBy}} {
+			if set[f.name] {
+				result = append(result, fmt.Sprintf("--%s=%s", f.name, *f.value))
+			}
+		}
+	}
+	return result, nil
+}
+
+// synopsis returns the usage line of the command
+func (c *cliCommand) synopsis() string {
+	words := append([]string{}, c.path...)
+	for _, p := range c.params {
+		arg := fmt.Sprintf("--%s %s", p.name, strings.ToUpper(strings.Replace(p.name, "-", "_", -1)))
+		if p.optional {
+			arg = "[" + arg + "]"
+		}
+		words = append(words, arg)
+	}
+	for _, s := range c.switches {
+		words = append(words, fmt.Sprintf("[--%s]", s))
+	}
+	if c.rows {
+		words = append(words, "[--format FORMAT] [--columns COLUMNS] [--sort COLUMNS]")
+	}
+	return strings.Join(words, " ")
+}
+
+// dbFlags are the database flags, which both the global and the command
+// flag sets accept. Flags override the environment, which overrides the
+// config file.
+type dbFlags struct {
+	config      string
+	use         string
+	path        string
+	schema      string
+	readOnly    bool
+	inMemory    bool
+	busyTimeout time.Duration
+	journalMode string
+	operator    string
+	onDelete    string
+	set         map[string]bool
+}
+
+func newDBFlags() *dbFlags {
+	return &dbFlags{set: map[string]bool{}}
+}
+
+func (d *dbFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&d.config, "config", d.config, "config `file` naming databases, "+transit.DefaultConfigPath+" if it exists ($"+transit.EnvConfig+")")
+	fs.StringVar(&d.use, "use", d.use, "`name` of the database to open from the config file ($"+transit.EnvDatabase+")")
+	fs.StringVar(&d.path, "db", d.path, "SQLite database `path`, "+transit.DATABASE_PATH+" by default ($"+transit.EnvPath+")")
+	fs.StringVar(&d.schema, "schema", d.schema, "`file` of tables for a new database instead of the built-in schema ($"+transit.EnvSchemaPath+")")
+	fs.BoolVar(&d.readOnly, "read-only", d.readOnly, "open the database read-only ($"+transit.EnvReadOnly+")")
+	fs.BoolVar(&d.inMemory, "in-memory", d.inMemory, "use a new in-memory database ($"+transit.EnvInMemory+")")
+	fs.DurationVar(&d.busyTimeout, "busy-timeout", d.busyTimeout, "how long to wait for a locked database ($"+transit.EnvBusyTimeout+")")
+	fs.StringVar(&d.journalMode, "journal-mode", d.journalMode, "SQLite journal `mode`, e.g. WAL ($"+transit.EnvJournalMode+")")
+	fs.StringVar(&d.operator, "operator", d.operator, "`name` the audit log records changes under, the login name by default ($"+transit.EnvOperator+")")
+	fs.StringVar(&d.onDelete, "on-delete", d.onDelete, "`policy` for deleting a bus or driver that offerings use: restrict, cascade or retire ($"+transit.EnvOnDelete+")")
+}
+
+// record notes which database flags fs set
+func (d *dbFlags) record(fs *flag.FlagSet) {
+	fs.Visit(func(f *flag.Flag) { d.set[f.Name] = true })
+}
+
+// open opens the database the flags, environment and config file select.
+// It returns the config and the name of the database in it, if any.
+func (d *dbFlags) open() (*transit.Database, transit.Config, string, error) {
+	configPath := os.Getenv(transit.EnvConfig)
+	if d.set["config"] {
+		configPath = d.config
+	}
+	cfg, err := transit.LoadConfig(configPath)
+	if err != nil {
+		return nil, cfg, "", err
+	}
+	name := os.Getenv(transit.EnvDatabase)
+	if d.set["use"] {
+		name = d.use
+	}
+	if name == "" {
+		name = cfg.Default
+	}
+	opts, err := cfg.Lookup(name)
+	if err != nil {
+		return nil, cfg, name, err
+	}
+	if opts, err = transit.EnvOptions(opts); err != nil {
+		return nil, cfg, name, err
+	}
+	if d.set["db"] {
+		opts.Path = d.path
+	}
+	if d.set["schema"] {
+		opts.SchemaPath = d.schema
+	}
+	if d.set["read-only"] {
+		opts.ReadOnly = d.readOnly
+	}
+	if d.set["in-memory"] {
+		opts.InMemory = d.inMemory
+	}
+	if d.set["busy-timeout"] {
+		opts.BusyTimeout = d.busyTimeout
+	}
+	if d.set["journal-mode"] {
+		opts.JournalMode = d.journalMode
+	}
+	if d.set["on-delete"] {
+		opts.OnDelete = d.onDelete
+	}
+	db, err := transit.GetDatabase(opts)
+	if err == nil && d.set["operator"] {
+		db = db.WithOperator(d.operator)
+	}
+	return db, cfg, name, err
+}
+
+// withDatabase opens the database, runs f and maps its error to an exit code
+func withDatabase(flags *dbFlags, f func(*transit.Database) error) int {
+	db, _, _, err := flags.open()
+	if err != nil {
+		return reportError(err)
+	}
+	defer db.Close()
+	return reportError(f(db))
+}
+
+// reportError prints err, if any, and returns the exit code for it
+func reportError(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	fmt.Fprintln(os.Stderr, strings.TrimSpace(err.Error()))
+	return exitCode(err)
+}
+
+// exitCode maps an error to the exit code of its category
+func exitCode(err error) int {
+	var conflict *transit.ConflictError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &conflict):
+		return exitConflict
+	case errors.Is(err, transit.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, transit.ErrInvalid):
+		return exitInvalid
+	case transit.IsConstraint(err):
+		return exitConflict
+	}
+	return exitError
+}
+
+// parseError returns the exit code for a flag parsing error, which the flag
+// package has already reported
+func parseError(err error) int {
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	return exitUsage
+}
+
+// usageError reports err followed by the usage of fs
+func usageError(fs *flag.FlagSet, err error) error {
+	fmt.Fprintln(os.Stderr, err)
+	fs.Usage()
+	return err
+}
+
+func printCommandUsage(fs *flag.FlagSet, synopsis string, summary string) {
+	out := fs.Output()
+	fmt.Fprintf(out, "Usage: %s [DATABASE FLAGS] %s\n\n%s\n\nFlags:\n", programName(), synopsis, summary)
+	fs.PrintDefaults()
+}
+
+func printUsage(global *flag.FlagSet) {
+	out := global.Output()
+	fmt.Fprintf(out, "Usage: %s [DATABASE FLAGS] COMMAND [FLAGS]\n\nCommands:\n", programName())
+	fmt.Fprintf(out, "  %-20s %s\n", "interactive", "Read commands from a prompt (the default)")
+	fmt.Fprintf(out, "  %-20s %s\n", "serve", "Serve the HTTP API")
+	for _, c := range cliCommands {
+		fmt.Fprintf(out, "  %-20s %s\n", strings.Join(c.path, " "), c.summary)
+	}
+	fmt.Fprintf(out, "\nRun %s COMMAND --help for the flags of a command.\n\nDatabase flags, also accepted after the command:\n", programName())
+	global.PrintDefaults()
+	fmt.Fprintf(out, "\nExit status is %d on success, %d for usage errors, %d if a row is not found, %d for invalid input, %d for conflicts and %d otherwise.\n", exitOK, exitUsage, exitNotFound, exitInvalid, exitConflict, exitError)
+}
+
+func programName() string {
+	return filepath.Base(os.Args[0])
+}
@@ -1,5 +1,8 @@
 module github.com/hlin91/CS4350_Lab4
 
-go 1.14
+go 1.16
 
-require github.com/mattn/go-sqlite3 v1.14.7
\ No newline at end of file
+require (
+	github.com/mattn/go-sqlite3 v1.14.7
+	gopkg.in/yaml.v3 v3.0.1
+)
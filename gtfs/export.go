@@ -0,0 +1,240 @@
+// Package gtfs converts the transit database to and from GTFS static feeds
+package gtfs
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+const (
+	DefaultAgencyID       = "1"
+	DefaultAgencyName     = "CS4350 Transit"
+	DefaultAgencyURL      = "http://localhost/"
+	DefaultAgencyTimezone = "America/Los_Angeles"
+
+	// routeTypeBus is the GTFS route_type for bus service
+	routeTypeBus = "3"
+	// locationPrefix marks the stop IDs made up for trip start and
+	// destination names, which are not rows of the Stop table
+	locationPrefix = "loc-"
+)
+
+// Options describes the agency that operates the exported service. Empty
+// fields use the defaults above.
+type Options struct {
+	AgencyID       string
+	AgencyName     string
+	AgencyURL      string
+	AgencyTimezone string
+}
+
+// feed holds the rows of each GTFS file in the order they are written
+type feed struct {
+	agency        [][]string
+	stops         [][]string
+	routes        [][]string
+	trips         [][]string
+	stopTimes     [][]string
+	calendarDates [][]string
+}
+
+// ExportFile writes the database as a GTFS zip to path
+func ExportFile(db *transit.Database, path string, opts Options) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Export(db, f, opts); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// Export writes the database as a GTFS zip to w. Every Trip becomes a route
+// and every TripOffering a GTFS trip running on the single service date
+// listed for it in calendar_dates.txt. Stop times run from the trip's start
+// location through its TripStopInfo stops, in SequenceNumber order and timed
+// by DrivingTime, to its destination. Nothing is written if the driving
+// times of an offering would take it past its scheduled arrival, or back in
+// time.
+func Export(db *transit.Database, w io.Writer, opts Options) error {
+	f, err := buildFeed(db, opts)
+	if err != nil {
+		return err
+	}
+	z := zip.NewWriter(w)
+	files := []struct {
+		name   string
+		header []string
+		rows   [][]string
+	}{
+		{"agency.txt", []string{"agency_id", "agency_name", "agency_url", "agency_timezone"}, f.agency},
+		{"stops.txt", []string{"stop_id", "stop_name", "stop_lat", "stop_lon"}, f.stops},
+		{"routes.txt", []string{"route_id", "agency_id", "route_short_name", "route_long_name", "route_type"}, f.routes},
+		{"trips.txt", []string{"route_id", "service_id", "trip_id"}, f.trips},
+		{"stop_times.txt", []string{"trip_id", "arrival_time", "departure_time", "stop_id", "stop_sequence"}, f.stopTimes},
+		{"calendar_dates.txt", []string{"service_id", "date", "exception_type"}, f.calendarDates},
+	}
+	for _, file := range files {
+		// A fixed header keeps the archive byte-for-byte reproducible
+		fw, err := z.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate})
+		if err != nil {
+			return err
+		}
+		cw := csv.NewWriter(fw)
+		cw.Write(file.header)
+		cw.WriteAll(file.rows)
+		if err := cw.Error(); err != nil {
+			return fmt.Errorf("Error writing %s: %v", file.name, err)
+		}
+	}
+	return z.Close()
+}
+
+// buildFeed reads the tables needed for the feed and converts them to rows
+func buildFeed(db *transit.Database, opts Options) (feed, error) {
+	opts = withDefaults(opts)
+	f := feed{agency: [][]string{{opts.AgencyID, opts.AgencyName, opts.AgencyURL, opts.AgencyTimezone}}}
+	stops, err := db.GetStopTable()
+	if err != nil {
+		return f, err
+	}
+	trips, err := db.GetTripTable()
+	if err != nil {
+		return f, err
+	}
+	offerings, err := db.GetTripOfferingTable()
+	if err != nil {
+		return f, err
+	}
+	// Stop coordinates are not stored so every stop is placed at 0,0
+	for _, s := range stops {
+		f.stops = append(f.stops, []string{strconv.Itoa(s.StopNumber), s.StopAddress, "0", "0"})
+	}
+	locations := map[string]bool{}
+	for _, t := range trips {
+		f.routes = append(f.routes, []string{strconv.Itoa(t.TripNumber), opts.AgencyID, strconv.Itoa(t.TripNumber), fmt.Sprintf("%s - %s", t.StartLocationName, t.DestinationName), routeTypeBus})
+		locations[t.StartLocationName] = true
+		locations[t.DestinationName] = true
+	}
+	for _, name := range sortedKeys(locations) {
+		f.stops = append(f.stops, []string{locationID(name), name, "0", "0"})
+	}
+	sort.SliceStable(offerings, func(i, j int) bool {
+		a, b := offerings[i], offerings[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.TripNumber != b.TripNumber {
+			return a.TripNumber < b.TripNumber
+		}
+		return a.ScheduledStartTime.Before(b.ScheduledStartTime)
+	})
+	dates := map[string]bool{}
+	for _, o := range offerings {
+		t, err := db.GetTimetable(o)
+		if err != nil {
+			return f, fmt.Errorf("Trip %d on %s at %s: %v", o.TripNumber, o.Date, o.ScheduledStartTime, err)
+		}
+		// Stop times past the scheduled arrival, or going backwards, would
+		// make a feed that GTFS consumers, and Import, reject
+		if err := checkStopOrder(t); err != nil {
+			return f, err
+		}
+		serviceID := strings.Replace(o.Date.String(), "-", "", -1)
+		tripID := TripID(o)
+		dates[serviceID] = true
+		f.trips = append(f.trips, []string{strconv.Itoa(o.TripNumber), serviceID, tripID})
+		f.stopTimes = append(f.stopTimes, stopTimeRow(tripID, o.ScheduledStartTime, locationID(t.Trip.StartLocationName), 0))
+		for i, s := range t.Stops {
+			f.stopTimes = append(f.stopTimes, stopTimeRow(tripID, s.ScheduledArrivalTime, strconv.Itoa(s.StopNumber), i+1))
+		}
+		f.stopTimes = append(f.stopTimes, stopTimeRow(tripID, arrival(o), locationID(t.Trip.DestinationName), len(t.Stops)+1))
+	}
+	for _, d := range sortedKeys(dates) {
+		f.calendarDates = append(f.calendarDates, []string{d, d, "1"})
+	}
+	return f, nil
+}
+
+// checkStopOrder refuses a timetable whose driving times reach a stop
+// before the one it follows, or after the scheduled arrival
+func checkStopOrder(t transit.Timetable) error {
+	o := t.Offering
+	prev := o.ScheduledStartTime
+	for _, s := range t.Stops {
+		if s.ScheduledArrivalTime.Before(prev) {
+			return invalidf("Trip %d on %s at %s: driving times reach stop %d at %s, before leaving the previous stop at %s", o.TripNumber, o.Date, o.ScheduledStartTime, s.StopNumber, s.ScheduledArrivalTime, prev)
+		}
+		prev = s.ScheduledArrivalTime
+	}
+	if end := arrival(o); end.Before(prev) {
+		return invalidf("Trip %d on %s at %s: driving times reach the last stop at %s but the scheduled arrival is %s", o.TripNumber, o.Date, o.ScheduledStartTime, prev, end)
+	}
+	return nil
+}
+
+// TripID returns the GTFS trip_id used for an offering
+func TripID(o transit.TripOffering) string {
+	return fmt.Sprintf("%d-%s-%s", o.TripNumber, o.Date, o.ScheduledStartTime)
+}
+
+// stopTimeRow writes t in the HH:MM:SS form used by stop_times.txt
+func stopTimeRow(tripID string, t transit.TimeOfDay, stopID string, sequence int) []string {
+	return []string{tripID, t.StringWithSeconds(), t.StringWithSeconds(), stopID, strconv.Itoa(sequence)}
+}
+
+// arrival returns the offering's arrival, adding 24 hours to an arrival
+// earlier than the start as GTFS requires
+func arrival(o transit.TripOffering) transit.TimeOfDay {
+	if o.ScheduledArrivalTime.Before(o.ScheduledStartTime) {
+		return o.ScheduledArrivalTime.Add(24 * time.Hour)
+	}
+	return o.ScheduledArrivalTime
+}
+
+// locationID returns the stop ID made up for a trip start or destination name
+func locationID(name string) string {
+	return locationPrefix + name
+}
+
+func withDefaults(opts Options) Options {
+	if opts.AgencyID == "" {
+		opts.AgencyID = DefaultAgencyID
+	}
+	if opts.AgencyName == "" {
+		opts.AgencyName = DefaultAgencyName
+	}
+	if opts.AgencyURL == "" {
+		opts.AgencyURL = DefaultAgencyURL
+	}
+	if opts.AgencyTimezone == "" {
+		opts.AgencyTimezone = DefaultAgencyTimezone
+	}
+	return opts
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// invalidf formats a validation error that matches transit.ErrInvalid
+func invalidf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), transit.ErrInvalid)
+}
@@ -0,0 +1,158 @@
+package gtfs_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/gtfs"
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// openMemory returns an empty in-memory database, closed when the test ends
+func openMemory(t *testing.T) *transit.Database {
+	t.Helper()
+	db, err := transit.GetDatabase(transit.Options{InMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newDatabase returns a database holding a trip with two stops, run once in
+// the day and once after midnight, and a trip without stops
+func newDatabase(t *testing.T) *transit.Database {
+	t.Helper()
+	db := openMemory(t)
+	date := func(s string) transit.ServiceDate {
+		d, err := transit.ParseServiceDate(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	tod := func(s string) transit.TimeOfDay {
+		tt, err := transit.ParseTimeOfDay(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tt
+	}
+	for _, err := range []error{
+		db.AddTrip(1, "Pomona", "Ontario"),
+		db.AddTrip(2, "Ontario", "Pomona"),
+		db.AddStop(10, "1 Main St"),
+		db.AddStop(20, "2 Holt Ave"),
+		db.AddTripStopInfo(1, 10, 1, 10),
+		db.AddTripStopInfo(1, 20, 2, 15),
+		db.AddBus(1, "Gillig", 2015),
+		db.AddDriver("O'Brien", "555-0100"),
+		db.AddOffering(1, date("2026-10-19"), tod("08:00"), tod("08:30"), "O'Brien", 1),
+		db.AddOffering(1, date("2026-10-19"), tod("23:50"), tod("00:20"), "O'Brien", 1),
+		db.AddOffering(2, date("2026-10-20"), tod("09:00"), tod("09:40"), "O'Brien", 1),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// unzip returns the contents of each file of a zip archive
+func unzip(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = contents
+	}
+	return files
+}
+
+func TestExportGolden(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gtfs.Export(newDatabase(t), &buf, gtfs.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	files := unzip(t, buf.Bytes())
+	for _, name := range []string{"agency.txt", "stops.txt", "routes.txt", "trips.txt", "stop_times.txt", "calendar_dates.txt"} {
+		got, ok := files[name]
+		if !ok {
+			t.Errorf("The feed has no %s", name)
+			continue
+		}
+		golden := filepath.Join("testdata", strings.TrimSuffix(name, ".txt")+".golden")
+		if *update {
+			if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s differs from %s:\n%s\nwant:\n%s", name, golden, got, want)
+		}
+	}
+}
+
+func TestExportImportsBack(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gtfs.Export(newDatabase(t), &buf, gtfs.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gtfs.Import(openMemory(t), bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != nil {
+		t.Fatalf("Importing the exported feed: %v", err)
+	}
+}
+
+func TestExportRefusesDrift(t *testing.T) {
+	tests := []struct {
+		name        string
+		drivingTime float32
+	}{
+		{"driving times past the arrival", 30},
+		{"driving back in time", -30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newDatabase(t)
+			if err := db.AddStop(30, "3 Mission Blvd"); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.AddTripStopInfo(1, 30, 3, tt.drivingTime); err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			err := gtfs.Export(db, &buf, gtfs.Options{})
+			if !errors.Is(err, transit.ErrInvalid) {
+				t.Errorf("Got %v, want an invalid timetable error", err)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("Wrote %d bytes of a feed that was refused", buf.Len())
+			}
+		})
+	}
+}
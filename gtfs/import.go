@@ -0,0 +1,547 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+const gtfsDateLayout = "20060102"
+
+// ImportReport summarises an import and the GTFS data that had no place in
+// the transit tables
+type ImportReport struct {
+	Stops         int
+	Trips         int
+	TripStopInfos int
+	TripOfferings int
+	Unmapped      []string // files and columns that were ignored
+	Notes         []string
+}
+
+func (r ImportReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Imported %d stops, %d trips, %d trip stops and %d offerings\n", r.Stops, r.Trips, r.TripStopInfos, r.TripOfferings)
+	for _, u := range r.Unmapped {
+		fmt.Fprintf(&b, "Unmapped: %s\n", u)
+	}
+	for _, n := range r.Notes {
+		fmt.Fprintf(&b, "Note: %s\n", n)
+	}
+	return b.String()
+}
+
+// ImportFile loads the GTFS zip at path into the database
+func ImportFile(db *transit.Database, path string) (ImportReport, error) {
+	z, err := zip.OpenReader(path)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	defer z.Close()
+	return importZip(db, &z.Reader)
+}
+
+// Import loads a GTFS zip of the given size into the database. Stops become
+// Stop rows, each distinct stop sequence of a route becomes a Trip with its
+// TripStopInfo, and each GTFS trip becomes one TripOffering per date its
+// service runs according to calendar.txt and calendar_dates.txt. Every row
+// is inserted in one transaction, so nothing is written if the feed fails
+// validation or any row is rejected.
+func Import(db *transit.Database, r io.ReaderAt, size int64) (ImportReport, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	return importZip(db, z)
+}
+
+// table is a GTFS file with its columns indexed by name. Columns that are
+// read are remembered so the rest can be reported as unmapped.
+type table struct {
+	name    string
+	columns map[string]int
+	header  []string
+	rows    [][]string
+	used    map[string]bool
+}
+
+// get returns the named column of row, or "" if the file does not have it
+func (t *table) get(row []string, column string) string {
+	t.used[column] = true
+	i, ok := t.columns[column]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// line returns the line number of the i-th data row
+func (t *table) line(i int) int {
+	return i + 2
+}
+
+func (t *table) unmapped() []string {
+	result := []string{}
+	for _, c := range t.header {
+		if !t.used[c] {
+			result = append(result, fmt.Sprintf("%s: %s", t.name, c))
+		}
+	}
+	return result
+}
+
+func readTable(f *zip.File) (*table, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	cr := csv.NewReader(rc)
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %v", f.Name, err)
+	}
+	t := &table{name: f.Name, columns: map[string]int{}, rows: [][]string{}, used: map[string]bool{}}
+	if len(records) == 0 {
+		return t, nil
+	}
+	for i, c := range records[0] {
+		c = strings.TrimSpace(strings.TrimPrefix(c, "\ufeff"))
+		t.header = append(t.header, c)
+		t.columns[c] = i
+	}
+	t.rows = records[1:]
+	return t, nil
+}
+
+// stopTime is one timed call of a GTFS trip, in seconds after midnight
+type stopTime struct {
+	stopID   string
+	sequence int
+	arrival  int
+	depart   int
+}
+
+// gtfsTrip is a trip from trips.txt with its stop times in order
+type gtfsTrip struct {
+	tripID    string
+	routeID   string
+	serviceID string
+	stops     []stopTime
+}
+
+func importZip(db *transit.Database, z *zip.Reader) (ImportReport, error) {
+	report := ImportReport{Unmapped: []string{}, Notes: []string{}}
+	tables := map[string]*table{}
+	for _, f := range z.File {
+		switch f.Name {
+		case "stops.txt", "trips.txt", "stop_times.txt", "calendar.txt", "calendar_dates.txt":
+			t, err := readTable(f)
+			if err != nil {
+				return report, err
+			}
+			tables[f.Name] = t
+		default:
+			if !f.FileInfo().IsDir() {
+				report.Unmapped = append(report.Unmapped, f.Name)
+			}
+		}
+	}
+	for _, name := range []string{"stops.txt", "trips.txt", "stop_times.txt"} {
+		if tables[name] == nil {
+			return report, invalidf("Feed has no %s", name)
+		}
+	}
+	if tables["calendar.txt"] == nil && tables["calendar_dates.txt"] == nil {
+		return report, invalidf("Feed has neither calendar.txt nor calendar_dates.txt")
+	}
+	existingStops, err := db.GetStopTable()
+	if err != nil {
+		return report, err
+	}
+	existingTrips, err := db.GetTripTable()
+	if err != nil {
+		return report, err
+	}
+	data := transit.Dataset{}
+
+	// Stops with numeric IDs keep their number unless a stop already has
+	// it, the rest take the lowest numbers not already in use
+	stopsTable := tables["stops.txt"]
+	stopNumbers := map[string]int{}
+	stopNames := map[string]string{}
+	usedStops := map[int]bool{}
+	for _, s := range existingStops {
+		usedStops[s.StopNumber] = true
+	}
+	renumberedStops := 0
+	pending := []string{}
+	for i, row := range stopsTable.rows {
+		id := stopsTable.get(row, "stop_id")
+		if id == "" {
+			return report, invalidf("stops.txt line %d: missing stop_id", stopsTable.line(i))
+		}
+		if _, ok := stopNames[id]; ok {
+			return report, invalidf("stops.txt line %d: duplicate stop_id %q", stopsTable.line(i), id)
+		}
+		stopNames[id] = stopsTable.get(row, "stop_name")
+		// Stations and entrances cannot be served by a trip
+		if lt := stopsTable.get(row, "location_type"); lt != "" && lt != "0" {
+			continue
+		}
+		// Start and destination names made up by Export are not stops
+		if strings.HasPrefix(id, locationPrefix) {
+			continue
+		}
+		n, err := strconv.Atoi(id)
+		switch {
+		case err != nil || n <= 0:
+			pending = append(pending, id)
+		case usedStops[n]:
+			renumberedStops++
+			pending = append(pending, id)
+		default:
+			stopNumbers[id] = n
+			usedStops[n] = true
+		}
+	}
+	nextStop := nextFree(usedStops)
+	for _, id := range pending {
+		stopNumbers[id] = nextStop
+		usedStops[nextStop] = true
+		nextStop = nextFree(usedStops)
+	}
+	for _, row := range stopsTable.rows {
+		id := stopsTable.get(row, "stop_id")
+		if n, ok := stopNumbers[id]; ok {
+			data.Stops = append(data.Stops, transit.Stop{StopNumber: n, StopAddress: stopNames[id]})
+		}
+	}
+
+	services, err := serviceDates(tables["calendar.txt"], tables["calendar_dates.txt"])
+	if err != nil {
+		return report, err
+	}
+
+	tripsTable := tables["trips.txt"]
+	trips := []*gtfsTrip{}
+	tripByID := map[string]*gtfsTrip{}
+	for i, row := range tripsTable.rows {
+		t := &gtfsTrip{
+			tripID:    tripsTable.get(row, "trip_id"),
+			routeID:   tripsTable.get(row, "route_id"),
+			serviceID: tripsTable.get(row, "service_id"),
+		}
+		if t.tripID == "" {
+			return report, invalidf("trips.txt line %d: missing trip_id", tripsTable.line(i))
+		}
+		if tripByID[t.tripID] != nil {
+			return report, invalidf("trips.txt line %d: duplicate trip_id %q", tripsTable.line(i), t.tripID)
+		}
+		if _, ok := services[t.serviceID]; !ok {
+			return report, invalidf("trips.txt line %d: unknown service_id %q", tripsTable.line(i), t.serviceID)
+		}
+		trips = append(trips, t)
+		tripByID[t.tripID] = t
+	}
+
+	timesTable := tables["stop_times.txt"]
+	for i, row := range timesTable.rows {
+		line := timesTable.line(i)
+		t := tripByID[timesTable.get(row, "trip_id")]
+		if t == nil {
+			return report, invalidf("stop_times.txt line %d: unknown trip_id %q", line, timesTable.get(row, "trip_id"))
+		}
+		st := stopTime{stopID: timesTable.get(row, "stop_id"), arrival: -1, depart: -1}
+		if _, ok := stopNames[st.stopID]; !ok {
+			return report, invalidf("stop_times.txt line %d: unknown stop_id %q", line, st.stopID)
+		}
+		st.sequence, err = strconv.Atoi(timesTable.get(row, "stop_sequence"))
+		if err != nil {
+			return report, invalidf("stop_times.txt line %d: invalid stop_sequence %q", line, timesTable.get(row, "stop_sequence"))
+		}
+		if s := timesTable.get(row, "arrival_time"); s != "" {
+			if st.arrival, err = parseTime(s); err != nil {
+				return report, invalidf("stop_times.txt line %d: %v", line, err)
+			}
+		}
+		if s := timesTable.get(row, "departure_time"); s != "" {
+			if st.depart, err = parseTime(s); err != nil {
+				return report, invalidf("stop_times.txt line %d: %v", line, err)
+			}
+		}
+		t.stops = append(t.stops, st)
+	}
+	for _, t := range trips {
+		if len(t.stops) < 2 {
+			return report, invalidf("Trip %q has fewer than two stop times", t.tripID)
+		}
+		sort.SliceStable(t.stops, func(i, j int) bool { return t.stops[i].sequence < t.stops[j].sequence })
+		if err := interpolate(t); err != nil {
+			return report, err
+		}
+	}
+
+	// Trips of a route that call at the same stops share a transit Trip. A
+	// numeric route ID is kept as the trip number for the first such
+	// pattern, unless a trip already has it.
+	usedTrips := map[int]bool{}
+	existingTripNumbers := map[int]bool{}
+	for _, t := range existingTrips {
+		usedTrips[t.TripNumber] = true
+		existingTripNumbers[t.TripNumber] = true
+	}
+	for _, t := range trips {
+		if n, err := strconv.Atoi(t.routeID); err == nil && n > 0 {
+			usedTrips[n] = true
+		}
+	}
+	claimed := map[int]bool{}
+	renumberedTrips := 0
+	patterns := map[string]int{}
+	differing := 0
+	for _, t := range trips {
+		ids := []string{t.routeID}
+		for _, st := range t.stops {
+			ids = append(ids, st.stopID)
+		}
+		key := strings.Join(ids, "\x00")
+		tripNumber, ok := patterns[key]
+		if ok {
+			if !sameDrivingTimes(tripStopInfos(t, tripNumber, stopNumbers), data.TripStopInfos) {
+				differing++
+			}
+		} else {
+			if n, err := strconv.Atoi(t.routeID); err == nil && n > 0 && !claimed[n] && !existingTripNumbers[n] {
+				tripNumber = n
+				claimed[n] = true
+			} else {
+				if err == nil && existingTripNumbers[n] {
+					renumberedTrips++
+				}
+				tripNumber = nextFree(usedTrips)
+			}
+			usedTrips[tripNumber] = true
+			patterns[key] = tripNumber
+			first, last := t.stops[0], t.stops[len(t.stops)-1]
+			data.Trips = append(data.Trips, transit.Trip{
+				TripNumber:        tripNumber,
+				StartLocationName: stopNames[first.stopID],
+				DestinationName:   stopNames[last.stopID],
+			})
+			data.TripStopInfos = append(data.TripStopInfos, tripStopInfos(t, tripNumber, stopNumbers)...)
+		}
+		first, last := t.stops[0], t.stops[len(t.stops)-1]
+		for _, date := range services[t.serviceID] {
+			// Service after midnight keeps its GTFS time past 24:00 on the
+			// service date it belongs to
+			data.TripOfferings = append(data.TripOfferings, transit.TripOffering{
+				TripNumber:           tripNumber,
+				Date:                 transit.ServiceDateOf(date),
+				ScheduledStartTime:   transit.NewTimeOfDay(0, 0, first.depart),
+				ScheduledArrivalTime: transit.NewTimeOfDay(0, 0, last.arrival),
+			})
+		}
+	}
+	if renumberedStops > 0 {
+		report.Notes = append(report.Notes, fmt.Sprintf("%d stops were renumbered because a stop already has their stop_id", renumberedStops))
+	}
+	if renumberedTrips > 0 {
+		report.Notes = append(report.Notes, fmt.Sprintf("%d trips were renumbered because a trip already has their route_id", renumberedTrips))
+	}
+	if differing > 0 {
+		report.Notes = append(report.Notes, fmt.Sprintf("%d trips have running times that differ from the first trip of their pattern, whose times were kept", differing))
+	}
+	report.Notes = append(report.Notes, "Imported offerings have no driver or bus assigned")
+
+	for _, name := range []string{"stops.txt", "trips.txt", "stop_times.txt", "calendar.txt", "calendar_dates.txt"} {
+		if t := tables[name]; t != nil {
+			report.Unmapped = append(report.Unmapped, t.unmapped()...)
+		}
+	}
+	sort.Strings(report.Unmapped)
+	if err := db.InsertDataset(data); err != nil {
+		return report, err
+	}
+	report.Stops = len(data.Stops)
+	report.Trips = len(data.Trips)
+	report.TripStopInfos = len(data.TripStopInfos)
+	report.TripOfferings = len(data.TripOfferings)
+	return report, nil
+}
+
+// serviceDates returns the sorted dates each service runs on, built from the
+// weekly ranges of calendar.txt with calendar_dates.txt added and removed
+func serviceDates(calendar, calendarDates *table) (map[string][]time.Time, error) {
+	days := map[string]map[time.Time]bool{}
+	weekdays := []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+	if calendar != nil {
+		for i, row := range calendar.rows {
+			id := calendar.get(row, "service_id")
+			from, err := time.Parse(gtfsDateLayout, calendar.get(row, "start_date"))
+			if err != nil {
+				return nil, invalidf("calendar.txt line %d: invalid start_date %q", calendar.line(i), calendar.get(row, "start_date"))
+			}
+			to, err := time.Parse(gtfsDateLayout, calendar.get(row, "end_date"))
+			if err != nil {
+				return nil, invalidf("calendar.txt line %d: invalid end_date %q", calendar.line(i), calendar.get(row, "end_date"))
+			}
+			runs := [7]bool{}
+			for d, name := range weekdays {
+				runs[d] = calendar.get(row, name) == "1"
+			}
+			if days[id] == nil {
+				days[id] = map[time.Time]bool{}
+			}
+			for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+				if runs[d.Weekday()] {
+					days[id][d] = true
+				}
+			}
+		}
+	}
+	if calendarDates != nil {
+		for i, row := range calendarDates.rows {
+			id := calendarDates.get(row, "service_id")
+			date, err := time.Parse(gtfsDateLayout, calendarDates.get(row, "date"))
+			if err != nil {
+				return nil, invalidf("calendar_dates.txt line %d: invalid date %q", calendarDates.line(i), calendarDates.get(row, "date"))
+			}
+			if days[id] == nil {
+				days[id] = map[time.Time]bool{}
+			}
+			switch calendarDates.get(row, "exception_type") {
+			case "1":
+				days[id][date] = true
+			case "2":
+				delete(days[id], date)
+			default:
+				return nil, invalidf("calendar_dates.txt line %d: invalid exception_type %q", calendarDates.line(i), calendarDates.get(row, "exception_type"))
+			}
+		}
+	}
+	result := map[string][]time.Time{}
+	for id, set := range days {
+		dates := []time.Time{}
+		for d := range set {
+			dates = append(dates, d)
+		}
+		sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+		result[id] = dates
+	}
+	return result, nil
+}
+
+// interpolate fills in the times GTFS lets a trip leave out between timed
+// stops, spreading them evenly by position
+func interpolate(t *gtfsTrip) error {
+	for i := range t.stops {
+		st := &t.stops[i]
+		if st.arrival < 0 {
+			st.arrival = st.depart
+		}
+		if st.depart < 0 {
+			st.depart = st.arrival
+		}
+	}
+	n := len(t.stops)
+	if t.stops[0].depart < 0 || t.stops[n-1].arrival < 0 {
+		return invalidf("Trip %q must have times at its first and last stops", t.tripID)
+	}
+	prev := 0
+	for i := 1; i < n; i++ {
+		if t.stops[i].arrival < 0 {
+			continue
+		}
+		for j := prev + 1; j < i; j++ {
+			at := t.stops[prev].depart + (t.stops[i].arrival-t.stops[prev].depart)*(j-prev)/(i-prev)
+			t.stops[j].arrival, t.stops[j].depart = at, at
+		}
+		prev = i
+	}
+	for i := 1; i < n; i++ {
+		if t.stops[i].arrival < t.stops[i-1].depart {
+			return invalidf("Trip %q arrives at stop %q before leaving the previous stop", t.tripID, t.stops[i].stopID)
+		}
+	}
+	return nil
+}
+
+// tripStopInfos returns the stops of t that are Stop rows, numbered in
+// order. Driving times are measured between arrivals so that the timetable
+// derived from them reproduces the GTFS arrival times.
+func tripStopInfos(t *gtfsTrip, tripNumber int, stopNumbers map[string]int) []transit.TripStopInfo {
+	result := []transit.TripStopInfo{}
+	for i, st := range t.stops {
+		n, ok := stopNumbers[st.stopID]
+		if !ok {
+			continue
+		}
+		driving := 0.0
+		if i > 0 {
+			prev := t.stops[i-1].arrival
+			if i == 1 {
+				prev = t.stops[0].depart
+			}
+			driving = math.Round(float64(st.arrival-prev)/6) / 10
+		}
+		result = append(result, transit.TripStopInfo{
+			TripNumber:     tripNumber,
+			StopNumber:     n,
+			SequenceNumber: len(result) + 1,
+			DrivingTime:    float32(driving),
+		})
+	}
+	return result
+}
+
+// sameDrivingTimes reports whether infos matches the stops already stored
+// for the same trip
+func sameDrivingTimes(infos []transit.TripStopInfo, stored []transit.TripStopInfo) bool {
+	i := 0
+	for _, s := range stored {
+		if len(infos) == 0 || s.TripNumber != infos[0].TripNumber {
+			continue
+		}
+		if i >= len(infos) || s.DrivingTime != infos[i].DrivingTime {
+			return false
+		}
+		i++
+	}
+	return i == len(infos)
+}
+
+// parseTime converts a GTFS H:MM:SS time, which may pass 24:00, to seconds
+func parseTime(s string) (int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("Invalid time %q, expected HH:MM:SS", s)
+	}
+	total := 0
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || (i > 0 && n > 59) {
+			return 0, fmt.Errorf("Invalid time %q, expected HH:MM:SS", s)
+		}
+		total = total*60 + n
+	}
+	return total, nil
+}
+
+// nextFree returns the smallest positive number not in used
+func nextFree(used map[int]bool) int {
+	n := 1
+	for used[n] {
+		n++
+	}
+	return n
+}
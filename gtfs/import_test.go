@@ -0,0 +1,172 @@
+package gtfs_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/gtfs"
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+// feed holds the files of a small GTFS feed: three stops and a route run by
+// trip t1 on the weekdays of one week
+func feed() map[string]string {
+	return map[string]string{
+		"stops.txt": "stop_id,stop_name\n" +
+			"s1,1 Main St\n" +
+			"s2,2 Holt Ave\n" +
+			"s3,3 Mission Blvd\n",
+		"trips.txt": "route_id,service_id,trip_id\n" +
+			"r1,weekdays,t1\n",
+		"stop_times.txt": "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+			"t1,08:00:00,08:00:00,s1,1\n" +
+			"t1,,,s2,2\n" +
+			"t1,08:20:00,08:20:00,s3,3\n",
+		"calendar.txt": "service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\n" +
+			"weekdays,1,1,1,1,1,0,0,20261019,20261025\n",
+	}
+}
+
+// zipFeed returns files as a zip archive for Import
+func zipFeed(t *testing.T, files map[string]string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	for name, contents := range files {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func importFeed(t *testing.T, db *transit.Database, files map[string]string) (gtfs.ImportReport, error) {
+	t.Helper()
+	r := zipFeed(t, files)
+	return gtfs.Import(db, r, r.Size())
+}
+
+func TestImportRejectsUnknownIDs(t *testing.T) {
+	tests := []struct {
+		name, from, to string
+	}{
+		{"unknown stop_id", "t1,08:20:00,08:20:00,s3,3", "t1,08:20:00,08:20:00,s9,3"},
+		{"unknown trip_id", "t1,08:20:00,08:20:00,s3,3", "t9,08:20:00,08:20:00,s3,3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := feed()
+			files["stop_times.txt"] = strings.Replace(files["stop_times.txt"], tt.from, tt.to, 1)
+			db := openMemory(t)
+			if _, err := importFeed(t, db, files); !errors.Is(err, transit.ErrInvalid) {
+				t.Errorf("Got %v, want an invalid feed error", err)
+			}
+		})
+	}
+}
+
+func TestImportCalendarDates(t *testing.T) {
+	files := feed()
+	// Take Wednesday off and add the Saturday
+	files["calendar_dates.txt"] = "service_id,date,exception_type\n" +
+		"weekdays,20261021,2\n" +
+		"weekdays,20261024,1\n"
+	db := openMemory(t)
+	if _, err := importFeed(t, db, files); err != nil {
+		t.Fatal(err)
+	}
+	offerings, err := db.GetTripOfferingTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, o := range offerings {
+		got = append(got, o.Date.String())
+	}
+	want := "2026-10-19 2026-10-20 2026-10-22 2026-10-23 2026-10-24"
+	if strings.Join(got, " ") != want {
+		t.Errorf("Offerings on %v, want %s", got, want)
+	}
+}
+
+func TestImportInterpolatesTimes(t *testing.T) {
+	db := openMemory(t)
+	if _, err := importFeed(t, db, feed()); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := db.GetTripStopInfoTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// s2 has no times so it is put halfway between 08:00 and 08:20
+	want := []float32{0, 10, 10}
+	if len(infos) != len(want) {
+		t.Fatalf("Got trip stops %v, want %d", infos, len(want))
+	}
+	for i, info := range infos {
+		if info.DrivingTime != want[i] {
+			t.Errorf("Stop %d driving time %v, want %v", info.StopNumber, info.DrivingTime, want[i])
+		}
+	}
+}
+
+func TestImportRollsBackBadRow(t *testing.T) {
+	files := feed()
+	// A second trip at the same time makes a duplicate offering, which only
+	// the insert finds
+	files["trips.txt"] += "r1,weekdays,t2\n"
+	files["stop_times.txt"] += "t2,08:00:00,08:00:00,s1,1\n" +
+		"t2,08:10:00,08:10:00,s2,2\n" +
+		"t2,08:20:00,08:20:00,s3,3\n"
+	db := openMemory(t)
+	if _, err := importFeed(t, db, files); err == nil {
+		t.Fatal("Imported a feed with duplicate offerings")
+	}
+	stops, err := db.GetStopTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	trips, err := db.GetTripTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stops) != 0 || len(trips) != 0 {
+		t.Errorf("Got stops %v and trips %v after the failed import, want none", stops, trips)
+	}
+}
+
+func TestImportRenumbersTakenIDs(t *testing.T) {
+	db := newDatabase(t)
+	var buf bytes.Buffer
+	if err := gtfs.Export(db, &buf, gtfs.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	report, err := gtfs.Import(db, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Importing the exported feed into the same database: %v", err)
+	}
+	if report.Stops != 2 || report.Trips != 2 {
+		t.Errorf("Imported %d stops and %d trips, want 2 of each", report.Stops, report.Trips)
+	}
+	notes := strings.Join(report.Notes, "\n")
+	if !strings.Contains(notes, "2 stops were renumbered") || !strings.Contains(notes, "2 trips were renumbered") {
+		t.Errorf("Import notes %q, want the renumbered stops and trips", notes)
+	}
+	trips, err := db.GetTripTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trips) != 4 {
+		t.Errorf("Got %d trips after importing the feed again, want 4", len(trips))
+	}
+}
@@ -0,0 +1,143 @@
+// Package ical writes driver schedules as iCalendar (RFC 5545) files
+package ical
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+const (
+	// uidDomain makes event UIDs globally unique
+	uidDomain = "cs4350-lab4.transit"
+	prodID    = "-//CS4350 Lab4//Driver Schedule//EN"
+
+	localLayout   = "20060102T150405"
+	utcLayout     = "20060102T150405Z"
+	maxLineOctets = 75
+)
+
+// ExportDriverFile writes the driver's offerings between from and to as an
+// iCalendar file at path
+func ExportDriverFile(store transit.Store, path string, driverName string, from transit.ServiceDate, to transit.ServiceDate) error {
+	// Build the calendar first so a bad request leaves any old file alone
+	var b bytes.Buffer
+	if err := ExportDriver(store, &b, driverName, from, to); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b.Bytes(), 0644)
+}
+
+// ExportDriver writes one VEVENT for each offering assigned to the driver
+// between the dates from and to (inclusive). Each event's UID is derived
+// from the offering's key, so importing a later export of an overlapping
+// range updates the events instead of duplicating them.
+func ExportDriver(store transit.Store, w io.Writer, driverName string, from transit.ServiceDate, to transit.ServiceDate) error {
+	offerings, err := store.GetDriverSchedule(driverName, from, to)
+	if err != nil {
+		return err
+	}
+	trips, err := store.GetTripTable()
+	if err != nil {
+		return err
+	}
+	tripByNumber := make(map[int]transit.Trip)
+	for _, t := range trips {
+		tripByNumber[t.TripNumber] = t
+	}
+	return Write(w, driverName, offerings, tripByNumber, time.Now())
+}
+
+// Write writes offerings as a calendar for the driver. stamp is recorded as
+// the time every event was last exported.
+func Write(w io.Writer, driverName string, offerings []transit.TripOffering, trips map[int]transit.Trip, stamp time.Time) error {
+	cw := &calendarWriter{w: bufio.NewWriter(w)}
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.line("PRODID:" + prodID)
+	cw.line("CALSCALE:GREGORIAN")
+	cw.line("X-WR-CALNAME:" + escape(fmt.Sprintf("%s trips", driverName)))
+	for _, o := range offerings {
+		start, end, err := window(o)
+		if err != nil {
+			return fmt.Errorf("Trip %d on %s at %s: %v", o.TripNumber, o.Date, o.ScheduledStartTime, err)
+		}
+		summary := fmt.Sprintf("Trip %d", o.TripNumber)
+		if t, ok := trips[o.TripNumber]; ok {
+			summary = fmt.Sprintf("Trip %d: %s to %s", o.TripNumber, t.StartLocationName, t.DestinationName)
+		}
+		bus := "No bus assigned"
+		if o.BusID != nil {
+			bus = fmt.Sprintf("Bus %d", *o.BusID)
+		}
+		cw.line("BEGIN:VEVENT")
+		cw.line("UID:" + UID(o))
+		cw.line("DTSTAMP:" + stamp.UTC().Format(utcLayout))
+		// Times are floating, shown in the local time of whoever views them
+		cw.line("DTSTART:" + start.Format(localLayout))
+		cw.line("DTEND:" + end.Format(localLayout))
+		cw.line("SUMMARY:" + escape(summary))
+		cw.line("DESCRIPTION:" + escape(fmt.Sprintf("%s\nDriver %s", bus, o.DriverName)))
+		cw.line("END:VEVENT")
+	}
+	cw.line("END:VCALENDAR")
+	if cw.err != nil {
+		return cw.err
+	}
+	return cw.w.Flush()
+}
+
+// UID returns the event UID for an offering, which depends only on its key
+func UID(o transit.TripOffering) string {
+	return fmt.Sprintf("trip%d-%s-%s@%s", o.TripNumber, strings.Replace(o.Date.String(), "-", "", -1), strings.Replace(o.ScheduledStartTime.String(), ":", "", -1), uidDomain)
+}
+
+// window returns the start and end of an offering. An arrival earlier than
+// the start is taken to be on the next day.
+func window(o transit.TripOffering) (time.Time, time.Time, error) {
+	if o.Date.IsZero() || o.ScheduledStartTime.IsZero() || o.ScheduledArrivalTime.IsZero() {
+		return time.Time{}, time.Time{}, fmt.Errorf("Offering has no date or scheduled times")
+	}
+	arrival := o.ScheduledArrivalTime
+	if arrival.Before(o.ScheduledStartTime) {
+		arrival = arrival.Add(24 * time.Hour)
+	}
+	// UTC only carries the wall clock, the times are written as floating
+	return o.Date.At(o.ScheduledStartTime, time.UTC), o.Date.At(arrival, time.UTC), nil
+}
+
+// escape escapes the characters RFC 5545 reserves in TEXT values
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// calendarWriter writes content lines ending in CRLF, folding any longer
+// than 75 octets without splitting a UTF-8 character
+type calendarWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (cw *calendarWriter) line(s string) {
+	if cw.err != nil {
+		return
+	}
+	// Continuation lines start with a space, which counts towards the limit
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		_, cw.err = cw.w.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		limit = maxLineOctets - 1
+	}
+	_, cw.err = cw.w.WriteString(s + "\r\n")
+}
@@ -0,0 +1,145 @@
+package ical_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hlin91/CS4350_Lab4/ical"
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+// offering returns an offering of trip driven by Ann
+func offering(t *testing.T, trip int, date, start, arrival string, bus *int) transit.TripOffering {
+	t.Helper()
+	d, err := transit.ParseServiceDate(date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := transit.ParseTimeOfDay(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := transit.ParseTimeOfDay(arrival)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transit.TripOffering{TripNumber: trip, Date: d, ScheduledStartTime: s, ScheduledArrivalTime: a, DriverName: "Ann", BusID: bus}
+}
+
+// write returns the calendar Write makes of offerings, with its lines
+// unfolded
+func write(t *testing.T, offerings []transit.TripOffering, trips map[int]transit.Trip) (string, []string) {
+	t.Helper()
+	var buf bytes.Buffer
+	stamp := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	if err := ical.Write(&buf, "Ann", offerings, trips, stamp); err != nil {
+		t.Fatal(err)
+	}
+	raw := buf.String()
+	if !strings.HasSuffix(raw, "\r\n") {
+		t.Errorf("Calendar does not end in CRLF")
+	}
+	return raw, strings.Split(strings.TrimSuffix(strings.Replace(raw, "\r\n ", "", -1), "\r\n"), "\r\n")
+}
+
+func hasLine(lines []string, want string) bool {
+	for _, l := range lines {
+		if l == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWriteEscapesText(t *testing.T) {
+	trips := map[int]transit.Trip{
+		1: {TripNumber: 1, StartLocationName: `Pomona, CA`, DestinationName: `Ontario; Terminal \ Gate 2`},
+	}
+	_, lines := write(t, []transit.TripOffering{offering(t, 1, "2026-10-19", "08:00", "09:00", transit.BusRef(5))}, trips)
+	for _, want := range []string{
+		`SUMMARY:Trip 1: Pomona\, CA to Ontario\; Terminal \\ Gate 2`,
+		`DESCRIPTION:Bus 5\nDriver Ann`,
+		`X-WR-CALNAME:Ann trips`,
+		`UID:trip1-20261019-0800@cs4350-lab4.transit`,
+		`DTSTAMP:20261017T120000Z`,
+	} {
+		if !hasLine(lines, want) {
+			t.Errorf("Calendar %q has no line %q", lines, want)
+		}
+	}
+}
+
+func TestWriteBus(t *testing.T) {
+	tests := []struct {
+		bus  *int
+		want string
+	}{
+		{transit.BusRef(0), `DESCRIPTION:Bus 0\nDriver Ann`},
+		{transit.BusRef(7), `DESCRIPTION:Bus 7\nDriver Ann`},
+		{nil, `DESCRIPTION:No bus assigned\nDriver Ann`},
+	}
+	for _, tt := range tests {
+		_, lines := write(t, []transit.TripOffering{offering(t, 1, "2026-10-19", "08:00", "09:00", tt.bus)}, nil)
+		if !hasLine(lines, tt.want) {
+			t.Errorf("Offering with bus %s: calendar %q has no line %q", transit.BusText(tt.bus), lines, tt.want)
+		}
+	}
+}
+
+func TestWriteAfterMidnight(t *testing.T) {
+	_, lines := write(t, []transit.TripOffering{
+		offering(t, 1, "2026-10-31", "23:30", "00:40", nil),
+		offering(t, 2, "2026-10-31", "25:10", "26:00", nil),
+	}, nil)
+	for _, want := range []string{
+		"DTSTART:20261031T233000", "DTEND:20261101T004000",
+		"DTSTART:20261101T011000", "DTEND:20261101T020000",
+		"UID:trip2-20261031-2510@cs4350-lab4.transit",
+	} {
+		if !hasLine(lines, want) {
+			t.Errorf("Calendar %q has no line %q", lines, want)
+		}
+	}
+}
+
+func TestWriteFoldsLongLines(t *testing.T) {
+	// Multi-byte characters straddle the 75 octet limit at every offset
+	trips := map[int]transit.Trip{}
+	for i := 1; i <= 4; i++ {
+		trips[i] = transit.Trip{
+			TripNumber:        i,
+			StartLocationName: strings.Repeat("x", i) + strings.Repeat("Zürich Straße ", 6),
+			DestinationName:   strings.Repeat("東京駅 ", 10),
+		}
+	}
+	offerings := []transit.TripOffering{}
+	for i := 1; i <= 4; i++ {
+		offerings = append(offerings, offering(t, i, "2026-10-19", "08:00", "09:00", nil))
+	}
+	raw, lines := write(t, offerings, trips)
+	folded := 0
+	for i, l := range strings.Split(strings.TrimSuffix(raw, "\r\n"), "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("Line %d is %d octets: %q", i+1, len(l), l)
+		}
+		if !utf8.ValidString(l) {
+			t.Errorf("Line %d splits a character: %q", i+1, l)
+		}
+		if strings.HasPrefix(l, " ") {
+			folded++
+		}
+	}
+	if folded == 0 {
+		t.Errorf("No lines were folded in %q", raw)
+	}
+	for i := 1; i <= 4; i++ {
+		want := fmt.Sprintf("SUMMARY:Trip %d: %s to %s", i, trips[i].StartLocationName, trips[i].DestinationName)
+		if !hasLine(lines, want) {
+			t.Errorf("Unfolded calendar has no line %q", want)
+		}
+	}
+}
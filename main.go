@@ -3,11 +3,15 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
 
+	"github.com/hlin91/CS4350_Lab4/gtfs"
+	"github.com/hlin91/CS4350_Lab4/ical"
+	"github.com/hlin91/CS4350_Lab4/output"
 	"github.com/hlin91/CS4350_Lab4/transit"
 )
 
@@ -15,175 +19,400 @@ const (
 	ESCAPE_STR = "exit"
 )
 
+// session holds the output settings changed with the set command
+var session = output.Options{Format: output.Text}
+
+// input is shared so that commands reading extra lines see buffered input
+var input = bufio.NewScanner(os.Stdin)
+
 func main() {
-	db, err := transit.GetDatabase()
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
-	log.Printf("Successfully opened database %s\n", transit.DATABASE_PATH)
-	input := bufio.NewScanner(os.Stdin)
+	os.Exit(run(os.Args[1:]))
+}
+
+// interactive reads commands from the prompt until exit or end of input.
+// name is the database of cfg that db was opened as, if any.
+func interactive(db *transit.Database, cfg transit.Config, name string) {
+	current := db
+	var tx *transit.Database // the transaction opened by begin, if any
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+			fmt.Println("Rolled back the open transaction")
+		}
+		if current != db {
+			current.Close()
+		}
+	}()
 	fmt.Print("Enter command: ")
 	for input.Scan() {
 		if input.Text() == ESCAPE_STR {
 			return
 		}
 		args := strings.Fields(input.Text())
-		err := processCommand(db, args[0], args[1:])
-		if err != nil {
-			fmt.Println(err)
+		// Commands run in the open transaction until it is committed or rolled back
+		handle := current
+		if tx != nil {
+			handle = tx
+		}
+		switch {
+		case len(args) == 0:
+		case args[0] == "begin": // Stage the following edits to apply together
+			if len(args) != 1 {
+				fmt.Printf("Wrong number of arguments passed. Expected %d, got %d\n", 0, len(args)-1)
+				break
+			}
+			next, err := handle.StartTx()
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+			tx = next
+			fmt.Println("Started a transaction, commit or rollback to end it")
+		case args[0] == "commit", args[0] == "rollback": // End the transaction opened by begin
+			if len(args) != 1 {
+				fmt.Printf("Wrong number of arguments passed. Expected %d, got %d\n", 0, len(args)-1)
+				break
+			}
+			var err error
+			if args[0] == "commit" {
+				err = handle.Commit()
+			} else {
+				err = handle.Rollback()
+			}
+			if err != nil {
+				fmt.Println(err)
+			} else if args[0] == "commit" {
+				fmt.Println("Committed the transaction")
+			} else {
+				fmt.Println("Rolled back the transaction")
+			}
+			// The transaction is over even if committing it failed
+			tx = nil
+		case args[0] == "undo", args[0] == "redo": // Revert or remake the last edits of the session
+			if len(args) > 2 {
+				fmt.Printf("Wrong number of arguments passed. Expected at most %d, got %d\n", 1, len(args)-1)
+				break
+			}
+			n := 1
+			if len(args) == 2 {
+				var err error
+				if n, err = parseInt(args[1]); err != nil {
+					fmt.Println(err)
+					break
+				}
+			}
+			replay, done := handle.Undo, "Undid"
+			if args[0] == "redo" {
+				replay, done = handle.Redo, "Redid"
+			}
+			edits, err := replay(handle.Operator(), n)
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+			if len(edits) == 0 {
+				fmt.Printf("Nothing to %s\n", args[0])
+			}
+			for _, e := range edits {
+				fmt.Printf("%s: %s\n", done, e.Command)
+			}
+		case args[0] == "databases": // List the databases of the config file
+			for _, n := range cfg.Names() {
+				marker := " "
+				if n == name {
+					marker = "*"
+				}
+				fmt.Printf("%s %s\n", marker, n)
+			}
+		case args[0] == "use": // Switch to a database of the config file
+			if len(args) != 2 {
+				fmt.Printf("Wrong number of arguments passed. Expected %d, got %d\n", 1, len(args)-1)
+				break
+			}
+			if tx != nil {
+				fmt.Println("Commit or roll back the open transaction first")
+				break
+			}
+			opts, err := cfg.Lookup(args[1])
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+			next, err := transit.GetDatabase(opts)
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+			// The operator belongs to the session, not the database
+			next = next.WithOperator(current.Operator())
+			if current != db {
+				current.Close()
+			}
+			current, name = next, args[1]
+			fmt.Printf("Using database %s\n", name)
+		case isEdit(args[0]):
+			// Edits are kept per operator so that undo can revert them, even
+			// after a restart
+			err := handle.RecordEdit(handle.Operator(), strings.Join(args, " "), func(tx *transit.Database) error {
+				return processCommand(tx, args[0], args[1:])
+			})
+			if err != nil {
+				fmt.Println(err)
+			}
+		default:
+			err := processCommand(handle, args[0], args[1:])
+			if err != nil {
+				fmt.Println(err)
+			}
 		}
 		fmt.Print("Enter command: ")
 	}
 }
 
-func processCommand(db *transit.Database, command string, args []string) error {
+func processCommand(store transit.Store, command string, args []string) error {
 	/*
 	 * Supported commands:
-	 * get (schedule/stops/weekly) keys...
-	 * display (trip/offering/bus/driver/stop/actualinfo/stopinfo)
-	 * add (trip/offering/bus/driver/stop/actualinfo/stopinfo) keys...
-	 * addofferings
-	 * delete (offer/bus) keys...
-	 * change (driver/bus) keys...
+	 * get (schedule/stops/weekly/route/timetable) keys... [output flags]
+	 * display (trip/offering/bus/driver/stop/actualinfo/stopinfo/pattern/holiday/exception) [output flags]
+	 * add (trip/offering/bus/driver/stop/actualinfo/stopinfo/pattern/holiday/exception) keys... [--force]
+	 * addofferings [--force]
+	 * generate pattern from to [--dry-run] [--force] [output flags]
+	 * delete (offer/bus/pattern/holiday/exception) keys... [--preview] [output flags]
+	 * delete bus id [replacement] [--preview] [output flags]
+	 * retire (bus/driver) key [date]
+	 * reassign bus id replacement [from] [output flags]
+	 * change (driver/bus) keys... [--force]
+	 * report ontime from to [late] [early]
+	 * report ridership from to
+	 * migrate [version]
+	 * export (gtfs/trip/offering/bus/driver/stop/actualinfo/stopinfo) file
+	 * export ical driver from to file
+	 * import (gtfs/trip/offering/bus/driver/stop/actualinfo/stopinfo) file [--skip-bad-rows]
+	 * dump file
+	 * restore file
+	 * set [(format/columns/sort) value]
+	 * history offering trip date start [output flags]
+	 * history bus id [output flags]
+	 * history edits [output flags]
+	 * databases, use name (at the prompt only)
+	 * begin, commit, rollback (at the prompt only)
+	 * undo [n], redo [n] (at the prompt only)
+	 *
+	 * Output flags, which override the session settings for one command:
+	 * --format=(text/table/json/jsonl/csv) --columns=a,b --sort=a,-b
 	 */
+	// --force lets offerings double-book a driver or bus with a warning
+	args, force := popFlag(args, "--force")
+	args, opts, err := popOutputFlags(args)
+	if err != nil {
+		return err
+	}
+	// Commands beyond the transit.Store interfaces need the SQLite database
+	db, _ := store.(*transit.Database)
+	if db == nil && needsDatabase(command, args) {
+		return fmt.Errorf("%s %s needs a SQLite database\n", command, strings.Join(args, " "))
+	}
+	if force {
+		warn := func(c *transit.ConflictError) {
+			fmt.Printf("Warning: %v\n", c)
+		}
+		switch s := store.(type) {
+		case *transit.Database:
+			db = s.Override(warn)
+			store = db
+		case *transit.MemoryStore:
+			store = s.Override(warn)
+		}
+	}
 	switch command {
 	case "get": // Get a set of information given a set of keys
+		if len(args) == 0 {
+			return fmt.Errorf("Wrong number of arguments passed. Expected at least %d, got %d\n", 1, len(args))
+		}
 		switch args[0] {
 		case "schedule":
 			if len(args) != 4 {
 				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 4, len(args))
 			}
-			trips, offerings, err := db.GetSchedule(args[1], args[2], args[3])
+			date, err := transit.ParseServiceDate(args[3])
 			if err != nil {
 				return err
 			}
+			trips, offerings, err := store.GetSchedule(args[1], args[2], date)
+			if err != nil {
+				return err
+			}
+			// Only the SQLite database keeps holidays and exceptions
+			cal := transit.NewCalendar(nil, nil)
+			if db != nil {
+				if cal, err = db.GetCalendar(); err != nil {
+					return err
+				}
+			}
+			// Explain holidays and exceptions that change the trip's service
+			explain := func(w io.Writer, t transit.Trip) {
+				if runs, note := cal.TripRunsOn(t.TripNumber, date); !runs {
+					fmt.Fprintf(w, "Trip %d does not run on %s: %s\n", t.TripNumber, args[3], note)
+				} else if note != "" {
+					fmt.Fprintf(w, "Trip %d on %s: %s\n", t.TripNumber, args[3], note)
+				}
+			}
+			all := []transit.TripOffering{}
 			for _, t := range trips {
-				fmt.Println("Trip\n---")
-				for _, o := range offerings[t.TripNumber] {
-					fmt.Println(o)
+				if opts.Format != output.Text {
+					explain(os.Stderr, t)
 				}
+				all = append(all, offerings[t.TripNumber]...)
 			}
+			return printRows(opts, all, func() {
+				for _, t := range trips {
+					fmt.Println("Trip\n---")
+					explain(os.Stdout, t)
+					for _, o := range offerings[t.TripNumber] {
+						fmt.Println(o)
+					}
+				}
+			})
 		case "stops":
 			if len(args) != 2 {
 				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 2, len(args))
 			}
-			num, err := strconv.Atoi(args[1])
+			num, err := parseInt(args[1])
 			if err != nil {
 				return err
 			}
-			stops, err := db.GetStops(num)
+			stops, err := store.GetStops(num)
 			if err != nil {
 				return err
 			}
-			for _, stop := range stops {
-				fmt.Println(stop)
-			}
+			return printRows(opts, stops, func() {
+				for _, stop := range stops {
+					fmt.Println(stop)
+				}
+			})
 		case "weekly":
 			if len(args) != 3 {
 				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 3, len(args))
 			}
-			offerings, err := db.GetDriverWeeklySchedule(args[1], args[2])
+			date, err := transit.ParseServiceDate(args[2])
 			if err != nil {
 				return err
 			}
-			for _, o := range offerings {
-				fmt.Println(o)
-			}
-		default:
-			return fmt.Errorf("Unknown command %q\n", args[0])
-		}
-
-	case "display": // Display a row in the table (for debugging)
-		if len(args) != 1 {
-			return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 1, len(args))
-		}
-		switch args[0] {
-		case "trip":
-			table, err := db.GetTripTable()
+			offerings, err := store.GetDriverWeeklySchedule(args[1], date)
 			if err != nil {
 				return err
 			}
-            forPrint := []fmt.Stringer{}
-            for _, t := range table {
-                forPrint = append(forPrint, fmt.Stringer(t))
-            }
-			PrettyPrintTable(forPrint)
-		case "offering":
-			table, err := db.GetTripOfferingTable()
+			return printRows(opts, offerings, func() {
+				for _, o := range offerings {
+					fmt.Println(o)
+				}
+			})
+		case "timetable": // get timetable date [trip]
+			if len(args) != 2 && len(args) != 3 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d or %d, got %d\n", 2, 3, len(args))
+			}
+			date, err := transit.ParseServiceDate(args[1])
 			if err != nil {
 				return err
 			}
-            forPrint := []fmt.Stringer{}
-            for _, t := range table {
-                forPrint = append(forPrint, fmt.Stringer(t))
-            }
-			PrettyPrintTable(forPrint)
-		case "bus":
-			table, err := db.GetBusTable()
+			tripNumber := 0
+			if len(args) == 3 {
+				num, err := parseInt(args[2])
+				if err != nil {
+					return err
+				}
+				tripNumber = num
+			}
+			timetables, err := db.GetTimetables(date, tripNumber)
 			if err != nil {
 				return err
 			}
-			forPrint := []fmt.Stringer{}
-            for _, t := range table {
-                forPrint = append(forPrint, fmt.Stringer(t))
-            }
-			PrettyPrintTable(forPrint)
-		case "driver":
-            table, err := db.GetDriverTable()
-            if err != nil {
-                return err
-            }
-            forPrint := []fmt.Stringer{}
-            for _, t := range table {
-                forPrint = append(forPrint, fmt.Stringer(t))
-            }
-			PrettyPrintTable(forPrint)
-		case "stop":
-			table, err := db.GetStopTable()
+			for _, t := range timetables {
+				fmt.Printf("%v\n\n", t)
+			}
+		case "route": // get route origin destination date earliest [mintransfer]
+			if len(args) != 5 && len(args) != 6 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d or %d, got %d\n", 5, 6, len(args))
+			}
+			date, err := transit.ParseServiceDate(args[3])
 			if err != nil {
 				return err
 			}
-			forPrint := []fmt.Stringer{}
-            for _, t := range table {
-                forPrint = append(forPrint, fmt.Stringer(t))
-            }
-			PrettyPrintTable(forPrint)
-		case "actualinfo":
-			table, err := db.GetActualTripStopInfoTable()
+			earliest, err := transit.ParseTimeOfDay(args[4])
 			if err != nil {
 				return err
 			}
-			forPrint := []fmt.Stringer{}
-            for _, t := range table {
-                forPrint = append(forPrint, fmt.Stringer(t))
-            }
-			PrettyPrintTable(forPrint)
-		case "stopinfo":
-			table, err := db.GetTripStopInfoTable()
+			opts := transit.JourneyOptions{MinTransferTime: transit.DefaultMinTransferTime, MaxTransfers: transit.DefaultMaxTransfers}
+			if len(args) == 6 {
+				minTransfer, err := parseInt(args[5])
+				if err != nil {
+					return err
+				}
+				opts.MinTransferTime = minTransfer
+			}
+			itineraries, err := db.PlanJourney(args[1], args[2], date, earliest, opts)
 			if err != nil {
 				return err
 			}
-			forPrint := []fmt.Stringer{}
-            for _, t := range table {
-                forPrint = append(forPrint, fmt.Stringer(t))
-            }
-			PrettyPrintTable(forPrint)
+			if len(itineraries) == 0 {
+				fmt.Printf("No route from %s to %s on %s after %s\n", args[1], args[2], args[3], args[4])
+			}
+			for i, it := range itineraries {
+				fmt.Printf("Itinerary %d\n---\n%v\n", i+1, it)
+			}
 		default:
 			return fmt.Errorf("Unknown command %q\n", args[0])
 		}
 
+	case "display": // Display a row in the table (for debugging)
+		if len(args) != 1 {
+			return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 1, len(args))
+		}
+		var table interface{}
+		var err error
+		switch args[0] {
+		case "trip":
+			table, err = store.GetTripTable()
+		case "offering":
+			table, err = store.GetTripOfferingTable()
+		case "bus":
+			table, err = store.GetBusTable()
+		case "driver":
+			table, err = store.GetDriverTable()
+		case "stop":
+			table, err = store.GetStopTable()
+		case "actualinfo":
+			table, err = store.GetActualTripStopInfoTable()
+		case "stopinfo":
+			table, err = store.GetTripStopInfoTable()
+		case "pattern":
+			table, err = db.GetServicePatternTable()
+		case "holiday":
+			table, err = db.GetHolidayTable()
+		case "exception":
+			table, err = db.GetServiceExceptionTable()
+		default:
+			return fmt.Errorf("Unknown command %q\n", args[0])
+		}
+		if err != nil {
+			return err
+		}
+		return printRows(opts, table, func() { PrettyPrintTable(stringers(table)) })
+
 	case "add": // Add a row into the databases
+		if len(args) == 0 {
+			return fmt.Errorf("Wrong number of arguments passed. Expected at least %d, got %d\n", 1, len(args))
+		}
 		switch args[0] {
 		case "trip":
 			if len(args) != 4 {
 				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 4, len(args))
 			}
-			num, err := strconv.Atoi(args[1])
+			num, err := parseInt(args[1])
 			if err != nil {
 				return err
 			}
-			err = db.AddTrip(num, args[2], args[3])
+			err = store.AddTrip(num, args[2], args[3])
 			if err != nil {
 				return err
 			}
@@ -191,7 +420,19 @@ func processCommand(db *transit.Database, command string, args []string) error {
 			if len(args) != 7 {
 				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 7, len(args))
 			}
-			err := db.AddOffering(toInt(args[1]), args[2], args[3], args[4], args[5], toInt(args[6]))
+			date, err := transit.ParseServiceDate(args[2])
+			if err != nil {
+				return err
+			}
+			times, err := parseTimes(args[3:5])
+			if err != nil {
+				return err
+			}
+			nums, err := parseInts(args[1], args[6])
+			if err != nil {
+				return err
+			}
+			err = store.AddOffering(nums[0], date, times[0], times[1], args[5], nums[1])
 			if err != nil {
 				return err
 			}
@@ -199,7 +440,11 @@ func processCommand(db *transit.Database, command string, args []string) error {
 			if len(args) != 4 {
 				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 4, len(args))
 			}
-			err := db.AddBus(toInt(args[1]), args[2], toInt(args[3]))
+			nums, err := parseInts(args[1], args[3])
+			if err != nil {
+				return err
+			}
+			err = store.AddBus(nums[0], args[2], nums[1])
 			if err != nil {
 				return err
 			}
@@ -207,7 +452,7 @@ func processCommand(db *transit.Database, command string, args []string) error {
 			if len(args) != 3 {
 				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 3, len(args))
 			}
-			err := db.AddDriver(args[1], args[2])
+			err := store.AddDriver(args[1], args[2])
 			if err != nil {
 				return err
 			}
@@ -215,7 +460,11 @@ func processCommand(db *transit.Database, command string, args []string) error {
 			if len(args) != 3 {
 				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 3, len(args))
 			}
-			err := db.AddStop(toInt(args[1]), args[2])
+			num, err := parseInt(args[1])
+			if err != nil {
+				return err
+			}
+			err = store.AddStop(num, args[2])
 			if err != nil {
 				return err
 			}
@@ -223,7 +472,19 @@ func processCommand(db *transit.Database, command string, args []string) error {
 			if len(args) != 10 {
 				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 10, len(args))
 			}
-			err := db.AddActualTripStopInfo(toInt(args[1]), args[2], args[3], toInt(args[4]), args[5], args[6], args[7], toInt(args[8]), toInt(args[9]))
+			date, err := transit.ParseServiceDate(args[2])
+			if err != nil {
+				return err
+			}
+			times, err := parseTimes(append([]string{args[3]}, args[5:8]...))
+			if err != nil {
+				return err
+			}
+			nums, err := parseInts(args[1], args[4], args[8], args[9])
+			if err != nil {
+				return err
+			}
+			err = store.AddActualTripStopInfo(nums[0], date, times[0], nums[1], times[1], times[2], times[3], nums[2], nums[3])
 			if err != nil {
 				return err
 			}
@@ -231,96 +492,739 @@ func processCommand(db *transit.Database, command string, args []string) error {
 			if len(args) != 5 {
 				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 5, len(args))
 			}
-			drivetime, _ := strconv.ParseFloat(args[4], 32)
+			nums, err := parseInts(args[1:4]...)
+			if err != nil {
+				return err
+			}
+			drivetime, err := strconv.ParseFloat(args[4], 32)
+			if err != nil {
+				return fmt.Errorf("Invalid driving time %q: %w", args[4], transit.ErrInvalid)
+			}
 			float32_drivetime := float32(drivetime)
-			err := db.AddTripStopInfo(toInt(args[1]), toInt(args[2]), toInt(args[3]), float32_drivetime)
+			err = store.AddTripStopInfo(nums[0], nums[1], nums[2], float32_drivetime)
 			if err != nil {
 				return err
 			}
+		case "pattern":
+			if len(args) != 10 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 10, len(args))
+			}
+			times, err := parseTimes(args[4:6])
+			if err != nil {
+				return err
+			}
+			dates, err := parseDates(args[6:8])
+			if err != nil {
+				return err
+			}
+			nums, err := parseInts(args[2], args[9])
+			if err != nil {
+				return err
+			}
+			err = db.AddServicePattern(transit.ServicePattern{
+				PatternName:          args[1],
+				TripNumber:           nums[0],
+				DaysOfWeek:           args[3],
+				ScheduledStartTime:   times[0],
+				ScheduledArrivalTime: times[1],
+				EffectiveFrom:        dates[0],
+				EffectiveTo:          dates[1],
+				DriverName:           args[8],
+				BusID:                nums[1],
+			})
+			if err != nil {
+				return err
+			}
+		case "holiday": // add holiday date name [serviceas]
+			if len(args) != 3 && len(args) != 4 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d or %d, got %d\n", 3, 4, len(args))
+			}
+			date, err := transit.ParseServiceDate(args[1])
+			if err != nil {
+				return err
+			}
+			h := transit.Holiday{Date: date, HolidayName: args[2]}
+			if len(args) == 4 {
+				h.ServiceAs = args[3]
+			}
+			return db.AddHoliday(h)
+		case "exception": // add exception (trip/all) date (added/removed) reason...
+			if len(args) < 4 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected at least %d, got %d\n", 4, len(args))
+			}
+			date, err := transit.ParseServiceDate(args[2])
+			if err != nil {
+				return err
+			}
+			tripNumber, err := tripOrAll(args[1])
+			if err != nil {
+				return err
+			}
+			return db.AddServiceException(transit.ServiceException{
+				TripNumber:    tripNumber,
+				Date:          date,
+				ExceptionType: args[3],
+				Reason:        strings.Join(args[4:], " "),
+			})
+		}
+
+	case "generate": // Expand a service pattern into trip offerings
+		args, dryRun := popFlag(args, "--dry-run")
+		if len(args) != 3 {
+			return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 3, len(args))
+		}
+		dates, err := parseDates(args[1:3])
+		if err != nil {
+			return err
 		}
+		offerings, err := db.GenerateOfferings(args[0], dates[0], dates[1], dryRun)
+		if dryRun {
+			fmt.Fprintf(messages(opts), "Would add %d offerings\n", len(offerings))
+		}
+		if err != nil {
+			return err
+		}
+		return printRows(opts, offerings, func() { PrettyPrintTable(stringers(offerings)) })
 
-	case "addofferings": // Add a set of rows into the database
+	case "addofferings": // Add a set of rows into the database, all or none of them
 		if len(args) != 0 {
 			return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 0, len(args))
 		}
-		input := bufio.NewScanner(os.Stdin)
+		batch := []transit.TripOffering{}
 		for input.Scan() {
 			if input.Text() == ESCAPE_STR {
-				return nil
+				break
 			}
 			args = strings.Fields(input.Text())
 			if len(args) != 6 {
 				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 6, len(args))
 			}
-			tripNumber, err := strconv.Atoi(args[0])
+			tripNumber, err := parseInt(args[0])
 			if err != nil {
 				return err
 			}
-			date := args[1]
-			scheduledStartTime := args[2]
-			scheduledArrivalTime := args[3]
-			driverName := args[4]
-			busID, err := strconv.Atoi(args[5])
+			date, err := transit.ParseServiceDate(args[1])
+			if err != nil {
+				return err
+			}
+			scheduledStartTime, err := transit.ParseTimeOfDay(args[2])
 			if err != nil {
 				return err
 			}
-			err = db.AddOffering(tripNumber, date, scheduledStartTime, scheduledArrivalTime, driverName, busID)
+			scheduledArrivalTime, err := transit.ParseTimeOfDay(args[3])
 			if err != nil {
 				return err
 			}
+			driverName := args[4]
+			busID, err := parseInt(args[5])
+			if err != nil {
+				return err
+			}
+			batch = append(batch, transit.TripOffering{
+				TripNumber:           tripNumber,
+				Date:                 date,
+				ScheduledStartTime:   scheduledStartTime,
+				ScheduledArrivalTime: scheduledArrivalTime,
+				DriverName:           driverName,
+				BusID:                &busID,
+			})
 		}
+		return store.AddOfferings(batch)
 
 	case "delete": // Deletes a trip from the database
+		// --preview lists what the deletion would affect instead of deleting
+		args, preview := popFlag(args, "--preview")
+		if preview && db == nil {
+			return fmt.Errorf("delete --preview needs a SQLite database\n")
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("Wrong number of arguments passed. Expected at least %d, got %d\n", 1, len(args))
+		}
 		switch args[0] {
 		case "offer":
 			if len(args) != 4 {
 				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 4, len(args))
 			}
-			tripNumber, err := strconv.Atoi(args[1])
+			tripNumber, err := parseInt(args[1])
 			if err != nil {
 				return err
 			}
-			db.DeleteOffering(tripNumber, args[2], args[3])
-		case "bus":
+			date, err := transit.ParseServiceDate(args[2])
+			if err != nil {
+				return err
+			}
+			start, err := transit.ParseTimeOfDay(args[3])
+			if err != nil {
+				return err
+			}
+			if preview {
+				dependents, err := db.OfferingDependents(tripNumber, date, start)
+				if err != nil {
+					return err
+				}
+				return printRows(opts, dependents, func() { PrettyPrintTable(stringers(dependents)) })
+			}
+			return store.DeleteOffering(tripNumber, date, start)
+		case "bus": // delete bus id [replacement]
+			if len(args) < 2 || len(args) > 3 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d to %d, got %d\n", 2, 3, len(args))
+			}
+			busID, err := parseInt(args[1])
+			if err != nil {
+				return err
+			}
+			replacement := 0
+			if len(args) == 3 {
+				if replacement, err = parseInt(args[2]); err != nil {
+					return err
+				}
+				if db == nil {
+					return fmt.Errorf("delete bus with a replacement needs a SQLite database\n")
+				}
+			}
+			if preview {
+				dependents, err := db.BusDependents(busID, replacement)
+				if err != nil {
+					return err
+				}
+				return printRows(opts, dependents, func() { PrettyPrintTable(stringers(dependents)) })
+			}
+			if replacement == 0 {
+				return store.DeleteBus(busID)
+			}
+			// The offerings from today on move first, so that only those the
+			// bus has run are left to the delete policy
+			var moved []transit.TripOffering
+			err = db.WithTx(func(tx *transit.Database) error {
+				var err error
+				if moved, err = tx.ReassignBus(busID, replacement, transit.Today()); err != nil {
+					return err
+				}
+				return tx.DeleteBus(busID)
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(messages(opts), "Moved %d offerings to bus %d\n", len(moved), replacement)
+			return nil
+		case "pattern":
+			if len(args) != 2 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 2, len(args))
+			}
+			return db.DeleteServicePattern(args[1])
+		case "holiday":
 			if len(args) != 2 {
 				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 2, len(args))
 			}
-			db.DeleteBus(toInt(args[1]))
+			date, err := transit.ParseServiceDate(args[1])
+			if err != nil {
+				return err
+			}
+			return db.DeleteHoliday(date)
+		case "exception":
+			if len(args) != 3 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 3, len(args))
+			}
+			date, err := transit.ParseServiceDate(args[2])
+			if err != nil {
+				return err
+			}
+			tripNumber, err := tripOrAll(args[1])
+			if err != nil {
+				return err
+			}
+			return db.DeleteServiceException(tripNumber, date)
 		}
 	case "change": // Change the driver or bus for a trip
+		if len(args) == 0 {
+			return fmt.Errorf("Wrong number of arguments passed. Expected at least %d, got %d\n", 1, len(args))
+		}
 		switch args[0] {
 		case "driver":
 			if len(args) != 5 {
 				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 5, len(args))
 			}
-			tripNumber, err := strconv.Atoi(args[2])
+			tripNumber, err := parseInt(args[2])
+			if err != nil {
+				return err
+			}
+			date, err := transit.ParseServiceDate(args[3])
 			if err != nil {
 				return err
 			}
-			return db.ChangeDriver(args[1], tripNumber, args[3], args[4])
+			start, err := transit.ParseTimeOfDay(args[4])
+			if err != nil {
+				return err
+			}
+			return store.ChangeDriver(args[1], tripNumber, date, start)
 		case "bus":
 			if len(args) != 5 {
 				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 5, len(args))
 			}
-			busID, err := strconv.Atoi(args[2])
+			busID, err := parseInt(args[1])
+			if err != nil {
+				return err
+			}
+			tripNumber, err := parseInt(args[2])
+			if err != nil {
+				return err
+			}
+			date, err := transit.ParseServiceDate(args[3])
+			if err != nil {
+				return err
+			}
+			start, err := transit.ParseTimeOfDay(args[4])
+			if err != nil {
+				return err
+			}
+			return store.ChangeBus(busID, tripNumber, date, start)
+		}
+	case "retire": // Take a bus or driver out of service from a date, today by default
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("Wrong number of arguments passed. Expected %d to %d, got %d\n", 2, 3, len(args))
+		}
+		on := transit.Today()
+		if len(args) == 3 {
+			var err error
+			if on, err = transit.ParseServiceDate(args[2]); err != nil {
+				return err
+			}
+		}
+		switch args[0] {
+		case "bus": // retire bus id [date]
+			busID, err := parseInt(args[1])
+			if err != nil {
+				return err
+			}
+			return db.RetireBus(busID, on)
+		case "driver": // retire driver name [date]
+			return db.RetireDriver(args[1], on)
+		}
+	case "reassign": // Move the offerings of a bus from a date, today by default, to another bus
+		if len(args) < 3 || len(args) > 4 {
+			return fmt.Errorf("Wrong number of arguments passed. Expected %d to %d, got %d\n", 3, 4, len(args))
+		}
+		switch args[0] {
+		case "bus": // reassign bus id replacement [from]
+			busID, err := parseInt(args[1])
+			if err != nil {
+				return err
+			}
+			replacement, err := parseInt(args[2])
+			if err != nil {
+				return err
+			}
+			from := transit.Today()
+			if len(args) == 4 {
+				if from, err = transit.ParseServiceDate(args[3]); err != nil {
+					return err
+				}
+			}
+			moved, err := db.ReassignBus(busID, replacement, from)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(messages(opts), "Moved %d offerings to bus %d\n", len(moved), replacement)
+			return printRows(opts, moved, func() { PrettyPrintTable(stringers(moved)) })
+		}
+	case "report": // Summarise recorded operations over a date range
+		if len(args) == 0 {
+			return fmt.Errorf("Wrong number of arguments passed. Expected at least %d, got %d\n", 1, len(args))
+		}
+		switch args[0] {
+		case "ontime": // report ontime from to [late] [early]
+			if len(args) < 3 || len(args) > 5 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d to %d, got %d\n", 3, 5, len(args))
+			}
+			dates, err := parseDates(args[1:3])
+			if err != nil {
+				return err
+			}
+			opts := transit.OnTimeOptions{From: dates[0], To: dates[1], LateThreshold: transit.DefaultLateThreshold, EarlyThreshold: transit.DefaultEarlyThreshold}
+			if len(args) > 3 {
+				late, err := parseInt(args[3])
+				if err != nil {
+					return err
+				}
+				opts.LateThreshold = late
+			}
+			if len(args) > 4 {
+				early, err := parseInt(args[4])
+				if err != nil {
+					return err
+				}
+				opts.EarlyThreshold = early
+			}
+			report, err := db.OnTimeReport(opts)
+			if err != nil {
+				return err
+			}
+			fmt.Print(report)
+		case "ridership": // report ridership from to
+			if len(args) != 3 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 3, len(args))
+			}
+			dates, err := parseDates(args[1:3])
+			if err != nil {
+				return err
+			}
+			report, err := db.RidershipReport(dates[0], dates[1])
+			if err != nil {
+				return err
+			}
+			fmt.Print(report)
+		default:
+			return fmt.Errorf("Unknown command %q\n", args[0])
+		}
+	case "history": // Show the changes recorded in the audit log
+		if len(args) == 0 {
+			return fmt.Errorf("Wrong number of arguments passed. Expected at least %d, got %d\n", 1, len(args))
+		}
+		var records []transit.AuditRecord
+		switch args[0] {
+		case "offering": // history offering trip date start
+			if len(args) != 4 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 4, len(args))
+			}
+			tripNumber, err := parseInt(args[1])
+			if err != nil {
+				return err
+			}
+			date, err := transit.ParseServiceDate(args[2])
+			if err != nil {
+				return err
+			}
+			start, err := transit.ParseTimeOfDay(args[3])
+			if err != nil {
+				return err
+			}
+			if records, err = db.OfferingHistory(tripNumber, date, start); err != nil {
+				return err
+			}
+		case "bus": // history bus id
+			if len(args) != 2 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 2, len(args))
+			}
+			busID, err := parseInt(args[1])
+			if err != nil {
+				return err
+			}
+			if records, err = db.BusHistory(busID); err != nil {
+				return err
+			}
+		case "edits": // history edits
+			if len(args) != 1 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 1, len(args))
+			}
+			edits, err := db.Edits(db.Operator())
+			if err != nil {
+				return err
+			}
+			return printRows(opts, edits, func() { PrettyPrintTable(stringers(edits)) })
+		default:
+			return fmt.Errorf("Unknown command %q\n", args[0])
+		}
+		return printRows(opts, records, func() { PrettyPrintTable(stringers(records)) })
+	case "set": // Change the output settings of the session
+		if len(args) == 0 {
+			fmt.Printf("format %s\ncolumns %s\nsort %s\n", session.Format, listOrAll(session.Columns), listOrAll(session.Sort))
+			return nil
+		}
+		if len(args) != 2 {
+			return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 2, len(args))
+		}
+		switch args[0] {
+		case "format":
+			format, err := output.ParseFormat(args[1])
+			if err != nil {
+				return err
+			}
+			session.Format = format
+		case "columns":
+			session.Columns = output.ParseList(args[1])
+		case "sort":
+			session.Sort = output.ParseList(args[1])
+		default:
+			return fmt.Errorf("Unknown setting %q\n", args[0])
+		}
+	case "migrate": // Move the schema to the given version, or the latest one
+		if len(args) > 1 {
+			return fmt.Errorf("Wrong number of arguments passed. Expected at most %d, got %d\n", 1, len(args))
+		}
+		version := transit.LatestSchemaVersion()
+		if len(args) == 1 {
+			v, err := parseInt(args[0])
+			if err != nil {
+				return err
+			}
+			version = v
+		}
+		if err := db.MigrateTo(version); err != nil {
+			return err
+		}
+		current, err := db.SchemaVersion()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Schema is at version %d\n", current)
+	case "import": // Load rows from a file in another format
+		args, skipBadRows := popFlag(args, "--skip-bad-rows")
+		if len(args) == 0 {
+			return fmt.Errorf("Wrong number of arguments passed. Expected at least %d, got %d\n", 1, len(args))
+		}
+		switch args[0] {
+		case "gtfs": // import gtfs file
+			if len(args) != 2 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 2, len(args))
+			}
+			report, err := gtfs.ImportFile(db, args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Print(report)
+		default: // import table file.csv
+			if len(args) != 2 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 2, len(args))
+			}
+			f, err := os.Open(args[1])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			mode := transit.CSVAllOrNothing
+			if skipBadRows {
+				mode = transit.CSVSkipBadRows
+			}
+			result, err := db.ImportCSV(args[0], f, mode)
+			for _, rowErr := range result.Errors {
+				fmt.Println(rowErr)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Imported %d rows, skipped %d\n", result.Imported, len(result.Errors))
+		}
+	case "export": // Write the database out in another format
+		if len(args) == 0 {
+			return fmt.Errorf("Wrong number of arguments passed. Expected at least %d, got %d\n", 1, len(args))
+		}
+		switch args[0] {
+		case "gtfs": // export gtfs file
+			if len(args) != 2 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 2, len(args))
+			}
+			if err := gtfs.ExportFile(db, args[1], gtfs.Options{}); err != nil {
+				return err
+			}
+			fmt.Printf("Wrote GTFS feed to %s\n", args[1])
+		case "ical": // export ical driver from to file
+			if len(args) != 5 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 5, len(args))
+			}
+			dates, err := parseDates(args[2:4])
 			if err != nil {
 				return err
 			}
-			tripNumber, err := strconv.Atoi(args[2])
+			if err := ical.ExportDriverFile(store, args[4], args[1], dates[0], dates[1]); err != nil {
+				return err
+			}
+			fmt.Printf("Wrote schedule for %s to %s\n", args[1], args[4])
+		default: // export table file.csv
+			if len(args) != 2 {
+				return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 2, len(args))
+			}
+			f, err := os.Create(args[1])
 			if err != nil {
 				return err
 			}
-			return db.ChangeBus(busID, tripNumber, args[3], args[4])
+			if err := db.ExportCSV(args[0], f); err != nil {
+				f.Close()
+				os.Remove(args[1])
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			fmt.Printf("Wrote %s table to %s\n", args[0], args[1])
 		}
+	case "dump": // Snapshot every table as JSON, or YAML for .yaml files
+		if len(args) != 1 {
+			return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 1, len(args))
+		}
+		f, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		if err := db.DumpTo(f, transit.SnapshotFormat(args[0])); err != nil {
+			f.Close()
+			os.Remove(args[0])
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote snapshot to %s\n", args[0])
+	case "restore": // Load a snapshot written by dump into an empty database
+		if len(args) != 1 {
+			return fmt.Errorf("Wrong number of arguments passed. Expected %d, got %d\n", 1, len(args))
+		}
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := db.RestoreFrom(f, transit.SnapshotFormat(args[0])); err != nil {
+			return err
+		}
+		fmt.Printf("Restored snapshot from %s\n", args[0])
 	default:
-		fmt.Errorf("Unknown command %q\n", command)
+		return fmt.Errorf("Unknown command %q\n", command)
 	}
 	return nil
 }
 
-func toInt(s string) int {
-	i, _ := strconv.Atoi(s)
-	return i
+// isEdit reports whether a command changes the database, and so is kept
+// for undo when made at the prompt
+func isEdit(command string) bool {
+	switch command {
+	case "add", "addofferings", "generate", "delete", "change", "retire", "reassign":
+		return true
+	}
+	return false
+}
+
+// needsDatabase reports whether a command uses tables or features of the
+// SQLite database that the transit.Store interfaces do not cover
+func needsDatabase(command string, args []string) bool {
+	switch command {
+	case "generate", "report", "migrate", "import", "dump", "restore", "history", "retire", "reassign":
+		return true
+	case "export":
+		return len(args) == 0 || args[0] != "ical"
+	case "get":
+		return len(args) > 0 && (args[0] == "timetable" || args[0] == "route")
+	case "display", "add", "delete":
+		return len(args) > 0 && (args[0] == "pattern" || args[0] == "holiday" || args[0] == "exception")
+	}
+	return false
+}
+
+// parseInt parses a whole number argument
+func parseInt(s string) (int, error) {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid number %q: %w", s, transit.ErrInvalid)
+	}
+	return i, nil
+}
+
+// parseInts parses each argument as a whole number
+func parseInts(args ...string) ([]int, error) {
+	nums := []int{}
+	for _, a := range args {
+		i, err := parseInt(a)
+		if err != nil {
+			return nil, err
+		}
+		nums = append(nums, i)
+	}
+	return nums, nil
+}
+
+// tripOrAll converts a trip number argument, where "all" means every trip (0)
+func tripOrAll(s string) (int, error) {
+	if s == "all" {
+		return 0, nil
+	}
+	return parseInt(s)
+}
+
+// parseDates parses each argument as a YYYY-MM-DD date
+func parseDates(args []string) ([]transit.ServiceDate, error) {
+	dates := []transit.ServiceDate{}
+	for _, a := range args {
+		d, err := transit.ParseServiceDate(a)
+		if err != nil {
+			return nil, err
+		}
+		dates = append(dates, d)
+	}
+	return dates, nil
+}
+
+// parseTimes parses each argument as an HH:MM time of day
+func parseTimes(args []string) ([]transit.TimeOfDay, error) {
+	times := []transit.TimeOfDay{}
+	for _, a := range args {
+		t, err := transit.ParseTimeOfDay(a)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+	return times, nil
+}
+
+// popOutputFlags removes the output flags from args and returns the session
+// settings with the flags applied
+func popOutputFlags(args []string) ([]string, output.Options, error) {
+	opts := session
+	args, format, ok := popValue(args, "--format")
+	if ok {
+		f, err := output.ParseFormat(format)
+		if err != nil {
+			return args, opts, err
+		}
+		opts.Format = f
+	}
+	args, columns, ok := popValue(args, "--columns")
+	if ok {
+		opts.Columns = output.ParseList(columns)
+	}
+	args, sortBy, ok := popValue(args, "--sort")
+	if ok {
+		opts.Sort = output.ParseList(sortBy)
+	}
+	return args, opts, nil
+}
+
+// printRows writes rows, a slice of table rows, in the chosen format. The
+// text format sorts the rows and then calls text to print them.
+func printRows(opts output.Options, rows interface{}, text func()) error {
+	if opts.Format == output.Text {
+		if err := output.Sort(rows, opts.Sort); err != nil {
+			return err
+		}
+		text()
+		return nil
+	}
+	return output.Write(os.Stdout, rows, opts)
+}
+
+// messages returns where to print notes about a result, which is standard
+// error when the result itself is meant for another program
+func messages(opts output.Options) io.Writer {
+	if opts.Format == output.Text {
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+// stringers converts a slice of rows for PrettyPrintTable
+func stringers(rows interface{}) []fmt.Stringer {
+	v := reflect.ValueOf(rows)
+	forPrint := []fmt.Stringer{}
+	for i := 0; i < v.Len(); i++ {
+		forPrint = append(forPrint, v.Index(i).Interface().(fmt.Stringer))
+	}
+	return forPrint
+}
+
+func listOrAll(list []string) string {
+	if len(list) == 0 {
+		return "all"
+	}
+	return strings.Join(list, ",")
 }
 
 // PrettyPrintTable pretty prints a table
@@ -330,4 +1234,38 @@ func PrettyPrintTable(table []fmt.Stringer) {
         fmt.Println(el)
     }
     fmt.Println("=====================================================")
-}
\ No newline at end of file
+}
+// popValue removes every occurrence of flag, written as "flag value" or
+// "flag=value", from args and returns the last value given
+func popValue(args []string, flag string) ([]string, string, bool) {
+	rest := []string{}
+	value := ""
+	found := false
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case strings.HasPrefix(a, flag+"="):
+			value, found = strings.TrimPrefix(a, flag+"="), true
+		case a == flag && i+1 < len(args):
+			value, found = args[i+1], true
+			i++
+		default:
+			rest = append(rest, a)
+		}
+	}
+	return rest, value, found
+}
+
+// popFlag removes every occurrence of flag from args and reports whether it was present
+func popFlag(args []string, flag string) ([]string, bool) {
+	rest := []string{}
+	found := false
+	for _, a := range args {
+		if a == flag {
+			found = true
+			continue
+		}
+		rest = append(rest, a)
+	}
+	return rest, found
+}
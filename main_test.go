@@ -0,0 +1,48 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+func TestNumericArguments(t *testing.T) {
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"add", "bus", "abc", "Gillig", "2015"}, exitInvalid},
+		{[]string{"add", "bus", "1", "Gillig", "zz"}, exitInvalid},
+		{[]string{"add", "bus", "1", "Gillig", "2015"}, exitOK},
+		{[]string{"add", "offering", "x", "2026-10-19", "10:00", "11:00", "Nick", "1"}, exitInvalid},
+		{[]string{"add", "offering", "1", "2026-10-19", "10:00", "11:00", "Nick", "one"}, exitInvalid},
+		{[]string{"add", "stop", "first", "1 Main St"}, exitInvalid},
+		{[]string{"add", "stopinfo", "1", "1", "1", "fast"}, exitInvalid},
+		{[]string{"add", "actualinfo", "1", "2026-10-19", "10:00", "1", "10:00", "10:01", "10:01", "some", "0"}, exitInvalid},
+		{[]string{"add", "exception", "x", "2026-10-19", "removed", "Strike"}, exitInvalid},
+		{[]string{"delete", "offering", "x", "2026-10-19", "10:00"}, exitInvalid},
+		{[]string{"delete", "bus", "abc"}, exitInvalid},
+		{[]string{"delete", "bus", "1", "two"}, exitInvalid},
+		{[]string{"retire", "bus", "abc", "2026-10-19"}, exitInvalid},
+	}
+	db := filepath.Join(t.TempDir(), "lab4.db")
+	for _, tt := range tests {
+		if got := run(append([]string{"-db", db}, tt.args...)); got != tt.code {
+			t.Errorf("%v: exit code %d, want %d", tt.args, got, tt.code)
+		}
+	}
+}
+
+func TestMissingSubcommand(t *testing.T) {
+	db, err := transit.GetDatabase(transit.Options{InMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, args := range [][]string{{"get"}, {"add"}, {"delete"}, {"delete", "--preview"}, {"change"}} {
+		if err := processCommand(db, args[0], args[1:]); err == nil {
+			t.Errorf("%v with no subcommand succeeded", args)
+		}
+	}
+}
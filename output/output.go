@@ -0,0 +1,292 @@
+// Package output renders slices of rows as text tables, JSON, JSON lines or
+// CSV for other tools to read
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+// Formats rows can be written in. Text is each row's own String form,
+// which this package leaves to the caller.
+const (
+	Text      = "text"
+	Table     = "table"
+	JSON      = "json"
+	JSONLines = "jsonl"
+	CSV       = "csv"
+)
+
+// Formats lists every format in the order they are documented
+var Formats = []string{Text, Table, JSON, JSONLines, CSV}
+
+// Options selects how rows are written
+type Options struct {
+	Format  string
+	Columns []string // field names to write, in order; every field if empty
+	Sort    []string // field names to sort by, each prefixed with - for descending
+}
+
+// ParseFormat checks that s names a format
+func ParseFormat(s string) (string, error) {
+	f := strings.ToLower(s)
+	for _, known := range Formats {
+		if f == known {
+			return f, nil
+		}
+	}
+	return "", invalidf("Unknown output format %q, expected one of %s", s, strings.Join(Formats, ", "))
+}
+
+// ParseList splits a comma separated list of column names. "all" and the
+// empty string give an empty list.
+func ParseList(s string) []string {
+	if s == "" || s == "all" {
+		return nil
+	}
+	list := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Sort sorts rows, a slice of structs, in place by the given keys
+func Sort(rows interface{}, keys []string) error {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("Cannot sort %T", rows)
+	}
+	type key struct {
+		field      int
+		descending bool
+	}
+	fields := []key{}
+	for _, k := range keys {
+		descending := strings.HasPrefix(k, "-")
+		i, err := fieldIndex(v.Type().Elem(), strings.TrimPrefix(k, "-"))
+		if err != nil {
+			return err
+		}
+		fields = append(fields, key{i, descending})
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, k := range fields {
+			c := compare(v.Index(i).Field(k.field), v.Index(j).Field(k.field))
+			if c == 0 {
+				continue
+			}
+			if k.descending {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return nil
+}
+
+// Write sorts rows, a slice of structs, and writes the selected columns in
+// the table, JSON, JSON lines or CSV format
+func Write(w io.Writer, rows interface{}, opts Options) error {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Cannot write %T as rows", rows)
+	}
+	if err := Sort(rows, opts.Sort); err != nil {
+		return err
+	}
+	names, fields, err := columns(v.Type().Elem(), opts.Columns)
+	if err != nil {
+		return err
+	}
+	switch opts.Format {
+	case Table:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(names, "\t"))
+		for i := 0; i < v.Len(); i++ {
+			fmt.Fprintln(tw, strings.Join(texts(v.Index(i), fields), "\t"))
+		}
+		return tw.Flush()
+	case JSON:
+		objects := make([]object, v.Len())
+		for i := range objects {
+			objects[i] = object{names, values(v.Index(i), fields)}
+		}
+		data, err := json.MarshalIndent(objects, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case JSONLines:
+		enc := json.NewEncoder(w)
+		for i := 0; i < v.Len(); i++ {
+			if err := enc.Encode(object{names, values(v.Index(i), fields)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	case CSV:
+		cw := csv.NewWriter(w)
+		cw.Write(names)
+		for i := 0; i < v.Len(); i++ {
+			cw.Write(texts(v.Index(i), fields))
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return invalidf("Cannot write rows as %q", opts.Format)
+}
+
+// object is a JSON object whose keys keep the order of the columns
+type object struct {
+	keys   []string
+	values []interface{}
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// columns returns the names and field indexes of the selected columns
+func columns(t reflect.Type, selected []string) ([]string, []int, error) {
+	names, fields := []string{}, []int{}
+	if len(selected) == 0 {
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath == "" {
+				names = append(names, t.Field(i).Name)
+				fields = append(fields, i)
+			}
+		}
+		return names, fields, nil
+	}
+	for _, name := range selected {
+		i, err := fieldIndex(t, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		names = append(names, t.Field(i).Name)
+		fields = append(fields, i)
+	}
+	return names, fields, nil
+}
+
+// fieldIndex finds the exported field of t called name, ignoring case
+func fieldIndex(t reflect.Type, name string) (int, error) {
+	available := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		if strings.EqualFold(f.Name, name) {
+			return i, nil
+		}
+		available = append(available, f.Name)
+	}
+	return 0, invalidf("Unknown column %q, expected one of %s", name, strings.Join(available, ", "))
+}
+
+func values(row reflect.Value, fields []int) []interface{} {
+	result := make([]interface{}, len(fields))
+	for i, f := range fields {
+		result[i] = row.Field(f).Interface()
+	}
+	return result
+}
+
+func texts(row reflect.Value, fields []int) []string {
+	result := make([]string, len(fields))
+	for i, f := range fields {
+		result[i] = text(row.Field(f))
+	}
+	return result
+}
+
+// text formats a field, leaving it empty for a nil pointer such as an
+// offering without a bus
+func text(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// compare orders numbers by value and anything else by its text, which
+// sorts dates and times of day correctly. Nil pointers sort first.
+func compare(a, b reflect.Value) int {
+	if a.Kind() == reflect.Ptr {
+		if a.IsNil() || b.IsNil() {
+			return boolInt(!a.IsNil()) - boolInt(!b.IsNil())
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return sign(float64(a.Int()) - float64(b.Int()))
+	case reflect.Float32, reflect.Float64:
+		return sign(a.Float() - b.Float())
+	case reflect.Bool:
+		return sign(float64(boolInt(a.Bool()) - boolInt(b.Bool())))
+	}
+	return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+}
+
+func sign(d float64) int {
+	switch {
+	case d < 0:
+		return -1
+	case d > 0:
+		return 1
+	}
+	return 0
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// invalidf formats a validation error that matches transit.ErrInvalid
+func invalidf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), transit.ErrInvalid)
+}
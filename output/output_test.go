@@ -0,0 +1,163 @@
+package output_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/output"
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+// offerings returns offerings of three trips, one of them without a bus
+func offerings(t *testing.T) []transit.TripOffering {
+	t.Helper()
+	rows := []transit.TripOffering{}
+	for _, o := range []struct {
+		trip        int
+		date, start string
+		driver      string
+		bus         *int
+	}{
+		{2, "2026-10-20", "08:00", "Bob", transit.BusRef(7)},
+		{10, "2026-10-19", "09:30", "Ann, Jr.", nil},
+		{1, "2026-10-19", "25:10", "Ann", transit.BusRef(0)},
+	} {
+		date, err := transit.ParseServiceDate(o.date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start, err := transit.ParseTimeOfDay(o.start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, transit.TripOffering{TripNumber: o.trip, Date: date, ScheduledStartTime: start, DriverName: o.driver, BusID: o.bus})
+	}
+	return rows
+}
+
+func TestWriteFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{output.Table, "" +
+			"TripNumber  DriverName  BusID\n" +
+			"1           Ann         0\n" +
+			"2           Bob         7\n" +
+			"10          Ann, Jr.    \n"},
+		{output.CSV, "" +
+			"TripNumber,DriverName,BusID\n" +
+			"1,Ann,0\n" +
+			"2,Bob,7\n" +
+			"10,\"Ann, Jr.\",\n"},
+		{output.JSONLines, "" +
+			`{"TripNumber":1,"DriverName":"Ann","BusID":0}` + "\n" +
+			`{"TripNumber":2,"DriverName":"Bob","BusID":7}` + "\n" +
+			`{"TripNumber":10,"DriverName":"Ann, Jr.","BusID":null}` + "\n"},
+		{output.JSON, `[
+  {
+    "TripNumber": 1,
+    "DriverName": "Ann",
+    "BusID": 0
+  },
+  {
+    "TripNumber": 2,
+    "DriverName": "Bob",
+    "BusID": 7
+  },
+  {
+    "TripNumber": 10,
+    "DriverName": "Ann, Jr.",
+    "BusID": null
+  }
+]
+`},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		opts := output.Options{Format: tt.format, Columns: []string{"tripnumber", "DriverName", "BusID"}, Sort: []string{"TripNumber"}}
+		if err := output.Write(&buf, offerings(t), opts); err != nil {
+			t.Errorf("%s: %v", tt.format, err)
+			continue
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%s output\n%s\nwant\n%s", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestWriteDatesAndTimes(t *testing.T) {
+	var buf bytes.Buffer
+	opts := output.Options{Format: output.CSV, Columns: []string{"Date", "ScheduledStartTime"}, Sort: []string{"Date", "-ScheduledStartTime"}}
+	if err := output.Write(&buf, offerings(t), opts); err != nil {
+		t.Fatal(err)
+	}
+	want := "Date,ScheduledStartTime\n2026-10-19,25:10\n2026-10-19,09:30\n2026-10-20,08:00\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Output\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSort(t *testing.T) {
+	tests := []struct {
+		keys []string
+		want []int // trip numbers in order
+	}{
+		{nil, []int{2, 10, 1}},
+		{[]string{"TripNumber"}, []int{1, 2, 10}},
+		{[]string{"-TripNumber"}, []int{10, 2, 1}},
+		{[]string{"BusID"}, []int{10, 1, 2}},
+		{[]string{"-busid"}, []int{2, 1, 10}},
+		{[]string{"Date", "DriverName"}, []int{1, 10, 2}},
+	}
+	for _, tt := range tests {
+		rows := offerings(t)
+		if err := output.Sort(rows, tt.keys); err != nil {
+			t.Errorf("Sort by %v: %v", tt.keys, err)
+			continue
+		}
+		for i, o := range rows {
+			if o.TripNumber != tt.want[i] {
+				t.Errorf("Sort by %v gave trip %d at %d, want %v", tt.keys, o.TripNumber, i, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestWriteRejectsUnknownNames(t *testing.T) {
+	var buf bytes.Buffer
+	for _, opts := range []output.Options{
+		{Format: output.CSV, Columns: []string{"Depot"}},
+		{Format: output.CSV, Sort: []string{"-Depot"}},
+		{Format: "xml"},
+	} {
+		if err := output.Write(&buf, offerings(t), opts); !errors.Is(err, transit.ErrInvalid) {
+			t.Errorf("Write with %+v returned %v, want an invalid input error", opts, err)
+		}
+	}
+	if _, err := output.ParseFormat("XML"); !errors.Is(err, transit.ErrInvalid) {
+		t.Errorf("ParseFormat(XML) returned %v, want an invalid input error", err)
+	}
+	if f, err := output.ParseFormat("JSONL"); f != output.JSONLines || err != nil {
+		t.Errorf("ParseFormat(JSONL) = %q, %v, want %q", f, err, output.JSONLines)
+	}
+}
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"all", 0},
+		{"TripNumber", 1},
+		{" TripNumber , Date,, ", 2},
+	}
+	for _, tt := range tests {
+		if got := output.ParseList(tt.in); len(got) != tt.want {
+			t.Errorf("ParseList(%q) = %q, want %d names", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,641 @@
+// Package server exposes the transit database as an HTTP JSON API
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+// Server routes HTTP requests to a transit database.
+//
+// Routes:
+//
+//	GET  /trips                              POST /trips
+//	GET, PUT, DELETE /trips/{trip}           GET  /trips/{trip}/stops
+//	GET  /offerings?trip=&date=              POST /offerings[?force=true]
+//	GET, PATCH, DELETE /offerings/{trip}/{date}/{start}
+//	GET  /buses                              POST /buses
+//	GET, DELETE /buses/{id}
+//	GET  /drivers                            POST /drivers
+//	GET, PUT, DELETE /drivers/{name}         GET  /drivers/{name}/weekly?date=
+//	GET  /stops                              POST /stops
+//	GET, PUT, DELETE /stops/{stop}
+//	GET  /stopinfos?trip=                    POST /stopinfos
+//	GET, PUT, DELETE /stopinfos/{trip}/{stop}
+//	GET  /actualinfos                        POST /actualinfos
+//	GET, PUT, DELETE /actualinfos/{trip}/{date}/{start}/{stop}
+//	GET  /schedule?from=&to=&date=
+//
+// A PUT body is the whole row. Its key may be left out, and is otherwise
+// refused if it is not the key in the path.
+//
+// Changes are recorded in the audit log as made by the server's own
+// operator, or, if the server is told to trust it, by the operator named in
+// the OperatorHeader of the request.
+type Server struct {
+	db   *transit.Database
+	opts Options
+}
+
+// OperatorHeader names who is making a request's changes
+const OperatorHeader = "X-Operator"
+
+// Options configures a server
+type Options struct {
+	// TrustOperatorHeader records changes under the OperatorHeader of the
+	// request. Any client can send it, so it should only be trusted behind a
+	// proxy that sets it for authenticated users.
+	TrustOperatorHeader bool
+}
+
+// New returns a server for the given database
+func New(db *transit.Database, opts Options) *Server {
+	return &Server{db: db, opts: opts}
+}
+
+// httpError carries the status code to send for a request error
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &httpError{http.StatusBadRequest, fmt.Errorf(format, args...)}
+}
+
+func notFound(format string, args ...interface{}) error {
+	return &httpError{http.StatusNotFound, fmt.Errorf(format, args...)}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Changes are recorded in the audit log under the caller's name if given
+	// and trusted
+	if operator := r.Header.Get(OperatorHeader); operator != "" && s.opts.TrustOperatorHeader {
+		s = &Server{db: s.db.WithOperator(operator), opts: s.opts}
+	}
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var err error
+	switch path[0] {
+	case "trips":
+		err = s.trips(w, r, path[1:])
+	case "offerings":
+		err = s.offerings(w, r, path[1:])
+	case "buses":
+		err = s.buses(w, r, path[1:])
+	case "drivers":
+		err = s.drivers(w, r, path[1:])
+	case "stops":
+		err = s.stops(w, r, path[1:])
+	case "stopinfos":
+		err = s.stopInfos(w, r, path[1:])
+	case "actualinfos":
+		err = s.actualInfos(w, r, path[1:])
+	case "schedule":
+		err = s.schedule(w, r, path[1:])
+	default:
+		err = notFound("Unknown resource %q", path[0])
+	}
+	if err != nil {
+		writeError(w, err)
+	}
+}
+
+func (s *Server) trips(w http.ResponseWriter, r *http.Request, path []string) error {
+	switch {
+	case len(path) == 0 && r.Method == http.MethodGet:
+		table, err := s.db.GetTripTable()
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, table)
+	case len(path) == 0 && r.Method == http.MethodPost:
+		var t transit.Trip
+		if err := readJSON(r, &t); err != nil {
+			return err
+		}
+		if err := s.db.AddTrip(t.TripNumber, t.StartLocationName, t.DestinationName); err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusCreated, t)
+	case len(path) == 1:
+		num, err := intParam(path[0])
+		if err != nil {
+			return err
+		}
+		switch r.Method {
+		case http.MethodGet:
+			t, err := s.db.GetTrip(num)
+			if err != nil {
+				return err
+			}
+			return writeJSON(w, http.StatusOK, t)
+		case http.MethodPut:
+			t := transit.Trip{TripNumber: num}
+			if err := readJSON(r, &t); err != nil {
+				return err
+			}
+			if t.TripNumber != num {
+				return keyMismatch(r)
+			}
+			if err := s.db.UpdateTrip(t.TripNumber, t.StartLocationName, t.DestinationName); err != nil {
+				return err
+			}
+			return writeJSON(w, http.StatusOK, t)
+		case http.MethodDelete:
+			if err := s.db.DeleteTrip(num); err != nil {
+				return err
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+	case len(path) == 2 && path[1] == "stops" && r.Method == http.MethodGet:
+		num, err := intParam(path[0])
+		if err != nil {
+			return err
+		}
+		stops, err := s.db.GetStops(num)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, stops)
+	}
+	return methodNotAllowed(r)
+}
+
+// offeringChange is the body of PATCH /offerings/{trip}/{date}/{start}
+type offeringChange struct {
+	DriverName *string
+	BusID      *int
+}
+
+func (s *Server) offerings(w http.ResponseWriter, r *http.Request, path []string) error {
+	db := s.db
+	warnings := []string{}
+	if r.URL.Query().Get("force") == "true" {
+		db = db.Override(func(c *transit.ConflictError) {
+			warnings = append(warnings, c.Error())
+		})
+	}
+	switch {
+	case len(path) == 0 && r.Method == http.MethodGet:
+		table, err := db.GetTripOfferingTable()
+		if err != nil {
+			return err
+		}
+		trip, date := r.URL.Query().Get("trip"), r.URL.Query().Get("date")
+		result := []transit.TripOffering{}
+		for _, o := range table {
+			if trip != "" && strconv.Itoa(o.TripNumber) != trip {
+				continue
+			}
+			if date != "" && !strings.HasPrefix(o.Date.String(), date) {
+				continue
+			}
+			result = append(result, o)
+		}
+		return writeJSON(w, http.StatusOK, result)
+	case len(path) == 0 && r.Method == http.MethodPost:
+		var o transit.TripOffering
+		if err := readJSON(r, &o); err != nil {
+			return err
+		}
+		if o.BusID == nil {
+			return badRequest("Missing BusID")
+		}
+		if err := db.AddOffering(o.TripNumber, o.Date, o.ScheduledStartTime, o.ScheduledArrivalTime, o.DriverName, *o.BusID); err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusCreated, struct {
+			Offering transit.TripOffering
+			Warnings []string
+		}{o, warnings})
+	case len(path) == 3:
+		num, err := intParam(path[0])
+		if err != nil {
+			return err
+		}
+		date, err := transit.ParseServiceDate(path[1])
+		if err != nil {
+			return err
+		}
+		start, err := transit.ParseTimeOfDay(path[2])
+		if err != nil {
+			return err
+		}
+		switch r.Method {
+		case http.MethodGet:
+			o, err := db.GetOffering(num, date, start)
+			if err != nil {
+				return err
+			}
+			return writeJSON(w, http.StatusOK, o)
+		case http.MethodPatch:
+			var change offeringChange
+			if err := readJSON(r, &change); err != nil {
+				return err
+			}
+			// Both changes are made or neither is
+			err := db.WithTx(func(tx *transit.Database) error {
+				if change.DriverName != nil {
+					if err := tx.ChangeDriver(*change.DriverName, num, date, start); err != nil {
+						return err
+					}
+				}
+				if change.BusID != nil {
+					return tx.ChangeBus(*change.BusID, num, date, start)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			return writeJSON(w, http.StatusOK, struct{ Warnings []string }{warnings})
+		case http.MethodDelete:
+			if err := db.DeleteOffering(num, date, start); err != nil {
+				return err
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+	}
+	return methodNotAllowed(r)
+}
+
+func (s *Server) buses(w http.ResponseWriter, r *http.Request, path []string) error {
+	switch {
+	case len(path) == 0 && r.Method == http.MethodGet:
+		table, err := s.db.GetBusTable()
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, table)
+	case len(path) == 0 && r.Method == http.MethodPost:
+		var b transit.Bus
+		if err := readJSON(r, &b); err != nil {
+			return err
+		}
+		if err := s.db.AddBus(b.BusID, b.Model, b.Year); err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusCreated, b)
+	case len(path) == 1:
+		id, err := intParam(path[0])
+		if err != nil {
+			return err
+		}
+		switch r.Method {
+		case http.MethodGet:
+			b, err := s.db.GetBus(id)
+			if err != nil {
+				return err
+			}
+			return writeJSON(w, http.StatusOK, b)
+		case http.MethodDelete:
+			if err := s.db.DeleteBus(id); err != nil {
+				return err
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+	}
+	return methodNotAllowed(r)
+}
+
+func (s *Server) drivers(w http.ResponseWriter, r *http.Request, path []string) error {
+	switch {
+	case len(path) == 0 && r.Method == http.MethodGet:
+		table, err := s.db.GetDriverTable()
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, table)
+	case len(path) == 0 && r.Method == http.MethodPost:
+		var d transit.Driver
+		if err := readJSON(r, &d); err != nil {
+			return err
+		}
+		if err := s.db.AddDriver(d.DriverName, d.DriverTelephoneNumber); err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusCreated, d)
+	case len(path) == 1:
+		switch r.Method {
+		case http.MethodGet:
+			d, err := s.db.GetDriver(path[0])
+			if err != nil {
+				return err
+			}
+			return writeJSON(w, http.StatusOK, d)
+		case http.MethodPut:
+			d := transit.Driver{DriverName: path[0]}
+			if err := readJSON(r, &d); err != nil {
+				return err
+			}
+			if d.DriverName != path[0] {
+				return keyMismatch(r)
+			}
+			if err := s.db.UpdateDriver(d.DriverName, d.DriverTelephoneNumber); err != nil {
+				return err
+			}
+			// Retiring a driver is not an update, so send back what is stored
+			d, err := s.db.GetDriver(d.DriverName)
+			if err != nil {
+				return err
+			}
+			return writeJSON(w, http.StatusOK, d)
+		case http.MethodDelete:
+			if err := s.db.DeleteDriver(path[0]); err != nil {
+				return err
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+	case len(path) == 2 && path[1] == "weekly" && r.Method == http.MethodGet:
+		if r.URL.Query().Get("date") == "" {
+			return badRequest("Missing date parameter")
+		}
+		date, err := transit.ParseServiceDate(r.URL.Query().Get("date"))
+		if err != nil {
+			return err
+		}
+		offerings, err := s.db.GetDriverWeeklySchedule(path[0], date)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, offerings)
+	}
+	return methodNotAllowed(r)
+}
+
+func (s *Server) stops(w http.ResponseWriter, r *http.Request, path []string) error {
+	switch {
+	case len(path) == 0 && r.Method == http.MethodGet:
+		table, err := s.db.GetStopTable()
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, table)
+	case len(path) == 0 && r.Method == http.MethodPost:
+		var st transit.Stop
+		if err := readJSON(r, &st); err != nil {
+			return err
+		}
+		if err := s.db.AddStop(st.StopNumber, st.StopAddress); err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusCreated, st)
+	case len(path) == 1:
+		num, err := intParam(path[0])
+		if err != nil {
+			return err
+		}
+		switch r.Method {
+		case http.MethodGet:
+			st, err := s.db.GetStop(num)
+			if err != nil {
+				return err
+			}
+			return writeJSON(w, http.StatusOK, st)
+		case http.MethodPut:
+			st := transit.Stop{StopNumber: num}
+			if err := readJSON(r, &st); err != nil {
+				return err
+			}
+			if st.StopNumber != num {
+				return keyMismatch(r)
+			}
+			if err := s.db.UpdateStop(st.StopNumber, st.StopAddress); err != nil {
+				return err
+			}
+			return writeJSON(w, http.StatusOK, st)
+		case http.MethodDelete:
+			if err := s.db.DeleteStop(num); err != nil {
+				return err
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+	}
+	return methodNotAllowed(r)
+}
+
+func (s *Server) stopInfos(w http.ResponseWriter, r *http.Request, path []string) error {
+	switch {
+	case len(path) == 0 && r.Method == http.MethodGet:
+		table, err := s.db.GetTripStopInfoTable()
+		if err != nil {
+			return err
+		}
+		trip := r.URL.Query().Get("trip")
+		result := []transit.TripStopInfo{}
+		for _, t := range table {
+			if trip == "" || strconv.Itoa(t.TripNumber) == trip {
+				result = append(result, t)
+			}
+		}
+		return writeJSON(w, http.StatusOK, result)
+	case len(path) == 0 && r.Method == http.MethodPost:
+		var t transit.TripStopInfo
+		if err := readJSON(r, &t); err != nil {
+			return err
+		}
+		if err := s.db.AddTripStopInfo(t.TripNumber, t.StopNumber, t.SequenceNumber, t.DrivingTime); err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusCreated, t)
+	case len(path) == 2:
+		trip, err := intParam(path[0])
+		if err != nil {
+			return err
+		}
+		stop, err := intParam(path[1])
+		if err != nil {
+			return err
+		}
+		switch r.Method {
+		case http.MethodGet:
+			t, err := s.db.GetTripStopInfo(trip, stop)
+			if err != nil {
+				return err
+			}
+			return writeJSON(w, http.StatusOK, t)
+		case http.MethodPut:
+			t := transit.TripStopInfo{TripNumber: trip, StopNumber: stop}
+			if err := readJSON(r, &t); err != nil {
+				return err
+			}
+			if t.TripNumber != trip || t.StopNumber != stop {
+				return keyMismatch(r)
+			}
+			if err := s.db.UpdateTripStopInfo(t.TripNumber, t.StopNumber, t.SequenceNumber, t.DrivingTime); err != nil {
+				return err
+			}
+			return writeJSON(w, http.StatusOK, t)
+		case http.MethodDelete:
+			if err := s.db.DeleteTripStopInfo(trip, stop); err != nil {
+				return err
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+	}
+	return methodNotAllowed(r)
+}
+
+func (s *Server) actualInfos(w http.ResponseWriter, r *http.Request, path []string) error {
+	switch {
+	case len(path) == 0 && r.Method == http.MethodGet:
+		table, err := s.db.GetActualTripStopInfoTable()
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusOK, table)
+	case len(path) == 0 && r.Method == http.MethodPost:
+		var a transit.ActualTripStopInfo
+		if err := readJSON(r, &a); err != nil {
+			return err
+		}
+		if err := s.db.AddActualTripStopInfo(a.TripNumber, a.Date, a.ScheduledStartTime, a.StopNumber, a.ScheduledArrivalTime, a.ActualStartTime, a.ActualArrivalTime, a.NumberOfPassengerIn, a.NumberOfPassengerOut); err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusCreated, a)
+	case len(path) == 4:
+		trip, err := intParam(path[0])
+		if err != nil {
+			return err
+		}
+		date, err := transit.ParseServiceDate(path[1])
+		if err != nil {
+			return err
+		}
+		start, err := transit.ParseTimeOfDay(path[2])
+		if err != nil {
+			return err
+		}
+		stop, err := intParam(path[3])
+		if err != nil {
+			return err
+		}
+		switch r.Method {
+		case http.MethodGet:
+			a, err := s.db.GetActualTripStopInfo(trip, date, start, stop)
+			if err != nil {
+				return err
+			}
+			return writeJSON(w, http.StatusOK, a)
+		case http.MethodPut:
+			a := transit.ActualTripStopInfo{TripNumber: trip, Date: date, ScheduledStartTime: start, StopNumber: stop}
+			if err := readJSON(r, &a); err != nil {
+				return err
+			}
+			if a.TripNumber != trip || !a.Date.Equal(date) || a.ScheduledStartTime != start || a.StopNumber != stop {
+				return keyMismatch(r)
+			}
+			if err := s.db.UpdateActualTripStopInfo(a.TripNumber, a.Date, a.ScheduledStartTime, a.StopNumber, a.ScheduledArrivalTime, a.ActualStartTime, a.ActualArrivalTime, a.NumberOfPassengerIn, a.NumberOfPassengerOut); err != nil {
+				return err
+			}
+			return writeJSON(w, http.StatusOK, a)
+		case http.MethodDelete:
+			if err := s.db.DeleteActualTripStopInfo(trip, date, start, stop); err != nil {
+				return err
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+	}
+	return methodNotAllowed(r)
+}
+
+func (s *Server) schedule(w http.ResponseWriter, r *http.Request, path []string) error {
+	if len(path) != 0 || r.Method != http.MethodGet {
+		return methodNotAllowed(r)
+	}
+	q := r.URL.Query()
+	for _, param := range []string{"from", "to", "date"} {
+		if q.Get(param) == "" {
+			return badRequest("Missing %s parameter", param)
+		}
+	}
+	date, err := transit.ParseServiceDate(q.Get("date"))
+	if err != nil {
+		return err
+	}
+	trips, offerings, err := s.db.GetSchedule(q.Get("from"), q.Get("to"), date)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, struct {
+		Trips     []transit.Trip
+		Offerings map[int][]transit.TripOffering
+	}{trips, offerings})
+}
+
+func methodNotAllowed(r *http.Request) error {
+	return &httpError{http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed on %s", r.Method, r.URL.Path)}
+}
+
+// keyMismatch refuses a PUT body whose key is not the one in the path
+func keyMismatch(r *http.Request) error {
+	return badRequest("Body key does not match %s", r.URL.Path)
+}
+
+func intParam(s string) (int, error) {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, badRequest("Invalid number %q", s)
+	}
+	return i, nil
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return badRequest("Invalid JSON body: %v", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
+// statusOf maps an error from the transit package to an HTTP status code
+func statusOf(err error) int {
+	var h *httpError
+	var conflict *transit.ConflictError
+	switch {
+	case errors.As(err, &h):
+		return h.status
+	case errors.As(err, &conflict):
+		return http.StatusConflict
+	case errors.Is(err, transit.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, transit.ErrInvalid):
+		return http.StatusBadRequest
+	case transit.IsConstraint(err):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := statusOf(err)
+	if status == http.StatusInternalServerError {
+		log.Println(err)
+	}
+	writeJSON(w, status, struct{ Error string }{err.Error()})
+}
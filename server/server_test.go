@@ -0,0 +1,263 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/server"
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+// newServer returns a test server on a new in-memory database holding a
+// trip, two stops, a bus, a driver and one offering
+func newServer(t *testing.T) (*httptest.Server, *transit.Database) {
+	t.Helper()
+	db, err := transit.GetDatabase(transit.Options{InMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, req := range []struct{ path, body string }{
+		{"/trips", `{"TripNumber": 1, "StartLocationName": "Pomona", "DestinationName": "Ontario"}`},
+		{"/stops", `{"StopNumber": 1, "StopAddress": "1 Main St"}`},
+		{"/stops", `{"StopNumber": 2, "StopAddress": "2 Main St"}`},
+		{"/buses", `{"BusID": 1, "Model": "Gillig", "Year": 2015}`},
+		{"/drivers", `{"DriverName": "O'Brien", "DriverTelephoneNumber": "555-0100"}`},
+		{"/offerings", `{"TripNumber": 1, "Date": "2026-10-19", "ScheduledStartTime": "10:00", "ScheduledArrivalTime": "11:00", "DriverName": "O'Brien", "BusID": 1}`},
+	} {
+		w := httptest.NewRecorder()
+		server.New(db, server.Options{}).ServeHTTP(w, httptest.NewRequest(http.MethodPost, req.path, strings.NewReader(req.body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("POST %s: got %d %s", req.path, w.Code, w.Body)
+		}
+	}
+	ts := httptest.NewServer(server.New(db, server.Options{}))
+	t.Cleanup(ts.Close)
+	return ts, db
+}
+
+// do sends a request to the test server and returns its status
+func do(t *testing.T, ts *httptest.Server, method string, path string, body string) int {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var msg struct{ Error string }
+	if resp.StatusCode >= 400 {
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+			t.Errorf("%s %s: error body is not JSON: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestRoutes(t *testing.T) {
+	tests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{"GET", "/nowhere", "", http.StatusNotFound},
+
+		{"GET", "/trips", "", http.StatusOK},
+		{"POST", "/trips", `{"TripNumber": 2, "StartLocationName": "Ontario", "DestinationName": "Pomona"}`, http.StatusCreated},
+		{"POST", "/trips", `{"TripNumber": 1, "StartLocationName": "Pomona", "DestinationName": "Ontario"}`, http.StatusConflict},
+		{"POST", "/trips", `{"TripNumber": "two"}`, http.StatusBadRequest},
+		{"POST", "/trips", `{"Trip": 3}`, http.StatusBadRequest},
+		{"GET", "/trips/1", "", http.StatusOK},
+		{"GET", "/trips/9", "", http.StatusNotFound},
+		{"GET", "/trips/one", "", http.StatusBadRequest},
+		{"GET", "/trips/1/stops", "", http.StatusOK},
+		{"PUT", "/trips/2", `{"StartLocationName": "Ontario", "DestinationName": "Claremont"}`, http.StatusOK},
+		{"PUT", "/trips/2", `{"TripNumber": 2, "StartLocationName": "Ontario", "DestinationName": "Pomona"}`, http.StatusOK},
+		{"PUT", "/trips/2", `{"TripNumber": 3, "StartLocationName": "Ontario", "DestinationName": "Pomona"}`, http.StatusBadRequest},
+		{"PUT", "/trips/9", `{"StartLocationName": "Ontario", "DestinationName": "Pomona"}`, http.StatusNotFound},
+		{"POST", "/trips", `{"TripNumber": 3, "StartLocationName": "Chino", "DestinationName": "Pomona"}`, http.StatusCreated},
+		{"DELETE", "/trips/3", "", http.StatusNoContent},
+		{"DELETE", "/trips/3", "", http.StatusNotFound},
+		{"DELETE", "/trips/1", "", http.StatusConflict},
+		{"PATCH", "/trips/1", "", http.StatusMethodNotAllowed},
+
+		{"GET", "/stops", "", http.StatusOK},
+		{"POST", "/stops", `{"StopNumber": 3, "StopAddress": "3 Main St"}`, http.StatusCreated},
+		{"POST", "/stops", `{"StopNumber": 1, "StopAddress": "1 Main St"}`, http.StatusConflict},
+		{"POST", "/stops", `not json`, http.StatusBadRequest},
+		{"GET", "/stops/1", "", http.StatusOK},
+		{"GET", "/stops/9", "", http.StatusNotFound},
+		{"GET", "/stops/one", "", http.StatusBadRequest},
+		{"PUT", "/stops/3", `{"StopAddress": "3 Holt Ave"}`, http.StatusOK},
+		{"PUT", "/stops/3", `{"StopNumber": 1, "StopAddress": "3 Holt Ave"}`, http.StatusBadRequest},
+		{"PUT", "/stops/9", `{"StopAddress": "9 Holt Ave"}`, http.StatusNotFound},
+		{"DELETE", "/stops/3", "", http.StatusNoContent},
+		{"DELETE", "/stops/3", "", http.StatusNotFound},
+		{"PATCH", "/stops/1", "", http.StatusMethodNotAllowed},
+
+		{"GET", "/stopinfos?trip=1", "", http.StatusOK},
+		{"POST", "/stopinfos", `{"TripNumber": 1, "StopNumber": 1, "SequenceNumber": 1, "DrivingTime": 0}`, http.StatusCreated},
+		{"POST", "/stopinfos", `{"TripNumber": 1, "StopNumber": 1, "SequenceNumber": 1, "DrivingTime": 0}`, http.StatusConflict},
+		{"POST", "/stopinfos", `{"TripNumber": 9, "StopNumber": 1, "SequenceNumber": 1, "DrivingTime": 0}`, http.StatusConflict},
+		{"POST", "/stopinfos", `[]`, http.StatusBadRequest},
+		{"DELETE", "/stopinfos", "", http.StatusMethodNotAllowed},
+		{"GET", "/stopinfos/1/1", "", http.StatusOK},
+		{"GET", "/stopinfos/1/2", "", http.StatusNotFound},
+		{"GET", "/stopinfos/1/one", "", http.StatusBadRequest},
+		{"PUT", "/stopinfos/1/1", `{"SequenceNumber": 1, "DrivingTime": 5}`, http.StatusOK},
+		{"PUT", "/stopinfos/1/1", `{"StopNumber": 2, "SequenceNumber": 1, "DrivingTime": 5}`, http.StatusBadRequest},
+		{"PUT", "/stopinfos/1/2", `{"SequenceNumber": 2, "DrivingTime": 5}`, http.StatusNotFound},
+		{"DELETE", "/stops/1", "", http.StatusConflict},
+		{"POST", "/stopinfos", `{"TripNumber": 1, "StopNumber": 2, "SequenceNumber": 2, "DrivingTime": 10}`, http.StatusCreated},
+		{"DELETE", "/stopinfos/1/2", "", http.StatusNoContent},
+		{"DELETE", "/stopinfos/1/2", "", http.StatusNotFound},
+		{"PATCH", "/stopinfos/1/1", "", http.StatusMethodNotAllowed},
+
+		{"GET", "/buses", "", http.StatusOK},
+		{"POST", "/buses", `{"BusID": 2, "Model": "Gillig", "Year": 2015}`, http.StatusCreated},
+		{"POST", "/buses", `{"BusID": 1, "Model": "Gillig", "Year": 2015}`, http.StatusConflict},
+		{"POST", "/buses", `{"BusID": "one"}`, http.StatusBadRequest},
+		{"GET", "/buses/1", "", http.StatusOK},
+		{"GET", "/buses/9", "", http.StatusNotFound},
+		{"GET", "/buses/one", "", http.StatusBadRequest},
+		{"DELETE", "/buses/1", "", http.StatusConflict},
+		{"DELETE", "/buses/9", "", http.StatusNotFound},
+		{"PUT", "/buses/1", "", http.StatusMethodNotAllowed},
+
+		{"GET", "/drivers", "", http.StatusOK},
+		{"POST", "/drivers", `{"DriverName": "Ann", "DriverTelephoneNumber": "555-0101"}`, http.StatusCreated},
+		{"POST", "/drivers", `{"DriverName": "O'Brien", "DriverTelephoneNumber": "555-0100"}`, http.StatusConflict},
+		{"POST", "/drivers", `{"DriverName": 1}`, http.StatusBadRequest},
+		{"GET", "/drivers/O'Brien", "", http.StatusOK},
+		{"GET", "/drivers/Nobody", "", http.StatusNotFound},
+		{"GET", "/drivers/O'Brien/weekly?date=2026-10-19", "", http.StatusOK},
+		{"GET", "/drivers/O'Brien/weekly", "", http.StatusBadRequest},
+		{"GET", "/drivers/O'Brien/weekly?date=19/10/2026", "", http.StatusBadRequest},
+		{"PUT", "/drivers/Ann", `{"DriverTelephoneNumber": "555-0199"}`, http.StatusOK},
+		{"PUT", "/drivers/Ann", `{"DriverName": "Bob", "DriverTelephoneNumber": "555-0199"}`, http.StatusBadRequest},
+		{"PUT", "/drivers/Nobody", `{"DriverTelephoneNumber": "555-0199"}`, http.StatusNotFound},
+		{"POST", "/drivers", `{"DriverName": "Cat", "DriverTelephoneNumber": "555-0102"}`, http.StatusCreated},
+		{"DELETE", "/drivers/Cat", "", http.StatusNoContent},
+		{"DELETE", "/drivers/Cat", "", http.StatusNotFound},
+		{"DELETE", "/drivers/O'Brien", "", http.StatusConflict},
+		{"PATCH", "/drivers/O'Brien", "", http.StatusMethodNotAllowed},
+
+		{"GET", "/offerings?trip=1&date=2026-10", "", http.StatusOK},
+		{"POST", "/offerings", `{"TripNumber": 2, "Date": "2026-10-19", "ScheduledStartTime": "12:00", "ScheduledArrivalTime": "13:00", "DriverName": "O'Brien", "BusID": 1}`, http.StatusCreated},
+		{"POST", "/offerings", `{"TripNumber": 2, "Date": "2026-10-19", "ScheduledStartTime": "10:30", "ScheduledArrivalTime": "11:30", "DriverName": "O'Brien", "BusID": 2}`, http.StatusConflict},
+		{"POST", "/offerings?force=true", `{"TripNumber": 2, "Date": "2026-10-19", "ScheduledStartTime": "10:30", "ScheduledArrivalTime": "11:30", "DriverName": "O'Brien", "BusID": 2}`, http.StatusCreated},
+		{"POST", "/offerings", `{"TripNumber": 2, "Date": "tomorrow"}`, http.StatusBadRequest},
+		{"GET", "/offerings/1/2026-10-19/10:00", "", http.StatusOK},
+		{"GET", "/offerings/1/2026-10-20/10:00", "", http.StatusNotFound},
+		{"GET", "/offerings/1/tomorrow/10:00", "", http.StatusBadRequest},
+		{"GET", "/offerings/one/2026-10-19/10:00", "", http.StatusBadRequest},
+		{"PATCH", "/offerings/1/2026-10-19/10:00", `{"DriverName": "Ann"}`, http.StatusOK},
+		{"PATCH", "/offerings/1/2026-10-19/10:00", `{"BusID": 9}`, http.StatusConflict},
+		{"PATCH", "/offerings/1/2026-10-20/10:00", `{"DriverName": "Ann"}`, http.StatusNotFound},
+		{"PATCH", "/offerings/1/2026-10-19/10:00", `{"Driver": "Ann"}`, http.StatusBadRequest},
+		{"PUT", "/offerings/1/2026-10-19/10:00", "", http.StatusMethodNotAllowed},
+		{"DELETE", "/offerings/1/2026-10-19/10:00", "", http.StatusNoContent},
+		{"DELETE", "/offerings/1/2026-10-19/10:00", "", http.StatusNotFound},
+		{"DELETE", "/offerings", "", http.StatusMethodNotAllowed},
+
+		{"GET", "/actualinfos", "", http.StatusOK},
+		{"POST", "/actualinfos", `{"TripNumber": 2, "Date": "2026-10-19", "ScheduledStartTime": "12:00", "StopNumber": 1, "ScheduledArrivalTime": "12:00", "ActualStartTime": "12:01", "ActualArrivalTime": "12:01", "NumberOfPassengerIn": 3, "NumberOfPassengerOut": 0}`, http.StatusCreated},
+		{"POST", "/actualinfos", `{"TripNumber": 2, "Date": "2026-10-19", "ScheduledStartTime": "12:00", "StopNumber": 1, "ScheduledArrivalTime": "12:00", "ActualStartTime": "12:01", "ActualArrivalTime": "12:01", "NumberOfPassengerIn": 3, "NumberOfPassengerOut": 0}`, http.StatusConflict},
+		{"POST", "/actualinfos", `{"TripNumber": 2}`, http.StatusBadRequest},
+		{"GET", "/actualinfos/2/2026-10-19/12:00/1", "", http.StatusOK},
+		{"GET", "/actualinfos/2/2026-10-19/12:00/2", "", http.StatusNotFound},
+		{"GET", "/actualinfos/2/today/12:00/1", "", http.StatusBadRequest},
+		{"PUT", "/actualinfos/2/2026-10-19/12:00/1", `{"ScheduledArrivalTime": "12:00", "ActualStartTime": "12:02", "ActualArrivalTime": "12:02", "NumberOfPassengerIn": 4, "NumberOfPassengerOut": 0}`, http.StatusOK},
+		{"PUT", "/actualinfos/2/2026-10-19/12:00/1", `{"Date": "2026-10-20", "NumberOfPassengerIn": 4}`, http.StatusBadRequest},
+		{"PUT", "/actualinfos/2/2026-10-19/12:00/2", `{"NumberOfPassengerIn": 4}`, http.StatusNotFound},
+		{"DELETE", "/actualinfos/2/2026-10-19/12:00/1", "", http.StatusNoContent},
+		{"DELETE", "/actualinfos/2/2026-10-19/12:00/1", "", http.StatusNotFound},
+		{"PATCH", "/actualinfos", "", http.StatusMethodNotAllowed},
+
+		{"GET", "/schedule?from=Pomona&to=Ontario&date=2026-10-19", "", http.StatusOK},
+		{"GET", "/schedule?from=Pomona&to=Ontario", "", http.StatusBadRequest},
+		{"GET", "/schedule?from=Pomona&to=Ontario&date=today", "", http.StatusBadRequest},
+		{"POST", "/schedule", "", http.StatusMethodNotAllowed},
+	}
+	ts, _ := newServer(t)
+	// The requests run in order, each seeing the changes of those before it
+	for _, tt := range tests {
+		if got := do(t, ts, tt.method, tt.path, tt.body); got != tt.status {
+			t.Errorf("%s %s %s: got %d, want %d", tt.method, tt.path, tt.body, got, tt.status)
+		}
+	}
+}
+
+func TestPatchOfferingIsAtomic(t *testing.T) {
+	ts, db := newServer(t)
+	if got := do(t, ts, "PATCH", "/offerings/1/2026-10-19/10:00", `{"DriverName": "Nobody", "BusID": 1}`); got != http.StatusConflict {
+		t.Fatalf("PATCH to an unknown driver: got %d, want %d", got, http.StatusConflict)
+	}
+	if got := do(t, ts, "POST", "/drivers", `{"DriverName": "Ann", "DriverTelephoneNumber": "555-0101"}`); got != http.StatusCreated {
+		t.Fatalf("POST /drivers: got %d", got)
+	}
+	if got := do(t, ts, "PATCH", "/offerings/1/2026-10-19/10:00", `{"DriverName": "Ann", "BusID": 99}`); got != http.StatusConflict {
+		t.Fatalf("PATCH to an unknown bus: got %d, want %d", got, http.StatusConflict)
+	}
+	offerings, err := db.GetTripOfferingTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offerings) != 1 || offerings[0].DriverName != "O'Brien" || !offerings[0].HasBus(1) {
+		t.Errorf("Offerings after the refused PATCH %v, want O'Brien still driving bus 1", offerings)
+	}
+}
+
+func TestOperatorHeader(t *testing.T) {
+	for _, trust := range []bool{false, true} {
+		db, err := transit.GetDatabase(transit.Options{InMemory: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		db = db.WithOperator("server")
+		req := httptest.NewRequest(http.MethodPost, "/buses", strings.NewReader(`{"BusID": 1, "Model": "Gillig", "Year": 2015}`))
+		req.Header.Set(server.OperatorHeader, "mallory")
+		w := httptest.NewRecorder()
+		server.New(db, server.Options{TrustOperatorHeader: trust}).ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("POST /buses: got %d %s", w.Code, w.Body)
+		}
+		history, err := db.History("Bus", "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "server"
+		if trust {
+			want = "mallory"
+		}
+		if len(history) != 1 || history[0].Operator != want {
+			t.Errorf("Trusting the header %t: got history %v, want the insert made by %s", trust, history, want)
+		}
+	}
+}
+
+func TestPutDriverKeepsRetirement(t *testing.T) {
+	ts, db := newServer(t)
+	if err := db.AddDriver("Ann", "555-0101"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RetireDriver("Ann", transit.Today()); err != nil {
+		t.Fatal(err)
+	}
+	if got := do(t, ts, "PUT", "/drivers/Ann", `{"DriverTelephoneNumber": "555-0199", "RetiredOn": ""}`); got != http.StatusOK {
+		t.Fatalf("PUT /drivers/Ann: got %d", got)
+	}
+	d, err := db.GetDriver("Ann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.DriverTelephoneNumber != "555-0199" || !d.RetiredOn.Equal(transit.Today()) {
+		t.Errorf("Driver after PUT %v, want the new number and still retired today", d)
+	}
+}
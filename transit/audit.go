@@ -0,0 +1,199 @@
+// Append-only audit log of every change made through the database
+package transit
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "os"
+    "os/user"
+    "strconv"
+    "time"
+)
+
+const (
+    AuditInsert = "insert"
+    AuditUpdate = "update"
+    AuditDelete = "delete"
+
+    selectAuditRecords   = `SELECT AuditID, Entity, EntityKey, Action, Before, After, ChangedAt, Operator FROM AuditLog`
+    selectAuditByKey     = selectAuditRecords + ` WHERE Entity = ? AND EntityKey = ? ORDER BY AuditID`
+    selectBusAuditRecord = selectAuditRecords + ` WHERE (Entity = 'Bus' AND EntityKey = ?) OR (Entity = 'TripOffering' AND (Before LIKE ? OR Before LIKE ? OR After LIKE ? OR After LIKE ?)) ORDER BY AuditID`
+    insertAuditRecord    = `INSERT INTO AuditLog (Entity, EntityKey, Action, Before, After, ChangedAt, Operator) VALUES (?, ?, ?, ?, ?, ?, ?)`
+)
+
+// EnvOperator names who is making changes, for the audit log
+const EnvOperator = "TRANSIT_OPERATOR"
+
+// AuditRecord is one change to one row. Before and After hold the row as
+// JSON; Before is empty for an insert and After for a delete.
+type AuditRecord struct {
+    AuditID   int
+    Entity    string // the table of the row
+    Key       string // the primary key of the row, space separated
+    Action    string // AuditInsert, AuditUpdate or AuditDelete
+    Before    string
+    After     string
+    ChangedAt string // RFC 3339
+    Operator  string
+}
+
+func (a AuditRecord) String() string {
+    return fmt.Sprintf("AuditID: %d\nEntity: %s\nKey: %s\nAction: %s\nBefore: %s\nAfter: %s\nChangedAt: %s\nOperator: %s", a.AuditID, a.Entity, a.Key, a.Action, a.Before, a.After, a.ChangedAt, a.Operator)
+}
+
+// DefaultOperator returns the operator named by the environment, or else
+// the name the user logged in as
+func DefaultOperator() string {
+    if op := os.Getenv(EnvOperator); op != "" {
+        return op
+    }
+    if u, err := user.Current(); err == nil && u.Username != "" {
+        return u.Username
+    }
+    return "unknown"
+}
+
+// WithOperator returns a handle on the same database whose changes are
+// recorded in the audit log as made by operator
+func (db *Database) WithOperator(operator string) *Database {
+    o := *db
+    o.operator = operator
+    return &o
+}
+
+// Operator returns who the handle's changes are recorded as made by
+func (db *Database) Operator() string {
+    return db.operator
+}
+
+// History returns the changes recorded for one row, oldest first. key is
+// the row's primary key with its parts separated by spaces.
+func (db *Database) History(entity string, key string) ([]AuditRecord, error) {
+    result := []AuditRecord{}
+    row, err := db.query(selectAuditByKey, entity, key)
+    if err != nil {
+        return result, err
+    }
+    defer row.Close()
+    result = RowToAuditRecords(row)
+    return result, nil
+}
+
+// OfferingHistory returns the changes recorded for an offering, oldest first
+func (db *Database) OfferingHistory(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay) ([]AuditRecord, error) {
+    return db.History("TripOffering", offeringKey(tripNumber, date, scheduledStartTime))
+}
+
+// BusHistory returns the changes recorded for a bus, along with every
+// offering it was assigned to or taken off, oldest first
+func (db *Database) BusHistory(busID int) ([]AuditRecord, error) {
+    result := []AuditRecord{}
+    // The driver is built without JSON1, so offerings are picked out by the
+    // text of their encoded BusID field, wherever it falls, and decoded below
+    // only to drop changes of driver
+    field := fmt.Sprintf(`%%"BusID":%d`, busID)
+    row, err := db.query(selectBusAuditRecord, strconv.Itoa(busID), field+",%", field+"}%", field+",%", field+"}%")
+    if err != nil {
+        return result, err
+    }
+    defer row.Close()
+    for _, a := range RowToAuditRecords(row) {
+        if a.Entity != "TripOffering" {
+            result = append(result, a)
+            continue
+        }
+        var before, after TripOffering
+        json.Unmarshal([]byte(a.Before), &before)
+        json.Unmarshal([]byte(a.After), &after)
+        // Leave out changes of driver on an offering the bus kept
+        if (before.HasBus(busID) || after.HasBus(busID)) && (a.Action != AuditUpdate || !sameBus(before.BusID, after.BusID)) {
+            result = append(result, a)
+        }
+    }
+    return result, nil
+}
+
+// RowToAuditRecords converts a sql row to a slice of audit records
+func RowToAuditRecords(row *sql.Rows) []AuditRecord {
+    result := []AuditRecord{}
+    for row.Next() {
+        var a AuditRecord
+        var before, after sql.NullString
+        row.Scan(&a.AuditID, &a.Entity, &a.Key, &a.Action, &before, &after, &a.ChangedAt, &a.Operator)
+        a.Before, a.After = before.String, after.String
+        result = append(result, a)
+    }
+    return result
+}
+
+// record appends a change of a row to the audit log. before is nil for an
+// insert and after is nil for a delete. It should run in the transaction
+// that makes the change, so the log never disagrees with the tables.
+func (db *Database) record(before, after interface{}) error {
+    action, row := AuditUpdate, after
+    switch {
+    case before == nil:
+        action = AuditInsert
+    case after == nil:
+        action, row = AuditDelete, before
+    }
+    entity, key, err := auditKey(row)
+    if err != nil {
+        return err
+    }
+    beforeJSON, err := auditJSON(before)
+    if err != nil {
+        return err
+    }
+    afterJSON, err := auditJSON(after)
+    if err != nil {
+        return err
+    }
+    _, err = db.exec(insertAuditRecord, entity, key, action, beforeJSON, afterJSON, time.Now().Format(time.RFC3339), db.operator)
+    return err
+}
+
+// auditJSON encodes a row for the audit log, or NULL for no row
+func auditJSON(row interface{}) (interface{}, error) {
+    if row == nil {
+        return nil, nil
+    }
+    data, err := json.Marshal(row)
+    if err != nil {
+        return nil, err
+    }
+    return string(data), nil
+}
+
+// auditKey returns the table and primary key of a row
+func auditKey(row interface{}) (string, string, error) {
+    switch r := row.(type) {
+    case Bus:
+        return "Bus", strconv.Itoa(r.BusID), nil
+    case Driver:
+        return "Driver", r.DriverName, nil
+    case Stop:
+        return "Stop", strconv.Itoa(r.StopNumber), nil
+    case Trip:
+        return "Trip", strconv.Itoa(r.TripNumber), nil
+    case TripStopInfo:
+        return "TripStopInfo", fmt.Sprintf("%d %d", r.TripNumber, r.StopNumber), nil
+    case TripOffering:
+        return "TripOffering", offeringKey(r.TripNumber, r.Date, r.ScheduledStartTime), nil
+    case ActualTripStopInfo:
+        return "ActualTripStopInfo", fmt.Sprintf("%s %d", offeringKey(r.TripNumber, r.Date, r.ScheduledStartTime), r.StopNumber), nil
+    case ServicePattern:
+        return "ServicePattern", r.PatternName, nil
+    case Holiday:
+        return "Holiday", r.Date.String(), nil
+    case ServiceException:
+        return "ServiceException", fmt.Sprintf("%d %s", r.TripNumber, r.Date), nil
+    }
+    return "", "", fmt.Errorf("Cannot audit %T", row)
+}
+
+// offeringKey is the audit log key of an offering
+func offeringKey(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay) string {
+    return fmt.Sprintf("%d %s %s", tripNumber, date, scheduledStartTime)
+}
@@ -0,0 +1,49 @@
+package transit_test
+
+import (
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+func TestBusHistory(t *testing.T) {
+	db := openMemory(t)
+	date, start := mustParseDate(t, "2026-10-19"), mustParseTime(t, "10:00")
+	arrival, later, laterArrival := mustParseTime(t, "11:00"), mustParseTime(t, "12:00"), mustParseTime(t, "13:00")
+	for _, err := range []error{
+		db.AddTrip(1, "A", "B"),
+		db.AddTrip(2, "B", "A"),
+		db.AddBus(5, "Gillig", 2015),
+		db.AddBus(15, "Gillig", 2015),
+		db.AddBus(55, "Gillig", 2015),
+		db.AddDriver("Ann", "555-0100"),
+		db.AddDriver("Bob", "555-0101"),
+		db.AddOffering(1, date, start, arrival, "Ann", 5),
+		db.AddOffering(2, date, later, laterArrival, "Bob", 15),
+		db.ChangeDriver("Bob", 1, date, start),
+		db.ChangeBus(55, 1, date, start),
+		db.ChangeBus(5, 2, date, later),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	history, err := db.BusHistory(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ entity, key, action string }{
+		{"Bus", "5", transit.AuditInsert},
+		{"TripOffering", "1 2026-10-19 10:00", transit.AuditInsert},
+		{"TripOffering", "1 2026-10-19 10:00", transit.AuditUpdate},
+		{"TripOffering", "2 2026-10-19 12:00", transit.AuditUpdate},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("Got %d records for bus 5, want %d:\n%v", len(history), len(want), history)
+	}
+	for i, w := range want {
+		if a := history[i]; a.Entity != w.entity || a.Key != w.key || a.Action != w.action {
+			t.Errorf("Record %d is %s %s %s, want %s %s %s", i, a.Action, a.Entity, a.Key, w.action, w.entity, w.key)
+		}
+	}
+}
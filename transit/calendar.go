@@ -0,0 +1,310 @@
+// Holidays and service exceptions that override the regular weekly service
+package transit
+
+import (
+    "database/sql"
+    "fmt"
+    "strings"
+    "time"
+)
+
+const (
+    ServiceAdded   = "added"
+    ServiceRemoved = "removed"
+
+    selectHolidays          = `SELECT Date, HolidayName, ServiceAs FROM Holiday ORDER BY Date`
+    selectHolidayByDate     = `SELECT Date, HolidayName, ServiceAs FROM Holiday WHERE Date = ?`
+    insertHoliday           = `INSERT INTO Holiday (Date, HolidayName, ServiceAs) VALUES (?, ?, ?)`
+    deleteHoliday           = `DELETE FROM Holiday WHERE Date = ?`
+    selectServiceExceptions = `SELECT TripNumber, Date, ExceptionType, Reason FROM ServiceException ORDER BY Date, TripNumber`
+    selectServiceException  = `SELECT TripNumber, Date, ExceptionType, Reason FROM ServiceException WHERE TripNumber IS ? AND Date = ?`
+    insertServiceException  = `INSERT INTO ServiceException (TripNumber, Date, ExceptionType, Reason) VALUES (?, ?, ?, ?)`
+    deleteServiceException  = `DELETE FROM ServiceException WHERE TripNumber IS ? AND Date = ?`
+)
+
+// Holiday is a date on which service follows another day's schedule, or
+// does not run at all when ServiceAs is empty
+type Holiday struct {
+    Date        ServiceDate
+    HolidayName string
+    ServiceAs   string // weekday whose schedule runs, e.g. "Sunday"
+}
+
+func (h Holiday) String() string {
+    return fmt.Sprintf("Date: %s\nHolidayName: %s\nServiceAs: %s", h.Date, h.HolidayName, h.ServiceAs)
+}
+
+// ServiceException adds or removes service for one trip, or for every trip
+// when TripNumber is 0, on a single date
+type ServiceException struct {
+    TripNumber    int
+    Date          ServiceDate
+    ExceptionType string // ServiceAdded or ServiceRemoved
+    Reason        string
+}
+
+func (e ServiceException) String() string {
+    return fmt.Sprintf("TripNumber: %d\nDate: %s\nExceptionType: %s\nReason: %s", e.TripNumber, e.Date, e.ExceptionType, e.Reason)
+}
+
+// AddHoliday adds a holiday to the database
+func (db *Database) AddHoliday(h Holiday) error {
+    if h.Date.IsZero() {
+        return invalidf("A holiday needs a date")
+    }
+    if h.ServiceAs != "" {
+        day, err := parseWeekday(h.ServiceAs)
+        if err != nil {
+            return err
+        }
+        h.ServiceAs = day.String()
+    }
+    return db.insert(h)
+}
+
+// DeleteHoliday deletes the holiday on the given date
+func (db *Database) DeleteHoliday(date ServiceDate) error {
+    return db.WithTx(func(tx *Database) error {
+        row, err := tx.query(selectHolidayByDate, date)
+        if err != nil {
+            return err
+        }
+        holidays := RowToHolidays(row)
+        row.Close()
+        if len(holidays) == 0 {
+            return fmt.Errorf("No holiday on %s: %w", date, ErrNotFound)
+        }
+        if _, err := tx.exec(deleteHoliday, date); err != nil {
+            return err
+        }
+        for _, h := range holidays {
+            if err := tx.record(h, nil); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+// GetHolidayTable returns all the holidays in the database
+func (db *Database) GetHolidayTable() ([]Holiday, error) {
+    result := []Holiday{}
+    row, err := db.query(selectHolidays)
+    if err != nil {
+        return result, err
+    }
+    defer row.Close()
+    result = RowToHolidays(row)
+    return result, nil
+}
+
+// RowToHolidays converts a sql row to a slice of holidays
+func RowToHolidays(row *sql.Rows) []Holiday {
+    result := []Holiday{}
+    for row.Next() {
+        var date ServiceDate
+        var name string
+        var serviceAs sql.NullString
+        row.Scan(&date, &name, &serviceAs)
+        result = append(result, Holiday{
+            Date:        date,
+            HolidayName: name,
+            ServiceAs:   serviceAs.String,
+        })
+    }
+    return result
+}
+
+// AddServiceException adds a service exception to the database
+func (db *Database) AddServiceException(e ServiceException) error {
+    if e.Date.IsZero() {
+        return invalidf("A service exception needs a date")
+    }
+    if e.ExceptionType != ServiceAdded && e.ExceptionType != ServiceRemoved {
+        return invalidf("Invalid exception type %q, expected %s or %s", e.ExceptionType, ServiceAdded, ServiceRemoved)
+    }
+    return db.insert(e)
+}
+
+// DeleteServiceException deletes the exception for the trip (0 for all trips) on the given date
+func (db *Database) DeleteServiceException(tripNumber int, date ServiceDate) error {
+    return db.WithTx(func(tx *Database) error {
+        row, err := tx.query(selectServiceException, tripOrAll(tripNumber), date)
+        if err != nil {
+            return err
+        }
+        exceptions := RowToServiceExceptions(row)
+        row.Close()
+        if len(exceptions) == 0 {
+            if tripNumber == 0 {
+                return fmt.Errorf("No service exception for all trips on %s: %w", date, ErrNotFound)
+            }
+            return fmt.Errorf("No service exception for trip %d on %s: %w", tripNumber, date, ErrNotFound)
+        }
+        if _, err := tx.exec(deleteServiceException, tripOrAll(tripNumber), date); err != nil {
+            return err
+        }
+        for _, e := range exceptions {
+            if err := tx.record(e, nil); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+// GetServiceExceptionTable returns all the service exceptions in the database
+func (db *Database) GetServiceExceptionTable() ([]ServiceException, error) {
+    result := []ServiceException{}
+    row, err := db.query(selectServiceExceptions)
+    if err != nil {
+        return result, err
+    }
+    defer row.Close()
+    result = RowToServiceExceptions(row)
+    return result, nil
+}
+
+// RowToServiceExceptions converts a sql row to a slice of service exceptions
+func RowToServiceExceptions(row *sql.Rows) []ServiceException {
+    result := []ServiceException{}
+    for row.Next() {
+        var tripNumber sql.NullInt64
+        var date ServiceDate
+        var exceptionType string
+        var reason sql.NullString
+        row.Scan(&tripNumber, &date, &exceptionType, &reason)
+        result = append(result, ServiceException{
+            TripNumber:    int(tripNumber.Int64),
+            Date:          date,
+            ExceptionType: exceptionType,
+            Reason:        reason.String,
+        })
+    }
+    return result
+}
+
+// tripOrAll stores trip number 0 as NULL, meaning every trip
+func tripOrAll(tripNumber int) interface{} {
+    if tripNumber == 0 {
+        return nil
+    }
+    return tripNumber
+}
+
+// Calendar answers which dates trips run on once holidays and service
+// exceptions are taken into account
+type Calendar struct {
+    holidays   map[string]Holiday // keyed by YYYY-MM-DD
+    exceptions map[calendarKey]ServiceException
+}
+
+type calendarKey struct {
+    tripNumber int
+    date       string // YYYY-MM-DD
+}
+
+// NewCalendar builds a calendar from the given holidays and exceptions
+func NewCalendar(holidays []Holiday, exceptions []ServiceException) *Calendar {
+    c := &Calendar{
+        holidays:   make(map[string]Holiday),
+        exceptions: make(map[calendarKey]ServiceException),
+    }
+    for _, h := range holidays {
+        c.holidays[h.Date.String()] = h
+    }
+    for _, e := range exceptions {
+        c.exceptions[calendarKey{e.TripNumber, e.Date.String()}] = e
+    }
+    return c
+}
+
+// GetCalendar loads the holidays and service exceptions from the database
+func (db *Database) GetCalendar() (*Calendar, error) {
+    holidays, err := db.GetHolidayTable()
+    if err != nil {
+        return nil, err
+    }
+    exceptions, err := db.GetServiceExceptionTable()
+    if err != nil {
+        return nil, err
+    }
+    return NewCalendar(holidays, exceptions), nil
+}
+
+// exception returns the exception for the trip on date, preferring one made
+// for that trip over one made for every trip
+func (c *Calendar) exception(tripNumber int, date ServiceDate) (ServiceException, bool) {
+    if e, ok := c.exceptions[calendarKey{tripNumber, date.String()}]; ok {
+        return e, true
+    }
+    e, ok := c.exceptions[calendarKey{0, date.String()}]
+    return e, ok
+}
+
+// TripRunsOn reports whether the calendar lets the trip run on date, along
+// with a note describing any holiday or exception that applies
+func (c *Calendar) TripRunsOn(tripNumber int, date ServiceDate) (bool, string) {
+    if e, ok := c.exception(tripNumber, date); ok {
+        return e.ExceptionType == ServiceAdded, fmt.Sprintf("service %s: %s", e.ExceptionType, e.Reason)
+    }
+    if h, ok := c.holidays[date.String()]; ok {
+        if h.ServiceAs == "" {
+            return false, fmt.Sprintf("%s, no service", h.HolidayName)
+        }
+        return true, fmt.Sprintf("%s, %s service", h.HolidayName, h.ServiceAs)
+    }
+    return true, ""
+}
+
+// checkOffering refuses an offering on a date the trip does not run
+func (c *Calendar) checkOffering(o TripOffering) error {
+    if runs, note := c.TripRunsOn(o.TripNumber, o.Date); !runs {
+        return invalidf("Trip %d does not run on %s: %s", o.TripNumber, o.Date, note)
+    }
+    return nil
+}
+
+// PatternRunsOn reports whether the pattern has service on date. Exceptions
+// win over holidays, and holidays run the pattern as on their ServiceAs day.
+func (c *Calendar) PatternRunsOn(p ServicePattern, date ServiceDate) bool {
+    if e, ok := c.exception(p.TripNumber, date); ok {
+        return e.ExceptionType == ServiceAdded
+    }
+    if h, ok := c.holidays[date.String()]; ok {
+        if h.ServiceAs == "" {
+            return false
+        }
+        day, err := parseWeekday(h.ServiceAs)
+        return err == nil && p.RunsOn(day)
+    }
+    return p.RunsOn(date.Weekday())
+}
+
+// Expand is ServicePattern.Expand with holidays and exceptions applied
+func (c *Calendar) Expand(p ServicePattern, from, to ServiceDate) ([]TripOffering, error) {
+    everyDay := p
+    everyDay.DaysOfWeek = weekdayLetters
+    offerings, err := everyDay.Expand(from, to)
+    if err != nil {
+        return []TripOffering{}, err
+    }
+    result := []TripOffering{}
+    for _, o := range offerings {
+        if c.PatternRunsOn(p, o.Date) {
+            result = append(result, o)
+        }
+    }
+    return result, nil
+}
+
+// parseWeekday parses a full or three letter weekday name
+func parseWeekday(s string) (time.Weekday, error) {
+    for d := time.Sunday; d <= time.Saturday; d++ {
+        name := strings.ToLower(d.String())
+        if strings.ToLower(s) == name || strings.ToLower(s) == name[:3] {
+            return d, nil
+        }
+    }
+    return time.Sunday, invalidf("Invalid weekday %q", s)
+}
@@ -0,0 +1,127 @@
+package transit_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+func TestCalendarRules(t *testing.T) {
+	cal := transit.NewCalendar([]transit.Holiday{
+		{Date: mustParseDate(t, "2026-10-20"), HolidayName: "Founders Day"},
+		{Date: mustParseDate(t, "2026-10-21"), HolidayName: "Half Day", ServiceAs: "Sunday"},
+		{Date: mustParseDate(t, "2026-10-24"), HolidayName: "Market Day", ServiceAs: "Friday"},
+		{Date: mustParseDate(t, "2026-10-23"), HolidayName: "Parade"},
+	}, []transit.ServiceException{
+		{TripNumber: 0, Date: mustParseDate(t, "2026-10-22"), ExceptionType: transit.ServiceRemoved, Reason: "storm"},
+		{TripNumber: 1, Date: mustParseDate(t, "2026-10-23"), ExceptionType: transit.ServiceAdded, Reason: "parade shuttle"},
+		{TripNumber: 1, Date: mustParseDate(t, "2026-10-26"), ExceptionType: transit.ServiceRemoved, Reason: "roadworks"},
+	})
+	tests := []struct {
+		date string
+		runs bool
+		note string
+	}{
+		{"2026-10-19", true, ""},
+		{"2026-10-20", false, "Founders Day, no service"},
+		{"2026-10-21", false, "Half Day, Sunday service"},
+		{"2026-10-22", false, "service removed: storm"},
+		{"2026-10-23", true, "service added: parade shuttle"},
+		{"2026-10-24", true, "Market Day, Friday service"},
+		{"2026-10-25", false, ""},
+		{"2026-10-26", false, "service removed: roadworks"},
+	}
+	p := weekdayPattern(t)
+	for _, tt := range tests {
+		date := mustParseDate(t, tt.date)
+		if got := cal.PatternRunsOn(p, date); got != tt.runs {
+			t.Errorf("Pattern runs on %s: %v, want %v", tt.date, got, tt.runs)
+		}
+		if _, note := cal.TripRunsOn(1, date); note != tt.note {
+			t.Errorf("Note for trip 1 on %s %q, want %q", tt.date, note, tt.note)
+		}
+	}
+	// The trip 1 exceptions leave other trips alone
+	if runs, note := cal.TripRunsOn(2, mustParseDate(t, "2026-10-26")); !runs || note != "" {
+		t.Errorf("Trip 2 on 2026-10-26: %v %q, want it to run with no note", runs, note)
+	}
+	offerings, err := cal.Expand(p, mustParseDate(t, "2026-10-19"), mustParseDate(t, "2026-10-26"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := offeringDates(offerings), "2026-10-19 2026-10-23 2026-10-24"; got != want {
+		t.Errorf("Offerings on %q, want %q", got, want)
+	}
+}
+
+func TestCalendarInDatabase(t *testing.T) {
+	db := openMemory(t)
+	for _, err := range []error{
+		db.AddTrip(1, "A", "B"),
+		db.AddBus(0, "Gillig", 2015),
+		db.AddDriver("Ann", "555-0100"),
+		db.AddServicePattern(weekdayPattern(t)),
+		db.AddHoliday(transit.Holiday{Date: mustParseDate(t, "2026-10-20"), HolidayName: "Founders Day"}),
+		db.AddHoliday(transit.Holiday{Date: mustParseDate(t, "2026-10-24"), HolidayName: "Market Day", ServiceAs: "fri"}),
+		db.AddServiceException(transit.ServiceException{TripNumber: 1, Date: mustParseDate(t, "2026-10-22"), ExceptionType: transit.ServiceRemoved, Reason: "roadworks"}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	holidays, err := db.GetHolidayTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holidays) != 2 || holidays[1].ServiceAs != "Friday" {
+		t.Errorf("Holidays %v, want two with the weekday name spelled out", holidays)
+	}
+	added, err := db.GenerateOfferings("weekday", mustParseDate(t, "2026-10-19"), mustParseDate(t, "2026-10-25"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := offeringDates(added), "2026-10-19 2026-10-21 2026-10-23 2026-10-24"; got != want {
+		t.Errorf("Generated offerings on %q, want %q", got, want)
+	}
+
+	invalid := []error{
+		db.AddHoliday(transit.Holiday{HolidayName: "No date"}),
+		db.AddHoliday(transit.Holiday{Date: mustParseDate(t, "2026-12-25"), HolidayName: "Christmas", ServiceAs: "Caturday"}),
+		db.AddServiceException(transit.ServiceException{TripNumber: 1, Date: mustParseDate(t, "2026-12-25"), ExceptionType: "cancelled"}),
+	}
+	for i, err := range invalid {
+		if !errors.Is(err, transit.ErrInvalid) {
+			t.Errorf("Invalid calendar entry %d: got %v, want an invalid input error", i+1, err)
+		}
+	}
+}
+
+func TestDeleteMissingCalendarEntries(t *testing.T) {
+	db := openMemory(t)
+	christmas := mustParseDate(t, "2026-12-25")
+	for _, err := range []error{
+		db.AddTrip(1, "A", "B"),
+		db.AddHoliday(transit.Holiday{Date: christmas, HolidayName: "Christmas"}),
+		db.AddServiceException(transit.ServiceException{TripNumber: 0, Date: christmas, ExceptionType: transit.ServiceRemoved, Reason: "holiday"}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The exception for every trip is not one for trip 1
+	if err := db.DeleteServiceException(1, christmas); !errors.Is(err, transit.ErrNotFound) {
+		t.Errorf("Deleting a missing exception of trip 1 returned %v, want a not found error", err)
+	}
+	for _, del := range []func() error{
+		func() error { return db.DeleteHoliday(christmas) },
+		func() error { return db.DeleteServiceException(0, christmas) },
+	} {
+		if err := del(); err != nil {
+			t.Fatal(err)
+		}
+		if err := del(); !errors.Is(err, transit.ErrNotFound) {
+			t.Errorf("Deleting a calendar entry twice returned %v, want a not found error", err)
+		}
+	}
+}
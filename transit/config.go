@@ -0,0 +1,149 @@
+// Database settings from the environment and a config file
+package transit
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "gopkg.in/yaml.v3"
+)
+
+const (
+    // DefaultConfigPath is read when no config file is named, if it exists
+    DefaultConfigPath = `./transit.yaml`
+
+    EnvConfig      = "TRANSIT_CONFIG"   // config file to read
+    EnvDatabase    = "TRANSIT_DATABASE" // name of the database to open from the config file
+    EnvPath        = "TRANSIT_DB"
+    EnvSchemaPath  = "TRANSIT_SCHEMA"
+    EnvReadOnly    = "TRANSIT_READ_ONLY"
+    EnvInMemory    = "TRANSIT_IN_MEMORY"
+    EnvBusyTimeout = "TRANSIT_BUSY_TIMEOUT"
+    EnvJournalMode = "TRANSIT_JOURNAL_MODE"
+    EnvOnDelete    = "TRANSIT_ON_DELETE"
+)
+
+// Config names databases so a session can switch between them, e.g.
+//
+//  default: prod
+//  databases:
+//    prod:
+//      path: /srv/transit/prod.db
+//      journal_mode: WAL
+//      busy_timeout: 5s
+//      on_delete: retire
+//    training:
+//      path: training.db
+type Config struct {
+    Default   string             `yaml:"default"`
+    Databases map[string]Options `yaml:"databases"`
+}
+
+// LoadConfig reads a YAML (or JSON) config file. Relative database and
+// schema paths are taken from the directory of the file. With an empty path
+// DefaultConfigPath is read if it exists, and otherwise the config is empty.
+func LoadConfig(path string) (Config, error) {
+    c := Config{Databases: map[string]Options{}}
+    if path == "" {
+        path = DefaultConfigPath
+        if _, err := os.Stat(path); os.IsNotExist(err) {
+            return c, nil
+        }
+    }
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return c, err
+    }
+    if err := yaml.Unmarshal(data, &c); err != nil {
+        return c, invalidf("Invalid config file %s: %v", path, err)
+    }
+    if c.Databases == nil {
+        c.Databases = map[string]Options{}
+    }
+    dir := filepath.Dir(path)
+    for name, opts := range c.Databases {
+        if opts.Path != "" && !filepath.IsAbs(opts.Path) {
+            opts.Path = filepath.Join(dir, opts.Path)
+        }
+        if opts.SchemaPath != "" && !filepath.IsAbs(opts.SchemaPath) {
+            opts.SchemaPath = filepath.Join(dir, opts.SchemaPath)
+        }
+        c.Databases[name] = opts
+    }
+    if c.Default != "" {
+        if _, ok := c.Databases[c.Default]; !ok {
+            return c, invalidf("Config file %s sets default database %q which it does not list", path, c.Default)
+        }
+    }
+    return c, nil
+}
+
+// Names returns the names of the configured databases in order
+func (c Config) Names() []string {
+    names := []string{}
+    for name := range c.Databases {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// Lookup returns the options of a named database. The empty name is the
+// default database, which has the default options if the config names none.
+func (c Config) Lookup(name string) (Options, error) {
+    if name == "" {
+        name = c.Default
+    }
+    if name == "" {
+        return Options{}, nil
+    }
+    opts, ok := c.Databases[name]
+    if !ok {
+        if len(c.Databases) == 0 {
+            return opts, invalidf("Unknown database %q, no databases are configured", name)
+        }
+        return opts, invalidf("Unknown database %q, expected one of %s", name, strings.Join(c.Names(), ", "))
+    }
+    return opts, nil
+}
+
+// EnvOptions returns opts with any settings made by environment variables
+func EnvOptions(opts Options) (Options, error) {
+    if v := os.Getenv(EnvPath); v != "" {
+        opts.Path = v
+    }
+    if v := os.Getenv(EnvSchemaPath); v != "" {
+        opts.SchemaPath = v
+    }
+    for _, b := range []struct {
+        name  string
+        value *bool
+    }{{EnvReadOnly, &opts.ReadOnly}, {EnvInMemory, &opts.InMemory}} {
+        if v := os.Getenv(b.name); v != "" {
+            parsed, err := strconv.ParseBool(v)
+            if err != nil {
+                return opts, invalidf("Invalid %s %q, expected true or false", b.name, v)
+            }
+            *b.value = parsed
+        }
+    }
+    if v := os.Getenv(EnvBusyTimeout); v != "" {
+        d, err := time.ParseDuration(v)
+        if err != nil {
+            return opts, invalidf("Invalid %s %q, expected a duration such as 5s", EnvBusyTimeout, v)
+        }
+        opts.BusyTimeout = d
+    }
+    if v := os.Getenv(EnvJournalMode); v != "" {
+        opts.JournalMode = v
+    }
+    if v := os.Getenv(EnvOnDelete); v != "" {
+        opts.OnDelete = v
+    }
+    return opts, nil
+}
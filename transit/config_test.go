@@ -0,0 +1,142 @@
+package transit_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+// setenv sets an environment variable until the test ends
+func setenv(t *testing.T, name, value string) {
+	t.Helper()
+	old, had := os.LookupEnv(name)
+	if err := os.Setenv(name, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if had {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+// writeConfig writes contents to a config file in a new directory
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "transit.yaml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `
+default: prod
+databases:
+  prod:
+    path: /srv/transit/prod.db
+    journal_mode: WAL
+    busy_timeout: 5s
+    on_delete: retire
+  training:
+    path: training.db
+    schema: schema/training.sql
+    read_only: true
+`)
+	c, err := transit.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Names(); !reflect.DeepEqual(got, []string{"prod", "training"}) {
+		t.Errorf("Names %v, want prod and training", got)
+	}
+	prod, err := c.Lookup("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := transit.Options{Path: "/srv/transit/prod.db", JournalMode: "WAL", BusyTimeout: 5 * time.Second, OnDelete: "retire"}
+	if prod != want {
+		t.Errorf("Default database %+v, want %+v", prod, want)
+	}
+	training, err := c.Lookup("training")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(path)
+	want = transit.Options{Path: filepath.Join(dir, "training.db"), SchemaPath: filepath.Join(dir, "schema", "training.sql"), ReadOnly: true}
+	if training != want {
+		t.Errorf("Training database %+v, want paths relative to the config file in %+v", training, want)
+	}
+	if _, err := c.Lookup("staging"); !errors.Is(err, transit.ErrInvalid) {
+		t.Errorf("Looking up a database the config does not list returned %v, want an invalid input error", err)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name, contents string
+	}{
+		{"not YAML", "databases: [prod"},
+		{"unlisted default", "default: staging\ndatabases:\n  prod:\n    path: prod.db\n"},
+		{"bad duration", "databases:\n  prod:\n    busy_timeout: soon\n"},
+	}
+	for _, tt := range tests {
+		if _, err := transit.LoadConfig(writeConfig(t, tt.contents)); !errors.Is(err, transit.ErrInvalid) {
+			t.Errorf("%s: LoadConfig returned %v, want an invalid input error", tt.name, err)
+		}
+	}
+	if _, err := transit.LoadConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("Loaded a config file that does not exist")
+	}
+	// With no databases configured the default is the built-in options
+	c, err := transit.LoadConfig(writeConfig(t, "{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts, err := c.Lookup(""); err != nil || opts != (transit.Options{}) {
+		t.Errorf("Default of an empty config %+v, %v, want the zero options", opts, err)
+	}
+}
+
+func TestEnvOptions(t *testing.T) {
+	base := transit.Options{Path: "config.db", JournalMode: "WAL", BusyTimeout: time.Second}
+	for _, name := range []string{transit.EnvPath, transit.EnvSchemaPath, transit.EnvReadOnly, transit.EnvInMemory, transit.EnvBusyTimeout, transit.EnvJournalMode, transit.EnvOnDelete} {
+		setenv(t, name, "")
+	}
+	if opts, err := transit.EnvOptions(base); err != nil || opts != base {
+		t.Errorf("Options with no variables set %+v, %v, want %+v", opts, err, base)
+	}
+
+	setenv(t, transit.EnvPath, "env.db")
+	setenv(t, transit.EnvReadOnly, "1")
+	setenv(t, transit.EnvBusyTimeout, "250ms")
+	setenv(t, transit.EnvOnDelete, "cascade")
+	opts, err := transit.EnvOptions(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := transit.Options{Path: "env.db", ReadOnly: true, JournalMode: "WAL", BusyTimeout: 250 * time.Millisecond, OnDelete: "cascade"}
+	if opts != want {
+		t.Errorf("Options %+v, want the variables to override the config in %+v", opts, want)
+	}
+
+	for _, bad := range []struct{ name, value string }{
+		{transit.EnvInMemory, "maybe"},
+		{transit.EnvBusyTimeout, "5"},
+	} {
+		setenv(t, bad.name, bad.value)
+		if _, err := transit.EnvOptions(base); !errors.Is(err, transit.ErrInvalid) {
+			t.Errorf("%s=%s: EnvOptions returned %v, want an invalid input error", bad.name, bad.value, err)
+		}
+		setenv(t, bad.name, "")
+	}
+}
@@ -0,0 +1,159 @@
+// Driver and bus double-booking detection for trip offerings
+package transit
+
+import (
+    "fmt"
+)
+
+const (
+    selectOfferingByKey     = selectTripOfferings + ` WHERE TripNumber = ? AND Date = ? AND ScheduledStartTime = ?`
+    selectOfferingsByDayUse = selectTripOfferings + ` WHERE Date >= ? AND Date < ? AND (DriverName = ? OR BusID = ?) AND NOT (TripNumber = ? AND Date = ? AND ScheduledStartTime = ?)`
+)
+
+// conflictDays is how many days either side of its date an offering can
+// overlap others. Times run to 47:59 and arrivals can fall on the next day,
+// so a window can reach two days past the start of its service day.
+const conflictDays = 2
+
+// ConflictError reports an offering whose driver or bus is already assigned
+// to another offering during an overlapping time window
+type ConflictError struct {
+    Resource string       // "driver" or "bus"
+    Offering TripOffering // the offering being scheduled
+    Existing TripOffering // the offering it clashes with
+}
+
+func (c *ConflictError) Error() string {
+    who := fmt.Sprintf("Bus %s", BusText(c.Offering.BusID))
+    if c.Resource == "driver" {
+        who = fmt.Sprintf("Driver %s", c.Offering.DriverName)
+    }
+    return fmt.Sprintf("%s is already assigned to trip %d on %s from %s to %s", who, c.Existing.TripNumber, c.Existing.Date, c.Existing.ScheduledStartTime, c.Existing.ScheduledArrivalTime)
+}
+
+// Override returns a handle on the same database that accepts double-bookings,
+// passing each conflict to warn instead of rejecting the change
+func (db *Database) Override(warn func(*ConflictError)) *Database {
+    o := *db
+    o.onConflict = warn
+    return &o
+}
+
+// FindConflicts returns every offering that shares a driver or bus with o and
+// overlaps its scheduled window, including offerings of the days around its
+// date that run past midnight
+func (db *Database) FindConflicts(o TripOffering) ([]*ConflictError, error) {
+    conflicts := []*ConflictError{}
+    start, end, err := offeringWindow(o)
+    if err != nil {
+        return conflicts, err
+    }
+    row, err := db.query(selectOfferingsByDayUse, o.Date.AddDays(-conflictDays), o.Date.AddDays(conflictDays+1), o.DriverName, o.BusID, o.TripNumber, o.Date, o.ScheduledStartTime)
+    if err != nil {
+        return conflicts, err
+    }
+    defer row.Close()
+    return findConflicts(o, start, end, RowToTripOfferings(row)), nil
+}
+
+// findConflicts returns the conflicts between o, scheduled from start to end,
+// and others, the offerings within conflictDays of its date that share its
+// driver or bus
+func findConflicts(o TripOffering, start, end int, others []TripOffering) []*ConflictError {
+    conflicts := []*ConflictError{}
+    for _, other := range others {
+        otherStart, otherEnd, err := offeringWindow(other)
+        if err != nil {
+            // Rows entered before times were validated cannot be compared
+            continue
+        }
+        // Measure both windows from the start of o's service day
+        shift := other.Date.DaysSince(o.Date) * 24 * 60
+        otherStart, otherEnd = otherStart+shift, otherEnd+shift
+        if start >= otherEnd || otherStart >= end {
+            continue
+        }
+        if other.DriverName == o.DriverName {
+            conflicts = append(conflicts, &ConflictError{Resource: "driver", Offering: o, Existing: other})
+        }
+        if sharesBus(other, o) {
+            conflicts = append(conflicts, &ConflictError{Resource: "bus", Offering: o, Existing: other})
+        }
+    }
+    return conflicts
+}
+
+// sharesBus reports whether a and b are assigned the same bus. Offerings
+// without a bus never share one.
+func sharesBus(a, b TripOffering) bool {
+    return b.BusID != nil && a.HasBus(*b.BusID)
+}
+
+// checkConflicts rejects o if it double-books a driver or bus, unless the
+// handle was created by Override. If resources are given only conflicts on
+// those resources are considered.
+func (db *Database) checkConflicts(o TripOffering, resources ...string) error {
+    found, err := db.FindConflicts(o)
+    if err != nil {
+        return err
+    }
+    return resolveConflicts(found, db.onConflict, resources)
+}
+
+// resolveConflicts returns the first of the conflicts on the given resources,
+// or passes them all to onConflict if it is set
+func resolveConflicts(found []*ConflictError, onConflict func(*ConflictError), resources []string) error {
+    conflicts := []*ConflictError{}
+    for _, c := range found {
+        if len(resources) == 0 || containsString(resources, c.Resource) {
+            conflicts = append(conflicts, c)
+        }
+    }
+    if len(conflicts) == 0 {
+        return nil
+    }
+    if onConflict == nil {
+        return conflicts[0]
+    }
+    for _, c := range conflicts {
+        onConflict(c)
+    }
+    return nil
+}
+
+// GetOffering returns the offering with the given composite key
+func (db *Database) GetOffering(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay) (TripOffering, error) {
+    row, err := db.query(selectOfferingByKey, tripNumber, date, scheduledStartTime)
+    if err != nil {
+        return TripOffering{}, err
+    }
+    defer row.Close()
+    offerings := RowToTripOfferings(row)
+    if len(offerings) == 0 {
+        return TripOffering{}, fmt.Errorf("No offering for trip %d on %s at %s: %w", tripNumber, date, scheduledStartTime, ErrNotFound)
+    }
+    return offerings[0], nil
+}
+
+// offeringWindow returns the scheduled start and arrival of o in minutes after
+// the start of its service day. An arrival earlier than the start is taken
+// to be on the next day.
+func offeringWindow(o TripOffering) (int, int, error) {
+    if o.ScheduledStartTime.IsZero() || o.ScheduledArrivalTime.IsZero() {
+        return 0, 0, invalidf("Trip %d needs a scheduled start and arrival time", o.TripNumber)
+    }
+    start, end := o.ScheduledStartTime.Minutes(), o.ScheduledArrivalTime.Minutes()
+    if end < start {
+        end += 24 * 60
+    }
+    return start, end, nil
+}
+
+func containsString(list []string, s string) bool {
+    for _, el := range list {
+        if el == s {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,76 @@
+package transit_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+// backends returns a new store of each kind, closed when the test ends
+func backends(t *testing.T) map[string]transit.Store {
+	t.Helper()
+	return map[string]transit.Store{
+		"memory": transit.NewMemoryStore(),
+		"sqlite": openMemory(t),
+	}
+}
+
+func TestConflictsAcrossMidnight(t *testing.T) {
+	type offering struct {
+		date, start, arrival, driver string
+		bus                          int
+	}
+	tests := []struct {
+		name     string
+		first    offering
+		second   offering
+		conflict string // the resource the second offering clashes on, if any
+	}{
+		{"bus past 24:00 and early next day",
+			offering{"2026-10-19", "25:10", "26:00", "Ann", 6}, offering{"2026-10-20", "01:30", "01:45", "Bob", 6}, "bus"},
+		{"driver arriving after midnight",
+			offering{"2026-10-19", "23:30", "00:30", "O'Brien", 6}, offering{"2026-10-20", "00:10", "00:20", "O'Brien", 7}, "driver"},
+		{"earlier day added second",
+			offering{"2026-10-20", "00:10", "00:20", "O'Brien", 6}, offering{"2026-10-19", "23:30", "00:30", "O'Brien", 7}, "driver"},
+		{"next day after the arrival",
+			offering{"2026-10-19", "25:10", "26:00", "Ann", 6}, offering{"2026-10-20", "02:00", "02:30", "Ann", 6}, ""},
+		{"day after next",
+			offering{"2026-10-19", "23:30", "00:30", "Ann", 6}, offering{"2026-10-21", "00:10", "00:20", "Ann", 6}, ""},
+	}
+	for _, tt := range tests {
+		for name, store := range backends(t) {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				for _, err := range []error{
+					store.AddTrip(1, "A", "B"),
+					store.AddTrip(2, "B", "A"),
+					store.AddBus(6, "Gillig", 2015),
+					store.AddBus(7, "Gillig", 2015),
+					store.AddDriver("Ann", "555-0100"),
+					store.AddDriver("Bob", "555-0101"),
+					store.AddDriver("O'Brien", "555-0102"),
+				} {
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+				add := func(trip int, o offering) error {
+					return store.AddOffering(trip, mustParseDate(t, o.date), mustParseTime(t, o.start), mustParseTime(t, o.arrival), o.driver, o.bus)
+				}
+				if err := add(1, tt.first); err != nil {
+					t.Fatal(err)
+				}
+				err := add(2, tt.second)
+				var conflict *transit.ConflictError
+				switch {
+				case tt.conflict == "" && err != nil:
+					t.Errorf("Got %v, want no conflict", err)
+				case tt.conflict != "" && !errors.As(err, &conflict):
+					t.Errorf("Got %v, want a conflict on the %s", err, tt.conflict)
+				case tt.conflict != "" && conflict.Resource != tt.conflict:
+					t.Errorf("Got a conflict on the %s, want one on the %s", conflict.Resource, tt.conflict)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,415 @@
+// CSV import and export of the core tables
+package transit
+
+import (
+    "encoding/csv"
+    "fmt"
+    "io"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// CSVMode selects what ImportCSV does with rows that cannot be imported
+type CSVMode int
+
+const (
+    // CSVAllOrNothing imports nothing unless every row can be imported
+    CSVAllOrNothing CSVMode = iota
+    // CSVSkipBadRows imports the good rows and reports the rest
+    CSVSkipBadRows
+)
+
+// CSVRowError reports a row that could not be imported
+type CSVRowError struct {
+    Line int
+    Err  error
+}
+
+func (e CSVRowError) Error() string {
+    return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// CSVImportResult summarises an import
+type CSVImportResult struct {
+    Imported int
+    Errors   []CSVRowError
+}
+
+// csvCodec converts the rows of one table to and from CSV records whose
+// columns are named after the entity's fields. Optional columns, added to
+// the table after its CSV form was first written, may be left out of an
+// import and are then empty.
+type csvCodec struct {
+    columns  []string
+    optional []string
+    rows     func(db *Database) ([][]string, error)
+    parse    func(r csvRecord) (interface{}, error)
+}
+
+// csvCodecs is keyed by the table names used by the display command
+var csvCodecs = map[string]csvCodec{
+    "trip": {
+        columns: []string{"TripNumber", "StartLocationName", "DestinationName"},
+        rows: func(db *Database) ([][]string, error) {
+            table, err := db.GetTripTable()
+            result := [][]string{}
+            for _, t := range table {
+                result = append(result, []string{strconv.Itoa(t.TripNumber), t.StartLocationName, t.DestinationName})
+            }
+            return result, err
+        },
+        parse: func(r csvRecord) (interface{}, error) {
+            t := Trip{StartLocationName: r.get("StartLocationName"), DestinationName: r.get("DestinationName")}
+            return t, r.int("TripNumber", &t.TripNumber)
+        },
+    },
+    "offering": {
+        columns: []string{"TripNumber", "Date", "ScheduledStartTime", "ScheduledArrivalTime", "DriverName", "BusID"},
+        rows: func(db *Database) ([][]string, error) {
+            table, err := db.GetTripOfferingTable()
+            result := [][]string{}
+            for _, o := range table {
+                result = append(result, []string{strconv.Itoa(o.TripNumber), o.Date.String(), o.ScheduledStartTime.String(), o.ScheduledArrivalTime.String(), o.DriverName, busColumn(o.BusID)})
+            }
+            return result, err
+        },
+        parse: func(r csvRecord) (interface{}, error) {
+            o := TripOffering{DriverName: r.get("DriverName")}
+            if err := r.int("TripNumber", &o.TripNumber); err != nil {
+                return o, err
+            }
+            if err := r.optionalInt("BusID", &o.BusID); err != nil {
+                return o, err
+            }
+            if err := r.date("Date", &o.Date); err != nil {
+                return o, err
+            }
+            if err := r.times([]string{"ScheduledStartTime", "ScheduledArrivalTime"}, &o.ScheduledStartTime, &o.ScheduledArrivalTime); err != nil {
+                return o, err
+            }
+            _, _, err := offeringWindow(o)
+            return o, err
+        },
+    },
+    "bus": {
+        columns:  []string{"BusID", "Model", "Year", "RetiredOn"},
+        optional: []string{"RetiredOn"},
+        rows: func(db *Database) ([][]string, error) {
+            table, err := db.GetBusTable()
+            result := [][]string{}
+            for _, b := range table {
+                result = append(result, []string{strconv.Itoa(b.BusID), b.Model, strconv.Itoa(b.Year), b.RetiredOn.String()})
+            }
+            return result, err
+        },
+        parse: func(r csvRecord) (interface{}, error) {
+            b := Bus{Model: r.get("Model")}
+            if err := r.ints([]string{"BusID", "Year"}, &b.BusID, &b.Year); err != nil {
+                return b, err
+            }
+            return b, r.optionalDate("RetiredOn", &b.RetiredOn)
+        },
+    },
+    "driver": {
+        columns:  []string{"DriverName", "DriverTelephoneNumber", "RetiredOn"},
+        optional: []string{"RetiredOn"},
+        rows: func(db *Database) ([][]string, error) {
+            table, err := db.GetDriverTable()
+            result := [][]string{}
+            for _, d := range table {
+                result = append(result, []string{d.DriverName, d.DriverTelephoneNumber, d.RetiredOn.String()})
+            }
+            return result, err
+        },
+        parse: func(r csvRecord) (interface{}, error) {
+            d := Driver{DriverName: r.get("DriverName"), DriverTelephoneNumber: r.get("DriverTelephoneNumber")}
+            if d.DriverName == "" {
+                return d, invalidf("DriverName is required")
+            }
+            return d, r.optionalDate("RetiredOn", &d.RetiredOn)
+        },
+    },
+    "stop": {
+        columns: []string{"StopNumber", "StopAddress"},
+        rows: func(db *Database) ([][]string, error) {
+            table, err := db.GetStopTable()
+            result := [][]string{}
+            for _, s := range table {
+                result = append(result, []string{strconv.Itoa(s.StopNumber), s.StopAddress})
+            }
+            return result, err
+        },
+        parse: func(r csvRecord) (interface{}, error) {
+            s := Stop{StopAddress: r.get("StopAddress")}
+            return s, r.int("StopNumber", &s.StopNumber)
+        },
+    },
+    "actualinfo": {
+        columns: []string{"TripNumber", "Date", "ScheduledStartTime", "StopNumber", "ScheduledArrivalTime", "ActualStartTime", "ActualArrivalTime", "NumberOfPassengerIn", "NumberOfPassengerOut"},
+        rows: func(db *Database) ([][]string, error) {
+            table, err := db.GetActualTripStopInfoTable()
+            result := [][]string{}
+            for _, a := range table {
+                result = append(result, []string{strconv.Itoa(a.TripNumber), a.Date.String(), a.ScheduledStartTime.String(), strconv.Itoa(a.StopNumber), a.ScheduledArrivalTime.String(), a.ActualStartTime.String(), a.ActualArrivalTime.String(), strconv.Itoa(a.NumberOfPassengerIn), strconv.Itoa(a.NumberOfPassengerOut)})
+            }
+            return result, err
+        },
+        parse: func(r csvRecord) (interface{}, error) {
+            a := ActualTripStopInfo{}
+            if err := r.ints([]string{"TripNumber", "StopNumber", "NumberOfPassengerIn", "NumberOfPassengerOut"}, &a.TripNumber, &a.StopNumber, &a.NumberOfPassengerIn, &a.NumberOfPassengerOut); err != nil {
+                return a, err
+            }
+            if err := r.times([]string{"ScheduledStartTime", "ScheduledArrivalTime", "ActualStartTime", "ActualArrivalTime"}, &a.ScheduledStartTime, &a.ScheduledArrivalTime, &a.ActualStartTime, &a.ActualArrivalTime); err != nil {
+                return a, err
+            }
+            return a, r.date("Date", &a.Date)
+        },
+    },
+    "stopinfo": {
+        columns: []string{"TripNumber", "StopNumber", "SequenceNumber", "DrivingTime"},
+        rows: func(db *Database) ([][]string, error) {
+            table, err := db.GetTripStopInfoTable()
+            result := [][]string{}
+            for _, t := range table {
+                result = append(result, []string{strconv.Itoa(t.TripNumber), strconv.Itoa(t.StopNumber), strconv.Itoa(t.SequenceNumber), strconv.FormatFloat(float64(t.DrivingTime), 'f', 1, 32)})
+            }
+            return result, err
+        },
+        parse: func(r csvRecord) (interface{}, error) {
+            t := TripStopInfo{}
+            if err := r.ints([]string{"TripNumber", "StopNumber", "SequenceNumber"}, &t.TripNumber, &t.StopNumber, &t.SequenceNumber); err != nil {
+                return t, err
+            }
+            drivingTime, err := strconv.ParseFloat(r.get("DrivingTime"), 32)
+            if err != nil {
+                return t, invalidf("Invalid DrivingTime %q, expected a number of minutes", r.get("DrivingTime"))
+            }
+            t.DrivingTime = float32(drivingTime)
+            return t, nil
+        },
+    },
+}
+
+// CSVTables returns the names of the tables that can be imported and exported
+func CSVTables() []string {
+    names := []string{}
+    for name := range csvCodecs {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+func getCodec(table string) (csvCodec, error) {
+    codec, ok := csvCodecs[table]
+    if !ok {
+        return codec, invalidf("Unknown table %q, expected one of %s", table, strings.Join(CSVTables(), ", "))
+    }
+    return codec, nil
+}
+
+// ExportCSV writes every row of the table to w with a header line
+func (db *Database) ExportCSV(table string, w io.Writer) error {
+    codec, err := getCodec(table)
+    if err != nil {
+        return err
+    }
+    rows, err := codec.rows(db)
+    if err != nil {
+        return err
+    }
+    cw := csv.NewWriter(w)
+    cw.Write(codec.columns)
+    cw.WriteAll(rows)
+    return cw.Error()
+}
+
+// ImportCSV inserts the rows read from r into the table. The header must name
+// every column of the table but the optional ones, in any order, and nothing
+// else. Rows are
+// inserted in one transaction; in CSVAllOrNothing mode it is rolled back if
+// any row is bad, in CSVSkipBadRows mode bad rows are left out. An offering
+// on a date the calendar says its trip does not run is a bad row; otherwise
+// offerings are stored as given, as by InsertDataset.
+func (db *Database) ImportCSV(table string, r io.Reader, mode CSVMode) (CSVImportResult, error) {
+    result := CSVImportResult{Errors: []CSVRowError{}}
+    codec, err := getCodec(table)
+    if err != nil {
+        return result, err
+    }
+    cr := csv.NewReader(r)
+    cr.FieldsPerRecord = -1
+    header, err := cr.Read()
+    if err == io.EOF {
+        return result, invalidf("Empty CSV file, expected a header of %s", strings.Join(codec.columns, ","))
+    }
+    if err != nil {
+        return result, err
+    }
+    columns, err := checkHeader(header, codec.columns, codec.optional)
+    if err != nil {
+        return result, err
+    }
+    err = db.WithTx(func(tx *Database) error {
+        cal, err := tx.GetCalendar()
+        if err != nil {
+            return err
+        }
+        // Lines are counted by record, so fields spanning lines throw the count off
+        line := 1
+        for {
+            record, err := cr.Read()
+            if err == io.EOF {
+                break
+            }
+            line++
+            if err != nil {
+                perr, ok := err.(*csv.ParseError)
+                if !ok {
+                    return err
+                }
+                line = perr.Line
+                result.Errors = append(result.Errors, CSVRowError{Line: line, Err: perr.Err})
+                continue
+            }
+            if len(record) != len(header) {
+                result.Errors = append(result.Errors, CSVRowError{Line: line, Err: invalidf("Expected %d fields, got %d", len(header), len(record))})
+                continue
+            }
+            row, err := codec.parse(csvRecord{columns: columns, fields: record})
+            if o, ok := row.(TripOffering); ok && err == nil {
+                err = cal.checkOffering(o)
+            }
+            if err == nil {
+                err = tx.insertRow(row)
+            }
+            if err != nil {
+                result.Errors = append(result.Errors, CSVRowError{Line: line, Err: err})
+                continue
+            }
+            result.Imported++
+        }
+        if len(result.Errors) > 0 && mode == CSVAllOrNothing {
+            result.Imported = 0
+            return fmt.Errorf("%d bad rows in %s CSV, nothing imported", len(result.Errors), table)
+        }
+        return nil
+    })
+    return result, err
+}
+
+// checkHeader returns the position of each expected column in header. Only
+// the optional ones may be missing.
+func checkHeader(header []string, expected []string, optional []string) (map[string]int, error) {
+    columns := make(map[string]int)
+    for i, h := range header {
+        h = strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))
+        if !containsString(expected, h) {
+            return nil, invalidf("Unknown column %q, expected %s", h, strings.Join(expected, ","))
+        }
+        if _, ok := columns[h]; ok {
+            return nil, invalidf("Column %q appears more than once", h)
+        }
+        columns[h] = i
+    }
+    for _, c := range expected {
+        if _, ok := columns[c]; !ok && !containsString(optional, c) {
+            return nil, invalidf("Missing column %q, expected %s", c, strings.Join(expected, ","))
+        }
+    }
+    return columns, nil
+}
+
+// csvRecord is a CSV line whose fields are looked up by column name
+type csvRecord struct {
+    columns map[string]int
+    fields  []string
+}
+
+// get returns the named field, or "" if the header left the column out
+func (r csvRecord) get(column string) string {
+    i, ok := r.columns[column]
+    if !ok {
+        return ""
+    }
+    return strings.TrimSpace(r.fields[i])
+}
+
+// int parses the named column into field, leaving it 0 when the column is empty
+func (r csvRecord) int(column string, field *int) error {
+    s := r.get(column)
+    if s == "" {
+        return nil
+    }
+    n, err := strconv.Atoi(s)
+    if err != nil {
+        return invalidf("Invalid %s %q, expected a whole number", column, s)
+    }
+    *field = n
+    return nil
+}
+
+// ints parses each of the named columns into the matching field
+func (r csvRecord) ints(columns []string, fields ...*int) error {
+    for i, column := range columns {
+        if err := r.int(column, fields[i]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// optionalInt parses the named column into field, leaving it nil when the
+// column is empty
+func (r csvRecord) optionalInt(column string, field **int) error {
+    if r.get(column) == "" {
+        *field = nil
+        return nil
+    }
+    var n int
+    if err := r.int(column, &n); err != nil {
+        return err
+    }
+    *field = &n
+    return nil
+}
+
+// date parses the named column into field, which is required
+func (r csvRecord) date(column string, field *ServiceDate) error {
+    d, err := ParseServiceDate(r.get(column))
+    if err != nil {
+        return invalidf("Invalid %s %q, expected YYYY-MM-DD", column, r.get(column))
+    }
+    *field = d
+    return nil
+}
+
+// optionalDate parses the named column into field, leaving it unset when the
+// column is empty
+func (r csvRecord) optionalDate(column string, field *ServiceDate) error {
+    if err := field.UnmarshalText([]byte(r.get(column))); err != nil {
+        return invalidf("Invalid %s %q, expected YYYY-MM-DD", column, r.get(column))
+    }
+    return nil
+}
+
+// times parses each of the named columns into the matching field, leaving
+// it unset when the column is empty
+func (r csvRecord) times(columns []string, fields ...*TimeOfDay) error {
+    for i, column := range columns {
+        if err := fields[i].UnmarshalText([]byte(r.get(column))); err != nil {
+            return invalidf("Invalid %s %q, expected HH:MM", column, r.get(column))
+        }
+    }
+    return nil
+}
+
+// busColumn writes an offering's BusID, leaving the column empty when no bus
+// is assigned
+func busColumn(busID *int) string {
+    if busID == nil {
+        return ""
+    }
+    return strconv.Itoa(*busID)
+}
@@ -0,0 +1,148 @@
+package transit_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+func TestCSVKeepsRetirement(t *testing.T) {
+	db := openMemory(t)
+	retired := mustParseDate(t, "2026-10-19")
+	for _, err := range []error{
+		db.AddBus(1, "Gillig", 2015),
+		db.AddBus(2, "New Flyer", 2020),
+		db.AddDriver("O'Brien", "555-0100"),
+		db.AddDriver("Ann", "555-0101"),
+		db.RetireBus(1, retired),
+		db.RetireDriver("O'Brien", retired),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	imported := openMemory(t)
+	for _, table := range []string{"bus", "driver"} {
+		var buf bytes.Buffer
+		if err := db.ExportCSV(table, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := imported.ImportCSV(table, &buf, transit.CSVAllOrNothing); err != nil {
+			t.Fatalf("Importing the %s CSV: %v", table, err)
+		}
+	}
+	buses, err := imported.GetBusTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buses) != 2 || !buses[0].RetiredOn.Equal(retired) || !buses[1].RetiredOn.IsZero() {
+		t.Errorf("Imported buses %v, want only bus 1 retired on %s", buses, retired)
+	}
+	drivers, err := imported.GetDriverTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range drivers {
+		want := transit.ServiceDate{}
+		if d.DriverName == "O'Brien" {
+			want = retired
+		}
+		if !d.RetiredOn.Equal(want) {
+			t.Errorf("Imported driver %v, want only O'Brien retired on %s", d, retired)
+		}
+	}
+}
+
+func TestCSVWithoutRetirementColumn(t *testing.T) {
+	db := openMemory(t)
+	result, err := db.ImportCSV("bus", strings.NewReader("BusID,Model,Year\n1,Gillig,2015\n"), transit.CSVAllOrNothing)
+	if err != nil || result.Imported != 1 {
+		t.Fatalf("Importing a bus CSV from before retirement: %v, %v", result, err)
+	}
+	buses, err := db.GetBusTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buses) != 1 || buses[0].Model != "Gillig" || !buses[0].RetiredOn.IsZero() {
+		t.Errorf("Imported buses %v, want bus 1 in service", buses)
+	}
+	if _, err := db.ImportCSV("driver", strings.NewReader("DriverName,RetiredOn\nAnn,\n"), transit.CSVAllOrNothing); err == nil {
+		t.Error("Imported a driver CSV without the DriverTelephoneNumber column")
+	}
+}
+
+func TestCSVKeepsBusZero(t *testing.T) {
+	db := openMemory(t)
+	for _, err := range []error{
+		db.AddTrip(1, "Pomona", "Ontario"),
+		db.AddBus(0, "Gillig", 2015),
+		db.AddDriver("Ann", "555-0101"),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	offerings := "TripNumber,Date,ScheduledStartTime,ScheduledArrivalTime,DriverName,BusID\n" +
+		"1,2026-10-19,08:00,09:00,Ann,0\n" +
+		"1,2026-10-19,10:00,11:00,Ann,\n"
+	if _, err := db.ImportCSV("offering", strings.NewReader(offerings), transit.CSVAllOrNothing); err != nil {
+		t.Fatal(err)
+	}
+	table, err := db.GetTripOfferingTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table) != 2 || !table[0].HasBus(0) || table[1].BusID != nil {
+		t.Fatalf("Imported offerings %v, want bus 0 and then no bus", table)
+	}
+	if err := db.DeleteBus(0); !transit.IsConstraint(err) {
+		t.Errorf("DeleteBus(0) with an offering assigned: got %v, want a constraint error", err)
+	}
+	var buf bytes.Buffer
+	if err := db.ExportCSV("offering", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != offerings {
+		t.Errorf("Exported offerings:\n%s\nwant:\n%s", got, offerings)
+	}
+}
+
+func TestCSVOfferingsFollowCalendar(t *testing.T) {
+	db := openMemory(t)
+	for _, err := range []error{
+		db.AddTrip(1, "Pomona", "Ontario"),
+		db.AddTrip(2, "Ontario", "Pomona"),
+		db.AddHoliday(transit.Holiday{Date: mustParseDate(t, "2026-12-25"), HolidayName: "Christmas"}),
+		db.AddServiceException(transit.ServiceException{TripNumber: 2, Date: mustParseDate(t, "2026-10-19"), ExceptionType: transit.ServiceRemoved, Reason: "roadworks"}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	offerings := "TripNumber,Date,ScheduledStartTime,ScheduledArrivalTime,DriverName,BusID\n" +
+		"1,2026-10-19,08:00,09:00,,\n" +
+		"2,2026-10-19,10:00,11:00,,\n" +
+		"1,2026-12-25,08:00,09:00,,\n"
+	result, err := db.ImportCSV("offering", strings.NewReader(offerings), transit.CSVAllOrNothing)
+	if err == nil || len(result.Errors) != 2 {
+		t.Fatalf("Importing offerings on days without service: %v, %v, want two bad rows", result, err)
+	}
+	for i, want := range []string{"Trip 2 does not run on 2026-10-19: service removed: roadworks", "Trip 1 does not run on 2026-12-25: Christmas, no service"} {
+		if e := result.Errors[i]; e.Line != i+3 || !strings.Contains(e.Err.Error(), want) {
+			t.Errorf("Bad row %v, want line %d to say %q", e, i+3, want)
+		}
+	}
+	result, err = db.ImportCSV("offering", strings.NewReader(offerings), transit.CSVSkipBadRows)
+	if err != nil || result.Imported != 1 {
+		t.Fatalf("Importing offerings skipping bad rows: %v, %v, want one imported", result, err)
+	}
+	table, err := db.GetTripOfferingTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table) != 1 || table[0].TripNumber != 1 || table[0].Date.String() != "2026-10-19" {
+		t.Errorf("Imported offerings %v, want only trip 1 on 2026-10-19", table)
+	}
+}
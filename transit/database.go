@@ -3,21 +3,46 @@ package transit
 
 import (
     "database/sql"
+    "errors"
     "fmt"
     _ "github.com/mattn/go-sqlite3"
-    "io/ioutil"
     "log"
     "os"
+    "strconv"
     "strings"
+    "sync/atomic"
     "time"
 )
 
 const (
     DATABASE_PATH = `./Lab4.db`
-    SCHEMA_PATH   = `./lab4_create-tables.sql`
-    DATE_FORMAT   = "2020-01-02"
+    DATE_FORMAT   = serviceDateLayout
 )
 
+// ErrNotFound is returned when a row addressed by its key does not exist
+var ErrNotFound = errors.New("Not found")
+
+// ErrInvalid is matched, using errors.Is, by errors reporting malformed input
+var ErrInvalid = errors.New("Invalid input")
+
+// invalidError is an input validation error that matches ErrInvalid
+type invalidError struct {
+    msg string
+}
+
+func (e invalidError) Error() string {
+    return e.msg
+}
+
+func (e invalidError) Is(target error) bool {
+    return target == ErrInvalid
+}
+
+// invalidf formats a validation error
+func invalidf(format string, args ...interface{}) error {
+    return invalidError{fmt.Sprintf(format, args...)}
+}
+
 type Trip struct {
     TripNumber        int
     StartLocationName string
@@ -30,34 +55,63 @@ func (t Trip) String() string {
 
 type TripOffering struct {
     TripNumber           int
-    Date                 string
-    ScheduledStartTime   string
-    ScheduledArrivalTime string
+    Date                 ServiceDate
+    ScheduledStartTime   TimeOfDay
+    ScheduledArrivalTime TimeOfDay
     DriverName           string
-    BusID                int
+    BusID                *int // nil while no bus is assigned
 }
 
 func (t TripOffering) String() string {
-    return fmt.Sprintf("TripNumber: %d\nDate: %s\nScheduledStartTime: %s\nSchedu.SpririvalTime: %s\nDriverName: %s\nBusID: %d", t.TripNumber, t.Date, t.ScheduledStartTime, t.ScheduledArrivalTime, t.DriverName, t.BusID)
+    return fmt.Sprintf("TripNumber: %d\nDate: %s\nScheduledStartTime: %s\nSchedu.SpririvalTime: %s\nDriverName: %s\nBusID: %s", t.TripNumber, t.Date, t.ScheduledStartTime, t.ScheduledArrivalTime, t.DriverName, BusText(t.BusID))
+}
+
+// HasBus reports whether busID is the bus assigned to the offering
+func (t TripOffering) HasBus(busID int) bool {
+    return t.BusID != nil && *t.BusID == busID
+}
+
+// sameBus reports whether two offerings' BusIDs are the same bus, or both
+// unassigned
+func sameBus(a, b *int) bool {
+    if a == nil || b == nil {
+        return a == b
+    }
+    return *a == *b
+}
+
+// BusText formats an offering's BusID, or "none" when no bus is assigned
+func BusText(busID *int) string {
+    if busID == nil {
+        return "none"
+    }
+    return strconv.Itoa(*busID)
+}
+
+// BusRef returns busID as an offering's BusID
+func BusRef(busID int) *int {
+    return &busID
 }
 
 type Bus struct {
-    BusID int
-    Model string
-    Year  int
+    BusID     int
+    Model     string
+    Year      int
+    RetiredOn ServiceDate // zero while the bus is in service
 }
 
 func (b Bus) String() string {
-    return fmt.Sprintf("BusID: %d\nModel: %s\nYear: %d", b.BusID, b.Model, b.Year)
+    return fmt.Sprintf("BusID: %d\nModel: %s\nYear: %d\nRetiredOn: %s", b.BusID, b.Model, b.Year, b.RetiredOn)
 }
 
 type Driver struct {
     DriverName            string
     DriverTelephoneNumber string
+    RetiredOn             ServiceDate // zero while the driver is in service
 }
 
 func (d Driver) String() string {
-    return fmt.Sprintf("DriverName: %s\nDriverTelephoneNumber: %s", d.DriverName, d.DriverTelephoneNumber)
+    return fmt.Sprintf("DriverName: %s\nDriverTelephoneNumber: %s\nRetiredOn: %s", d.DriverName, d.DriverTelephoneNumber, d.RetiredOn)
 }
 
 type Stop struct {
@@ -71,12 +125,12 @@ func (s Stop) String() string {
 
 type ActualTripStopInfo struct {
     TripNumber           int
-    Date                 string
-    ScheduledStartTime   string
+    Date                 ServiceDate
+    ScheduledStartTime   TimeOfDay
     StopNumber           int
-    ScheduledArrivalTime string
-    ActualStartTime      string
-    ActualArrivalTime    string
+    ScheduledArrivalTime TimeOfDay
+    ActualStartTime      TimeOfDay
+    ActualArrivalTime    TimeOfDay
     NumberOfPassengerIn  int
     NumberOfPassengerOut int
 }
@@ -93,50 +147,119 @@ type TripStopInfo struct {
 }
 
 func (t TripStopInfo) String() string {
-    return fmt.Sprintf("TripNumber: %d\nStopNumber: %d\nSequenceNumber: %d\nDrivingTime: %d")
+    return fmt.Sprintf("TripNumber: %d\nStopNumber: %d\nSequenceNumber: %d\nDrivingTime: %.1f", t.TripNumber, t.StopNumber, t.SequenceNumber, t.DrivingTime)
 }
 
 type Database struct {
     *sql.DB
+    stmts      *stmtCache
+    onConflict func(*ConflictError) // nil rejects double-bookings
+    tx         *sql.Tx                // set on handles from StartTx, which run every statement in it
+    operator   string                 // who the audit log records as making changes
+    onDelete   DeletePolicy           // what DeleteBus and DeleteDriver do to their offerings
+}
+
+// Options says which database GetDatabase opens and how
+type Options struct {
+    Path        string        `yaml:"path"`         // SQLite file, DATABASE_PATH if empty
+    SchemaPath  string        `yaml:"schema"`       // tables for a new file, the built-in schema if empty
+    ReadOnly    bool          `yaml:"read_only"`    // the file must already exist and be migrated
+    InMemory    bool          `yaml:"in_memory"`    // a new private database, Path is ignored
+    BusyTimeout time.Duration `yaml:"busy_timeout"` // how long to wait for another writer's lock
+    JournalMode string        `yaml:"journal_mode"` // e.g. WAL, the SQLite default if empty
+    OnDelete    string        `yaml:"on_delete"`    // a DeletePolicy, DeleteRestrict if empty
+}
+
+// journalModes are the journal modes SQLite accepts
+var journalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+
+// memoryDatabases numbers in-memory databases so each one is private
+var memoryDatabases int32
+
+// dsn returns the data source name for opts
+func (opts Options) dsn() (string, error) {
+    // Foreign keys are enforced per connection so enable them in the DSN
+    params := []string{"_foreign_keys=on"}
+    if opts.ReadOnly {
+        params = append(params, "mode=ro")
+    }
+    if opts.BusyTimeout > 0 {
+        params = append(params, fmt.Sprintf("_busy_timeout=%d", opts.BusyTimeout/time.Millisecond))
+    }
+    if opts.JournalMode != "" {
+        mode := strings.ToUpper(opts.JournalMode)
+        known := false
+        for _, m := range journalModes {
+            known = known || mode == m
+        }
+        if !known {
+            return "", invalidf("Unknown journal mode %q, expected one of %s", opts.JournalMode, strings.Join(journalModes, ", "))
+        }
+        params = append(params, "_journal_mode="+mode)
+    }
+    if opts.InMemory {
+        // Every connection of the pool has to share the one database
+        n := atomic.AddInt32(&memoryDatabases, 1)
+        return fmt.Sprintf("file:transit-memory-%d?mode=memory&cache=shared&%s", n, strings.Join(params, "&")), nil
+    }
+    return "file:" + opts.Path + "?" + strings.Join(params, "&"), nil
 }
 
-// GetDatabase constructs and returns a database object
-func GetDatabase() (*Database, error) {
-    newFile := false
+// GetDatabase constructs and returns a database object. A database file
+// that does not exist is created along with its tables unless opts asks for
+// read-only access.
+func GetDatabase(opts Options) (*Database, error) {
+    if opts.Path == "" {
+        opts.Path = DATABASE_PATH
+    }
+    if opts.InMemory && opts.ReadOnly {
+        return nil, invalidf("An in-memory database cannot be read-only")
+    }
+    dsn, err := opts.dsn()
+    if err != nil {
+        return nil, err
+    }
+    onDelete, err := ParseDeletePolicy(opts.OnDelete)
+    if err != nil {
+        return nil, err
+    }
+    newFile := opts.InMemory
     var db *Database
-    if _, err := os.Stat(DATABASE_PATH); os.IsNotExist(err) {
-        log.Println("Creating database file")
-        _, err := os.Create(DATABASE_PATH)
-        if err != nil {
-            return nil, err
+    if _, err := os.Stat(opts.Path); os.IsNotExist(err) && !opts.InMemory {
+        if opts.ReadOnly {
+            return nil, fmt.Errorf("Database file %s does not exist: %w", opts.Path, ErrNotFound)
         }
+        // SQLite creates the file when it first connects
+        log.Println("Creating database file")
         newFile = true
     }
-    log.Printf("Opening SQLite file %s\n", DATABASE_PATH)
-    tempDB, err := sql.Open("sqlite3", DATABASE_PATH)
+    if opts.InMemory {
+        log.Println("Opening in-memory database")
+    } else {
+        log.Printf("Opening SQLite file %s\n", opts.Path)
+    }
+    tempDB, err := sql.Open("sqlite3", dsn)
     if err != nil {
         return nil, err
     }
-    db = &Database{tempDB}
+    db = &Database{DB: tempDB, stmts: newStmtCache(), operator: DefaultOperator(), onDelete: onDelete}
     if newFile {
         // Need to create the tables
         log.Println("Creating tables")
-        f, err := ioutil.ReadFile(SCHEMA_PATH)
-        if err != nil {
-            return nil, fmt.Errorf("Error reading schema: %v", err)
-        }
-        log.Println("Executing table schemas")
-        sqlCommands := strings.Split(string(f), ";")
-        for _, s := range sqlCommands[:len(sqlCommands)-1] {
-            stmt, err := db.Prepare(strings.Trim(s, " \n\t"))
-            if err != nil {
-                return nil, err
-            }
-            _, err = stmt.Exec()
-            if err != nil {
-                return nil, err
-            }
+        err = db.createTables(opts.SchemaPath)
+    }
+    if err == nil && opts.ReadOnly {
+        err = db.checkSchemaVersion()
+    } else if err == nil {
+        err = db.Migrate()
+    }
+    if err != nil {
+        db.Close()
+        // Do not leave a half made database to be opened next time
+        if newFile && !opts.InMemory {
+            removeDatabaseFiles(opts.Path)
         }
+        return nil, err
     }
     return db, nil
 }
@@ -144,7 +267,7 @@ func GetDatabase() (*Database, error) {
 // GetTripTable returns all the trips in the database
 func (db *Database) GetTripTable() ([]Trip, error) {
     result := []Trip{}
-    row, err := db.Query("SELECT * FROM Trip")
+    row, err := db.query(selectTrips)
     if err != nil {
         return result, err
     }
@@ -156,7 +279,7 @@ func (db *Database) GetTripTable() ([]Trip, error) {
 // GetTripOfferingTable returns all the offerings in the database
 func (db *Database) GetTripOfferingTable() ([]TripOffering, error) {
     result := []TripOffering{}
-    row, err := db.Query("SELECT * FROM TripOffering")
+    row, err := db.query(selectTripOfferings)
     if err != nil {
         return result, err
     }
@@ -168,7 +291,7 @@ func (db *Database) GetTripOfferingTable() ([]TripOffering, error) {
 // GetDriverTable returns all the drivers in the database
 func (db *Database) GetDriverTable() ([]Driver, error) {
     result := []Driver{}
-    row, err := db.Query("SELECT * FROM Driver")
+    row, err := db.query(selectDrivers)
     if err != nil {
         return result, err
     }
@@ -180,7 +303,7 @@ func (db *Database) GetDriverTable() ([]Driver, error) {
 // GetStopTable returns all the stops in the database
 func (db *Database) GetStopTable() ([]Stop, error) {
     result := []Stop{}
-    row, err := db.Query("SELECT * FROM Stop")
+    row, err := db.query(selectStops)
     if err != nil {
         return result, err
     }
@@ -192,7 +315,7 @@ func (db *Database) GetStopTable() ([]Stop, error) {
 // GetActualTripStopInfoTable returns all the actual stop info in the database
 func (db *Database) GetActualTripStopInfoTable() ([]ActualTripStopInfo, error) {
     result := []ActualTripStopInfo{}
-    row, err := db.Query("SELECT * FROM Stop")
+    row, err := db.query(selectActualTripStopInfos)
     if err != nil {
         return result, err
     }
@@ -204,7 +327,7 @@ func (db *Database) GetActualTripStopInfoTable() ([]ActualTripStopInfo, error) {
 // GetBusTable returns all the buses in the database
 func (db *Database) GetBusTable() ([]Bus, error) {
     result := []Bus{}
-    row, err := db.Query("SELECT * FROM Bus")
+    row, err := db.query(selectBuses)
     if err != nil {
         return result, err
     }
@@ -216,7 +339,7 @@ func (db *Database) GetBusTable() ([]Bus, error) {
 // GetTripStopInfoTable returns all the trip stop info in the database
 func (db *Database) GetTripStopInfoTable() ([]TripStopInfo, error) {
     result := []TripStopInfo{}
-    row, err := db.Query("SELECT * FROM TripStopInfo")
+    row, err := db.query(selectTripStopInfos)
     if err != nil {
         return result, err
     }
@@ -225,6 +348,62 @@ func (db *Database) GetTripStopInfoTable() ([]TripStopInfo, error) {
     return result, nil
 }
 
+// GetTrip returns the trip with the given number
+func (db *Database) GetTrip(tripNumber int) (Trip, error) {
+    row, err := db.query(selectTripByNumber, tripNumber)
+    if err != nil {
+        return Trip{}, err
+    }
+    defer row.Close()
+    trips := RowToTrips(row)
+    if len(trips) == 0 {
+        return Trip{}, fmt.Errorf("No trip %d: %w", tripNumber, ErrNotFound)
+    }
+    return trips[0], nil
+}
+
+// GetStop returns the stop with the given number
+func (db *Database) GetStop(stopNumber int) (Stop, error) {
+    row, err := db.query(selectStopByNumber, stopNumber)
+    if err != nil {
+        return Stop{}, err
+    }
+    defer row.Close()
+    stops := RowToStops(row)
+    if len(stops) == 0 {
+        return Stop{}, fmt.Errorf("No stop %d: %w", stopNumber, ErrNotFound)
+    }
+    return stops[0], nil
+}
+
+// GetTripStopInfo returns the stop info of a trip at a stop
+func (db *Database) GetTripStopInfo(tripNumber int, stopNumber int) (TripStopInfo, error) {
+    row, err := db.query(selectTripStopInfoByKey, tripNumber, stopNumber)
+    if err != nil {
+        return TripStopInfo{}, err
+    }
+    defer row.Close()
+    infos := RowToTripStopInfos(row)
+    if len(infos) == 0 {
+        return TripStopInfo{}, fmt.Errorf("Trip %d does not stop at %d: %w", tripNumber, stopNumber, ErrNotFound)
+    }
+    return infos[0], nil
+}
+
+// GetActualTripStopInfo returns what was observed at a stop of an offering
+func (db *Database) GetActualTripStopInfo(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay, stopNumber int) (ActualTripStopInfo, error) {
+    row, err := db.query(selectActualTripStopInfoByKey, tripNumber, date, scheduledStartTime, stopNumber)
+    if err != nil {
+        return ActualTripStopInfo{}, err
+    }
+    defer row.Close()
+    infos := RowToActualStopInfos(row)
+    if len(infos) == 0 {
+        return ActualTripStopInfo{}, fmt.Errorf("No actual stop info for trip %d on %s at %s at stop %d: %w", tripNumber, date, scheduledStartTime, stopNumber, ErrNotFound)
+    }
+    return infos[0], nil
+}
+
 // RowToTrips converts a sql row to a slice of trips
 func RowToTrips(row *sql.Rows) []Trip {
     trips := []Trip{}
@@ -247,24 +426,33 @@ func RowToTripOfferings(row *sql.Rows) []TripOffering {
     tripOffering := []TripOffering{}
     for row.Next() {
         var tripNumber int
-        var date string
-        var scheduledStartTime string
-        var scheduledArrivalTime string
-        var driverName string
-        var busID int
+        var date ServiceDate
+        var scheduledStartTime TimeOfDay
+        var scheduledArrivalTime TimeOfDay
+        // Imported offerings may not have a driver or bus assigned yet
+        var driverName sql.NullString
+        var busID sql.NullInt64
         row.Scan(&tripNumber, &date, &scheduledStartTime, &scheduledArrivalTime, &driverName, &busID)
         tripOffering = append(tripOffering, TripOffering{
             TripNumber:           tripNumber,
             Date:                 date,
             ScheduledStartTime:   scheduledStartTime,
             ScheduledArrivalTime: scheduledArrivalTime,
-            DriverName:           driverName,
-            BusID:                busID,
+            DriverName:           driverName.String,
+            BusID:                nullableBus(busID),
         })
     }
     return tripOffering
 }
 
+// nullableBus converts a scanned BusID column to an offering's BusID
+func nullableBus(busID sql.NullInt64) *int {
+    if !busID.Valid {
+        return nil
+    }
+    return BusRef(int(busID.Int64))
+}
+
 // RowToBuses converts a sql row to a slice of buses
 func RowToBuses(row *sql.Rows) []Bus {
     result := []Bus{}
@@ -272,11 +460,13 @@ func RowToBuses(row *sql.Rows) []Bus {
         var busID int
         var model string
         var year int
-        row.Scan(&busID, &model, &year)
+        var retiredOn ServiceDate
+        row.Scan(&busID, &model, &year, &retiredOn)
         result = append(result, Bus{
-            BusID: busID,
-            Model: model,
-            Year:  year,
+            BusID:     busID,
+            Model:     model,
+            Year:      year,
+            RetiredOn: retiredOn,
         })
     }
     return result
@@ -288,10 +478,12 @@ func RowToDrivers(row *sql.Rows) []Driver {
     for row.Next() {
         var driverName string
         var driverTelephoneNumber string
-        row.Scan(&driverName, &driverTelephoneNumber)
+        var retiredOn ServiceDate
+        row.Scan(&driverName, &driverTelephoneNumber, &retiredOn)
         result = append(result, Driver{
             DriverName:            driverName,
             DriverTelephoneNumber: driverTelephoneNumber,
+            RetiredOn:             retiredOn,
         })
     }
     return result
@@ -303,6 +495,7 @@ func RowToStops(row *sql.Rows) []Stop {
     for row.Next() {
         var stopNumber int
         var stopAddress string
+        row.Scan(&stopNumber, &stopAddress)
         result = append(result, Stop{
             StopNumber:  stopNumber,
             StopAddress: stopAddress,
@@ -316,14 +509,15 @@ func RowToActualStopInfos(row *sql.Rows) []ActualTripStopInfo {
     result := []ActualTripStopInfo{}
     for row.Next() {
         var tripNumber int
-        var date string
-        var scheduledStartTime string
+        var date ServiceDate
+        var scheduledStartTime TimeOfDay
         var stopNumber int
-        var scheduledArrivalTime string
-        var actualStartTime string
-        var actualArrivalTime string
+        var scheduledArrivalTime TimeOfDay
+        var actualStartTime TimeOfDay
+        var actualArrivalTime TimeOfDay
         var numberOfPassengerIn int
         var numberOfPassengerOut int
+        row.Scan(&tripNumber, &date, &scheduledStartTime, &stopNumber, &scheduledArrivalTime, &actualStartTime, &actualArrivalTime, &numberOfPassengerIn, &numberOfPassengerOut)
         result = append(result, ActualTripStopInfo{
             TripNumber:           tripNumber,
             Date:                 date,
@@ -347,6 +541,7 @@ func RowToTripStopInfos(row *sql.Rows) []TripStopInfo {
         var stopNumber int
         var sequenceNumber int
         var drivingTime float32
+        row.Scan(&tripNumber, &stopNumber, &sequenceNumber, &drivingTime)
         result = append(result, TripStopInfo{
             TripNumber:     tripNumber,
             StopNumber:     stopNumber,
@@ -358,257 +553,417 @@ func RowToTripStopInfos(row *sql.Rows) []TripStopInfo {
 }
 
 // GetSchedule returns all trip offerings for the given information
-func (db *Database) GetSchedule(startLocationName, destinationName, date string) ([]Trip, map[int][]TripOffering, error) {
+func (db *Database) GetSchedule(startLocationName, destinationName string, date ServiceDate) ([]Trip, map[int][]TripOffering, error) {
     trips := []Trip{}
     offerings := make(map[int][]TripOffering)
-    row, err := db.Query(fmt.Sprintf("SELECT * FROM Trip WHERE StartLocationName=%s", startLocationName))
+    row, err := db.query(selectTripsByRoute, startLocationName, destinationName)
     if err != nil {
         return trips, offerings, err
     }
-    // Get the trips with the given start location name
+    // Get the trips with the given start location and destination
     trips = RowToTrips(row)
     row.Close()
-    // Get the trip offerings for each trip
+    // Get the trip offerings for each trip on the given date
     for _, t := range trips {
-        row, err := db.Query(fmt.Sprintf("SELECT * FROM TripOffering WHERE TripNumber=%d", t.TripNumber))
+        row, err := db.query(selectOfferingsByTripDay, t.TripNumber, date)
         if err != nil {
             return trips, offerings, err
         }
-        for row.Next() {
-            var tripNumber int
-            var date string
-            var scheduledStartTime string
-            var scheduledArrivalTime string
-            var driverName string
-            var busID int
-            row.Scan(&tripNumber, &date, &scheduledStartTime, &scheduledArrivalTime, &driverName, &busID)
-            if _, ok := offerings[tripNumber]; !ok {
-                offerings[tripNumber] = []TripOffering{}
-            }
-            offerings[tripNumber] = append(offerings[tripNumber], TripOffering{
-                TripNumber:           tripNumber,
-                Date:                 date,
-                ScheduledStartTime:   scheduledStartTime,
-                ScheduledArrivalTime: scheduledArrivalTime,
-                DriverName:           driverName,
-                BusID:                busID,
-            })
-        }
+        offerings[t.TripNumber] = RowToTripOfferings(row)
         row.Close()
     }
     return trips, offerings, nil
 }
 
-// DeleteOffering deletes the trip offering with the given primary keys
-func (db *Database) DeleteOffering(tripNumber int, date string, scheduledStartTime string) error {
-    _, err := db.Query(fmt.Sprintf("DELETE FROM TripOffering WHERE TripNumber=%d AND Date=%s AND ScheduledStartTime=%s", tripNumber, date, scheduledStartTime))
-    return err
-}
-
-// AddOfferings adds the set of offerings to the TripOffering table
-func (db *Database) AddOfferings(offerings []TripOffering) error {
-    for _, offer := range offerings {
-        stmt, err := db.Prepare(fmt.Sprintf("INSERT INTO TripOffering (TripNumber, Date, ScheduledStartTime, ScheduledArrivalTime, DriverName, BusID) VALUES (%d, %q, %q, %q, %q, %d)", offer.TripNumber, offer.Date, offer.ScheduledStartTime, offer.ScheduledArrivalTime, offer.DriverName, offer.BusID))
+// DeleteOffering deletes the trip offering with the given primary keys,
+// along with the observations recorded for it
+func (db *Database) DeleteOffering(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay) error {
+    return db.WithTx(func(tx *Database) error {
+        offer, err := tx.GetOffering(tripNumber, date, scheduledStartTime)
         if err != nil {
             return err
         }
-        _, err = stmt.Exec()
+        // The foreign key deletes the observations, which are logged here
+        row, err := tx.query(selectObservationsByOffering, tripNumber, date, scheduledStartTime)
         if err != nil {
             return err
         }
-    }
-    return nil
+        observations := RowToActualStopInfos(row)
+        row.Close()
+        res, err := tx.exec(deleteTripOffering, tripNumber, date, scheduledStartTime)
+        if err != nil {
+            return err
+        }
+        if err := expectRows(res, fmt.Sprintf("No offering for trip %d on %s at %s", tripNumber, date, scheduledStartTime)); err != nil {
+            return err
+        }
+        for _, a := range observations {
+            if err := tx.record(a, nil); err != nil {
+                return err
+            }
+        }
+        return tx.record(offer, nil)
+    })
 }
 
-// ChangeDriver will change the driverName of the driver of the trip given by the composite key info
-func (db *Database) ChangeDriver(driverName string, tripNumber int, date string, scheduledStartTime string) error {
-    stmt, err := db.Prepare(fmt.Sprintf("UPDATE Trip SET DriverName=%q WHERE TripNumber=%d AND Date=%q AND ScheduledStartTime=%q", driverName, tripNumber, date, scheduledStartTime))
+// AddOfferings adds the set of offerings to the TripOffering table in one
+// transaction, refusing dates on which the calendar says the trip does not
+// run. If any offering cannot be added none of them are.
+func (db *Database) AddOfferings(offerings []TripOffering) error {
+    cal, err := db.GetCalendar()
     if err != nil {
         return err
     }
-    _, err = stmt.Exec()
-    return err
+    return db.WithTx(func(tx *Database) error {
+        for _, offer := range offerings {
+            if offer.Date.IsZero() {
+                return invalidf("Trip %d has no date", offer.TripNumber)
+            }
+            if err := cal.checkOffering(offer); err != nil {
+                return err
+            }
+            // Offerings earlier in the batch are visible to the check
+            if err := tx.checkConflicts(offer); err != nil {
+                return err
+            }
+            if err := tx.checkRetired(offer); err != nil {
+                return err
+            }
+            _, err := tx.exec(insertTripOffering, offer.TripNumber, offer.Date, offer.ScheduledStartTime, offer.ScheduledArrivalTime, offer.DriverName, offer.BusID)
+            if err != nil {
+                return err
+            }
+            if err := tx.record(nil, offer); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+// ChangeDriver will change the driverName of the driver of the trip given by the composite key info
+func (db *Database) ChangeDriver(driverName string, tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay) error {
+    // The offering cannot change between the conflict check and the update
+    return db.WithTx(func(tx *Database) error {
+        offer, err := tx.GetOffering(tripNumber, date, scheduledStartTime)
+        if err != nil {
+            return err
+        }
+        before := offer
+        offer.DriverName = driverName
+        if err := tx.checkConflicts(offer, "driver"); err != nil {
+            return err
+        }
+        if err := tx.checkRetired(offer, "driver"); err != nil {
+            return err
+        }
+        if _, err := tx.exec(updateOfferingDriver, driverName, tripNumber, date, scheduledStartTime); err != nil {
+            return err
+        }
+        return tx.record(before, offer)
+    })
 }
 
 // ChangeBus will change the BusID of the trip given the composite key info
-func (db *Database) ChangeBus(busID int, tripNumber int, date string, scheduledStartTime string) error {
-    stmt, err := db.Prepare(fmt.Sprintf("UPDATE Trip SET BusID=%d WHERE TripNumber=%d AND Date=%q AND ScheduledStartTime=%q", busID, tripNumber, date, scheduledStartTime))
-    if err != nil {
-        return err
-    }
-    _, err = stmt.Exec()
-    return err
+func (db *Database) ChangeBus(busID int, tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay) error {
+    return db.WithTx(func(tx *Database) error {
+        offer, err := tx.GetOffering(tripNumber, date, scheduledStartTime)
+        if err != nil {
+            return err
+        }
+        before := offer
+        offer.BusID = &busID
+        if err := tx.checkConflicts(offer, "bus"); err != nil {
+            return err
+        }
+        if err := tx.checkRetired(offer, "bus"); err != nil {
+            return err
+        }
+        if _, err := tx.exec(updateOfferingBus, busID, tripNumber, date, scheduledStartTime); err != nil {
+            return err
+        }
+        return tx.record(before, offer)
+    })
 }
 
 // GetStops returns all stops for a given trip number
 func (db *Database) GetStops(tripNumber int) ([]TripStopInfo, error) {
-    //SELECT TSI
-    //FROM TripStopInfo TSI
-    //WHERE TSI.TripNumber = tripNumber
     stops := []TripStopInfo{}
-    row, err := db.Query(fmt.Sprintf("SELECT * FROM TripStopInfo TSI WHERE TSI.TripNumber = %d", tripNumber))
+    row, err := db.query(selectStopsByTrip, tripNumber)
     if err != nil {
         return stops, err
     }
     defer row.Close()
-    for row.Next() {
-        var TripNumber int
-        var StopNumber int
-        var SequenceNumber int
-        var DrivingTime float32
-        row.Scan(&TripNumber, &StopNumber, &SequenceNumber, &DrivingTime)
-        stops = append(stops, TripStopInfo{
-            TripNumber:     TripNumber,
-            StopNumber:     StopNumber,
-            SequenceNumber: SequenceNumber,
-            DrivingTime:    DrivingTime,
-        })
-    }
+    stops = RowToTripStopInfos(row)
     return stops, nil
 }
 
-// Get the weekly schedule for a given driver and date
-func (db *Database) GetDriverWeeklySchedule(driverName string, date string) ([]TripOffering, error) {
+// GetDriverWeeklySchedule returns the driver's offerings in the Monday to
+// Sunday week containing date
+func (db *Database) GetDriverWeeklySchedule(driverName string, date ServiceDate) ([]TripOffering, error) {
+    monday := date.AddDays(-((int(date.Weekday()) + 6) % 7))
+    return db.GetDriverSchedule(driverName, monday, monday.AddDays(6))
+}
+
+// GetDriverSchedule returns the offerings assigned to a driver between the
+// dates from and to (inclusive), in date and start time order
+func (db *Database) GetDriverSchedule(driverName string, from ServiceDate, to ServiceDate) ([]TripOffering, error) {
     result := []TripOffering{}
-    sameWeek := func(t1, t2 *time.Time) bool {
-        year1, week1 := t1.ISOWeek()
-        year2, week2 := t2.ISOWeek()
-        return year1 == year2 && week1 == week2
+    if from.IsZero() || to.IsZero() {
+        return result, invalidf("A date range is required")
     }
-    row, err := db.Query("SELECT * FROM TripOffering WHERE DriverName=%q", driverName)
+    row, err := db.query(selectDriverOfferings, driverName, from, to)
     if err != nil {
         return result, err
     }
     defer row.Close()
-    date1, err := time.Parse(DATE_FORMAT, date)
-    if err != nil {
-        return result, err
-    }
-    if err != nil {
-        return result, err
-    }
-    for row.Next() {
-        var tripNumber int
-        var date string
-        var scheduledStartTime string
-        var scheduledArrivalTime string
-        var driverName string
-        var busID int
-        row.Scan(&tripNumber, &date, &scheduledStartTime, &scheduledArrivalTime, &driverName, &busID)
-        date2, err := time.Parse(DATE_FORMAT, date)
-        if err != nil {
-            log.Fatal(err)
-        }
-        if sameWeek(&date1, &date2) {
-            result = append(result, TripOffering{
-                TripNumber:           tripNumber,
-                Date:                 date,
-                ScheduledStartTime:   scheduledStartTime,
-                ScheduledArrivalTime: scheduledArrivalTime,
-                DriverName:           driverName,
-                BusID:                busID,
-            })
-        }
-    }
+    result = RowToTripOfferings(row)
     return result, nil
 }
 
 // AddDriver adds a driver to the SQLite database
 func (db *Database) AddDriver(driverName string, driverTelephoneNumber string) error {
-    stmt, err := db.Prepare(fmt.Sprintf("INSERT INTO Driver (DriverName, DriverTelephoneNumber) VALUES(%q, %q)", driverName, driverTelephoneNumber))
-    _, stmtErr := stmt.Exec()
-    if stmtErr != nil {
-      return stmtErr
-    }
-    return err
+    return db.insert(Driver{DriverName: driverName, DriverTelephoneNumber: driverTelephoneNumber})
 }
 
 // AddBus adds a bus to the SQLite database, returning err if falied
 func (db *Database) AddBus(busID int, model string, year int) error {
-    stmt, err := db.Prepare(fmt.Sprintf("INSERT INTO Bus (BusID, Model, year) VALUES(%d, %q, %d)", busID, model, year))
-    if err != nil {
-        return err
-    }
-    _, stmtErr := stmt.Exec()
-    if stmtErr != nil {
-      return stmtErr
-    }
-    return err
+    return db.insert(Bus{BusID: busID, Model: model, Year: year})
 }
 
-func (db *Database) AddOffering(tripNumber int, date string, scheduledStartTime string, scheduledArrivalTime string, driverName string, busID int) error {
-    stmt, err := db.Prepare(fmt.Sprintf("INSERT INTO TripOffering (TripNumber, Date, ScheduledStartTime, ScheduledArrivalTime, DriverName, BusID) VALUES (%d, %q, %q, %q, %q, %d)", tripNumber, date, scheduledStartTime, scheduledArrivalTime, driverName, busID))
-    if err != nil {
-        return err
-    }
-    _, stmtErr := stmt.Exec()
-    if stmtErr != nil {
-      return stmtErr
-    }
-    return nil
+// AddOffering adds a trip offering to the database
+func (db *Database) AddOffering(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay, scheduledArrivalTime TimeOfDay, driverName string, busID int) error {
+    return db.AddOfferings([]TripOffering{{
+        TripNumber:           tripNumber,
+        Date:                 date,
+        ScheduledStartTime:   scheduledStartTime,
+        ScheduledArrivalTime: scheduledArrivalTime,
+        DriverName:           driverName,
+        BusID:                &busID,
+    }})
 }
 
-// DeleteBus deletes a bus from the SQLite database, returning err if failed
+// DeleteBus deletes a bus from the SQLite database, returning err if failed.
+// What happens to the offerings the bus is assigned to depends on the
+// handle's DeletePolicy.
 func (db *Database) DeleteBus(busID int) error {
-    stmt, err := db.Prepare(fmt.Sprintf("DELETE FROM Bus WHERE BusID = %d", busID))
+    return db.WithTx(func(tx *Database) error {
+        bus, err := tx.GetBus(busID)
+        if err != nil {
+            return err
+        }
+        if tx.onDelete == DeleteRetire {
+            return tx.RetireBus(busID, Today())
+        }
+        row, err := tx.query(selectOfferingsByBus, busID)
+        if err != nil {
+            return err
+        }
+        offerings := RowToTripOfferings(row)
+        row.Close()
+        if len(offerings) > 0 && tx.onDelete != DeleteCascade {
+            return constraintError{fmt.Sprintf("Bus %d is assigned to %s", busID, offeringCount(len(offerings)))}
+        }
+        for _, o := range offerings {
+            if err := tx.DeleteOffering(o.TripNumber, o.Date, o.ScheduledStartTime); err != nil {
+                return err
+            }
+        }
+        if _, err := tx.exec(deleteBus, busID); err != nil {
+            return err
+        }
+        return tx.record(bus, nil)
+    })
+}
+
+// DeleteDriver deletes a driver, doing to the offerings the driver is
+// assigned to what the handle's DeletePolicy says, as DeleteBus does
+func (db *Database) DeleteDriver(driverName string) error {
+    return db.WithTx(func(tx *Database) error {
+        driver, err := tx.GetDriver(driverName)
+        if err != nil {
+            return err
+        }
+        if tx.onDelete == DeleteRetire {
+            return tx.RetireDriver(driverName, Today())
+        }
+        row, err := tx.query(selectOfferingsByDriver, driverName)
+        if err != nil {
+            return err
+        }
+        offerings := RowToTripOfferings(row)
+        row.Close()
+        if len(offerings) > 0 && tx.onDelete != DeleteCascade {
+            return constraintError{fmt.Sprintf("Driver %s is assigned to %s", driverName, offeringCount(len(offerings)))}
+        }
+        for _, o := range offerings {
+            if err := tx.DeleteOffering(o.TripNumber, o.Date, o.ScheduledStartTime); err != nil {
+                return err
+            }
+        }
+        return tx.deleteRow(driver)
+    })
+}
+
+// DeleteTrip deletes a trip. A trip that still has offerings, stops, service
+// patterns or service exceptions is not deleted.
+func (db *Database) DeleteTrip(tripNumber int) error {
+    return db.WithTx(func(tx *Database) error {
+        trip, err := tx.GetTrip(tripNumber)
+        if err != nil {
+            return err
+        }
+        return tx.deleteRow(trip)
+    })
+}
+
+// DeleteStop deletes a stop that no trip stops at
+func (db *Database) DeleteStop(stopNumber int) error {
+    return db.WithTx(func(tx *Database) error {
+        stop, err := tx.GetStop(stopNumber)
+        if err != nil {
+            return err
+        }
+        return tx.deleteRow(stop)
+    })
+}
+
+// DeleteTripStopInfo deletes the stop a trip makes at stopNumber
+func (db *Database) DeleteTripStopInfo(tripNumber int, stopNumber int) error {
+    return db.WithTx(func(tx *Database) error {
+        info, err := tx.GetTripStopInfo(tripNumber, stopNumber)
+        if err != nil {
+            return err
+        }
+        return tx.deleteRow(info)
+    })
+}
+
+// DeleteActualTripStopInfo deletes what was observed at a stop of an offering
+func (db *Database) DeleteActualTripStopInfo(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay, stopNumber int) error {
+    return db.WithTx(func(tx *Database) error {
+        info, err := tx.GetActualTripStopInfo(tripNumber, date, scheduledStartTime, stopNumber)
+        if err != nil {
+            return err
+        }
+        return tx.deleteRow(info)
+    })
+}
+
+// expectRows returns ErrNotFound, described by msg, if res affected no rows
+func expectRows(res sql.Result, msg string) error {
+    n, err := res.RowsAffected()
     if err != nil {
         return err
     }
-    _, stmtErr := stmt.Exec()
-    if stmtErr != nil {
-      return stmtErr
+    if n == 0 {
+        return fmt.Errorf("%s: %w", msg, ErrNotFound)
     }
     return nil
 }
 
 // AddTripStopInfo adds a trip stop info to the database
 func (db *Database) AddTripStopInfo(tripNumber int, stopNumber int, sequenceNumber int, drivingTime float32) error {
-    stmt, err := db.Prepare(fmt.Sprintf("INSERT INTO TripStopInfo (TripNumber, StopNumber, SequenceNumber, DrivingTime) Values (%d, %d, %d, %f)", tripNumber, stopNumber, sequenceNumber, drivingTime))
-    if err != nil {
-        return err
-    }
-    _, stmtErr := stmt.Exec()
-    if stmtErr != nil {
-      return stmtErr
-    }
-    return nil
+    return db.insert(TripStopInfo{tripNumber, stopNumber, sequenceNumber, drivingTime})
 }
 
 // AddActualTripStopInfo adds an actual trip stop info to the database
-func (db *Database) AddActualTripStopInfo(tripNumber int, date string, scheduledStartTime string, stopNumber int, scheduledArrivalTime string, actualStartTime string, actualArrivalTime string, numberOfPassengerIn int, numberOfPassengerOut int) error {
-    stmt, err := db.Prepare(fmt.Sprintf("INSERT INTO ActualTripStopInfo (TripNumber, Date, ScheduledStartTime, StopNumber, ScheduledArrivalTime, ActualStartTime, ActualArrivalTime, NumberOfPassengerIn, NumberOfPassengerOut) VALUES (%d, %q, %q, %d, %q, %q, %q, %d, %d)", tripNumber, date, scheduledStartTime, stopNumber, scheduledArrivalTime, actualStartTime, actualArrivalTime, numberOfPassengerIn, numberOfPassengerOut))
-    if err != nil {
-        return err
-    }
-    _, stmtErr := stmt.Exec()
-    if stmtErr != nil {
-      return stmtErr
-    }
-    return nil
+func (db *Database) AddActualTripStopInfo(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay, stopNumber int, scheduledArrivalTime TimeOfDay, actualStartTime TimeOfDay, actualArrivalTime TimeOfDay, numberOfPassengerIn int, numberOfPassengerOut int) error {
+    if date.IsZero() || scheduledStartTime.IsZero() {
+        return invalidf("A date and scheduled start time are required")
+    }
+    return db.insert(ActualTripStopInfo{
+        TripNumber:           tripNumber,
+        Date:                 date,
+        ScheduledStartTime:   scheduledStartTime,
+        StopNumber:           stopNumber,
+        ScheduledArrivalTime: scheduledArrivalTime,
+        ActualStartTime:      actualStartTime,
+        ActualArrivalTime:    actualArrivalTime,
+        NumberOfPassengerIn:  numberOfPassengerIn,
+        NumberOfPassengerOut: numberOfPassengerOut,
+    })
 }
 
 // AddTrip adds a trip to the database
 func (db *Database) AddTrip(tripNumber int, startLocationName string, destinationName string) error {
-    stmt, err := db.Prepare(fmt.Sprintf("INSERT INTO Trip (TripNumber, StartLocationName,DestinationName) VALUES(%d, %q, %q)", tripNumber, startLocationName, destinationName))
-    if err != nil {
-        return err
-    }
-    _, stmtErr := stmt.Exec()
-    if stmtErr != nil {
-      return stmtErr
-    }
-    return nil
+    return db.insert(Trip{tripNumber, startLocationName, destinationName})
 }
 
 // AddStop adds a stop to the database
 func (db *Database) AddStop(stopNumber int, stopAddress string) error {
-    stmt, err := db.Prepare(fmt.Sprintf("INSERT INTO Stop (StopNumber, StopAddress) VALUES (%d, %q)", stopNumber, stopAddress))
-    if err != nil {
-        return err
-    }
-    _, stmtErr := stmt.Exec()
-    if stmtErr != nil {
-      return stmtErr
-    }
-    return nil
-}
\ No newline at end of file
+    return db.insert(Stop{stopNumber, stopAddress})
+}
+
+// UpdateTrip changes where a trip starts and ends
+func (db *Database) UpdateTrip(tripNumber int, startLocationName string, destinationName string) error {
+    return db.WithTx(func(tx *Database) error {
+        trip, err := tx.GetTrip(tripNumber)
+        if err != nil {
+            return err
+        }
+        before := trip
+        trip.StartLocationName = startLocationName
+        trip.DestinationName = destinationName
+        return tx.updateRow(before, trip)
+    })
+}
+
+// UpdateDriver changes a driver's telephone number. RetireDriver changes
+// when the driver retires.
+func (db *Database) UpdateDriver(driverName string, driverTelephoneNumber string) error {
+    return db.WithTx(func(tx *Database) error {
+        driver, err := tx.GetDriver(driverName)
+        if err != nil {
+            return err
+        }
+        before := driver
+        driver.DriverTelephoneNumber = driverTelephoneNumber
+        return tx.updateRow(before, driver)
+    })
+}
+
+// UpdateStop changes the address of a stop
+func (db *Database) UpdateStop(stopNumber int, stopAddress string) error {
+    return db.WithTx(func(tx *Database) error {
+        stop, err := tx.GetStop(stopNumber)
+        if err != nil {
+            return err
+        }
+        before := stop
+        stop.StopAddress = stopAddress
+        return tx.updateRow(before, stop)
+    })
+}
+
+// UpdateTripStopInfo changes where a stop comes in a trip and the driving
+// time to it
+func (db *Database) UpdateTripStopInfo(tripNumber int, stopNumber int, sequenceNumber int, drivingTime float32) error {
+    return db.WithTx(func(tx *Database) error {
+        info, err := tx.GetTripStopInfo(tripNumber, stopNumber)
+        if err != nil {
+            return err
+        }
+        before := info
+        info.SequenceNumber = sequenceNumber
+        info.DrivingTime = drivingTime
+        return tx.updateRow(before, info)
+    })
+}
+
+// UpdateActualTripStopInfo changes what was observed at a stop of an offering
+func (db *Database) UpdateActualTripStopInfo(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay, stopNumber int, scheduledArrivalTime TimeOfDay, actualStartTime TimeOfDay, actualArrivalTime TimeOfDay, numberOfPassengerIn int, numberOfPassengerOut int) error {
+    return db.WithTx(func(tx *Database) error {
+        info, err := tx.GetActualTripStopInfo(tripNumber, date, scheduledStartTime, stopNumber)
+        if err != nil {
+            return err
+        }
+        before := info
+        info.ScheduledArrivalTime = scheduledArrivalTime
+        info.ActualStartTime = actualStartTime
+        info.ActualArrivalTime = actualArrivalTime
+        info.NumberOfPassengerIn = numberOfPassengerIn
+        info.NumberOfPassengerOut = numberOfPassengerOut
+        return tx.updateRow(before, info)
+    })
+}
@@ -0,0 +1,192 @@
+package transit_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+// openMemory returns a new in-memory database, closed when the test ends
+func openMemory(t *testing.T) *transit.Database {
+	t.Helper()
+	db, err := transit.GetDatabase(transit.Options{InMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func mustParseDate(t *testing.T, s string) transit.ServiceDate {
+	t.Helper()
+	d, err := transit.ParseServiceDate(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func mustParseTime(t *testing.T, s string) transit.TimeOfDay {
+	t.Helper()
+	tod, err := transit.ParseTimeOfDay(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tod
+}
+
+func TestQuotedNamesRoundTrip(t *testing.T) {
+	names := []string{`O'Brien`, `"; DROP TABLE Bus`, `'); DROP TABLE Bus; --`}
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			db := openMemory(t)
+			date, start, arrival := mustParseDate(t, "2026-10-19"), mustParseTime(t, "10:00"), mustParseTime(t, "11:00")
+			other := "Ann"
+			for _, err := range []error{
+				db.AddTrip(1, name, name+" Sq"),
+				db.AddBus(1, "Gillig", 2015),
+				db.AddDriver(name, "555-0100"),
+				db.AddDriver(other, "555-0101"),
+				db.AddOffering(1, date, start, arrival, other, 1),
+			} {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			trips, offerings, err := db.GetSchedule(name, name+" Sq", date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(trips) != 1 || trips[0].StartLocationName != name || trips[0].DestinationName != name+" Sq" {
+				t.Fatalf("GetSchedule trips %v, want the trip from %q", trips, name)
+			}
+			if len(offerings[1]) != 1 {
+				t.Fatalf("GetSchedule offerings %v, want the one offering", offerings)
+			}
+
+			if err := db.ChangeDriver(name, 1, date, start); err != nil {
+				t.Fatal(err)
+			}
+			table, err := db.GetTripOfferingTable()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(table) != 1 || table[0].DriverName != name {
+				t.Fatalf("Offerings %v after ChangeDriver(%q), want the one offering driven by them", table, name)
+			}
+
+			var tables int
+			if err := db.DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'Bus'`).Scan(&tables); err != nil {
+				t.Fatal(err)
+			}
+			buses, err := db.GetBusTable()
+			if tables != 1 || err != nil || len(buses) != 1 {
+				t.Errorf("Bus table after using %q: %d tables, %v, %v", name, tables, buses, err)
+			}
+		})
+	}
+}
+
+func TestUpdateAndUndoByKey(t *testing.T) {
+	db := openMemory(t)
+	date, start := mustParseDate(t, "2026-10-19"), mustParseTime(t, "10:00")
+	for _, err := range []error{
+		db.AddTrip(1, "Pomona", "Ontario"),
+		db.AddStop(1, "1 Main St"),
+		db.AddTripStopInfo(1, 1, 1, 0),
+		db.AddBus(1, "Gillig", 2015),
+		db.AddDriver("Ann", "555-0100"),
+		db.AddOffering(1, date, start, mustParseTime(t, "11:00"), "Ann", 1),
+		db.AddActualTripStopInfo(1, date, start, 1, start, start, start, 3, 0),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := db.RecordEdit("s", "update everything", func(tx *transit.Database) error {
+		for _, err := range []error{
+			tx.UpdateTrip(1, "Pomona", "Claremont"),
+			tx.UpdateStop(1, "1 Holt Ave"),
+			tx.UpdateTripStopInfo(1, 1, 2, 5),
+			tx.UpdateDriver("Ann", "555-0199"),
+			tx.UpdateActualTripStopInfo(1, date, start, 1, start, mustParseTime(t, "10:02"), mustParseTime(t, "10:02"), 4, 1),
+		} {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trip, _ := db.GetTrip(1)
+	stop, _ := db.GetStop(1)
+	info, _ := db.GetTripStopInfo(1, 1)
+	driver, _ := db.GetDriver("Ann")
+	actual, _ := db.GetActualTripStopInfo(1, date, start, 1)
+	if trip.DestinationName != "Claremont" || stop.StopAddress != "1 Holt Ave" || info.SequenceNumber != 2 || driver.DriverTelephoneNumber != "555-0199" || actual.NumberOfPassengerIn != 4 {
+		t.Errorf("After the updates %v, %v, %v, %v, %v, want every change made", trip, stop, info, driver, actual)
+	}
+	if _, err := db.Undo("s", 1); err != nil {
+		t.Fatal(err)
+	}
+	trip, _ = db.GetTrip(1)
+	stop, _ = db.GetStop(1)
+	info, _ = db.GetTripStopInfo(1, 1)
+	driver, _ = db.GetDriver("Ann")
+	actual, _ = db.GetActualTripStopInfo(1, date, start, 1)
+	if trip.DestinationName != "Ontario" || stop.StopAddress != "1 Main St" || info.SequenceNumber != 1 || driver.DriverTelephoneNumber != "555-0100" || actual.NumberOfPassengerIn != 3 {
+		t.Errorf("After the undo %v, %v, %v, %v, %v, want every change undone", trip, stop, info, driver, actual)
+	}
+	if err := db.UpdateStop(9, "9 Main St"); !errors.Is(err, transit.ErrNotFound) {
+		t.Errorf("Updating a missing stop returned %v, want a not found error", err)
+	}
+}
+
+func TestDeleteDriverPolicy(t *testing.T) {
+	tests := []struct {
+		policy    transit.DeletePolicy
+		offerings int
+		driver    bool
+	}{
+		{transit.DeleteRestrict, 1, true},
+		{transit.DeleteCascade, 0, false},
+		// The offering is in the past, so retiring keeps it and the driver
+		{transit.DeleteRetire, 1, true},
+	}
+	for _, tt := range tests {
+		db := openMemory(t)
+		for _, err := range []error{
+			db.AddTrip(1, "Pomona", "Ontario"),
+			db.AddBus(1, "Gillig", 2015),
+			db.AddDriver("Ann", "555-0100"),
+			db.AddOffering(1, mustParseDate(t, "2020-01-06"), mustParseTime(t, "10:00"), mustParseTime(t, "11:00"), "Ann", 1),
+		} {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := db.WithDeletePolicy(tt.policy).DeleteDriver("Ann")
+		if (err != nil) != (tt.policy == transit.DeleteRestrict) || err != nil && !transit.IsConstraint(err) {
+			t.Errorf("%s: DeleteDriver returned %v", tt.policy, err)
+		}
+		offerings, err := db.GetTripOfferingTable()
+		if err != nil {
+			t.Fatal(err)
+		}
+		driver, err := db.GetDriver("Ann")
+		if len(offerings) != tt.offerings || (err == nil) != tt.driver {
+			t.Errorf("%s: %d offerings and driver %v, %v left, want %d offerings and the driver kept %v", tt.policy, len(offerings), driver, err, tt.offerings, tt.driver)
+		}
+		if tt.policy == transit.DeleteRetire && driver.RetiredOn.IsZero() {
+			t.Errorf("%s: driver %v, want them retired", tt.policy, driver)
+		}
+	}
+	db := openMemory(t)
+	if err := db.DeleteDriver("Nobody"); !errors.Is(err, transit.ErrNotFound) {
+		t.Errorf("Deleting a missing driver returned %v, want a not found error", err)
+	}
+}
@@ -0,0 +1,113 @@
+// Bulk insertion of rows for several tables at once
+package transit
+
+import (
+    "fmt"
+)
+
+// Dataset holds rows for the core tables that are inserted together
+type Dataset struct {
+    Buses               []Bus
+    Drivers             []Driver
+    Stops               []Stop
+    Trips               []Trip
+    TripStopInfos       []TripStopInfo
+    TripOfferings       []TripOffering
+    ActualTripStopInfos []ActualTripStopInfo
+}
+
+// InsertDataset inserts every row of d in a single transaction, parents
+// before the rows that reference them. Nothing is written if any row fails.
+// Offerings are stored as given: the calendar and double-booking checks of
+// AddOfferings are not applied, and an empty DriverName or nil BusID is
+// stored as unassigned.
+func (db *Database) InsertDataset(d Dataset) error {
+    return db.WithTx(func(tx *Database) error {
+        for _, b := range d.Buses {
+            if err := tx.insertRow(b); err != nil {
+                return fmt.Errorf("Bus %d: %v", b.BusID, err)
+            }
+        }
+        for _, dr := range d.Drivers {
+            if err := tx.insertRow(dr); err != nil {
+                return fmt.Errorf("Driver %s: %v", dr.DriverName, err)
+            }
+        }
+        for _, s := range d.Stops {
+            if err := tx.insertRow(s); err != nil {
+                return fmt.Errorf("Stop %d: %v", s.StopNumber, err)
+            }
+        }
+        for _, t := range d.Trips {
+            if err := tx.insertRow(t); err != nil {
+                return fmt.Errorf("Trip %d: %v", t.TripNumber, err)
+            }
+        }
+        for _, t := range d.TripStopInfos {
+            if err := tx.insertRow(t); err != nil {
+                return fmt.Errorf("Stop %d of trip %d: %v", t.StopNumber, t.TripNumber, err)
+            }
+        }
+        for _, o := range d.TripOfferings {
+            if err := tx.insertRow(o); err != nil {
+                return fmt.Errorf("Trip %d on %s at %s: %v", o.TripNumber, o.Date, o.ScheduledStartTime, err)
+            }
+        }
+        for _, a := range d.ActualTripStopInfos {
+            if err := tx.insertRow(a); err != nil {
+                return fmt.Errorf("Stop %d of trip %d on %s at %s: %v", a.StopNumber, a.TripNumber, a.Date, a.ScheduledStartTime, err)
+            }
+        }
+        return nil
+    })
+}
+
+// insertRow inserts a single row of any table and logs it. Callers should
+// hold a transaction, as insert does.
+func (db *Database) insertRow(row interface{}) error {
+    var query string
+    var args []interface{}
+    switch r := row.(type) {
+    case Bus:
+        query, args = insertBus, []interface{}{r.BusID, r.Model, r.Year, r.RetiredOn}
+    case Driver:
+        query, args = insertDriver, []interface{}{r.DriverName, r.DriverTelephoneNumber, r.RetiredOn}
+    case Stop:
+        query, args = insertStop, []interface{}{r.StopNumber, r.StopAddress}
+    case Trip:
+        query, args = insertTrip, []interface{}{r.TripNumber, r.StartLocationName, r.DestinationName}
+    case TripStopInfo:
+        query, args = insertTripStopInfo, []interface{}{r.TripNumber, r.StopNumber, r.SequenceNumber, r.DrivingTime}
+    case TripOffering:
+        query, args = insertTripOffering, []interface{}{r.TripNumber, r.Date, r.ScheduledStartTime, r.ScheduledArrivalTime, nullIfEmpty(r.DriverName), r.BusID}
+    case ActualTripStopInfo:
+        query, args = insertActualTripStopInfo, []interface{}{r.TripNumber, r.Date, r.ScheduledStartTime, r.StopNumber, r.ScheduledArrivalTime, r.ActualStartTime, r.ActualArrivalTime, r.NumberOfPassengerIn, r.NumberOfPassengerOut}
+    case ServicePattern:
+        query, args = insertServicePattern, []interface{}{r.PatternName, r.TripNumber, r.DaysOfWeek, r.ScheduledStartTime, r.ScheduledArrivalTime, r.EffectiveFrom, r.EffectiveTo, r.DriverName, r.BusID}
+    case Holiday:
+        query, args = insertHoliday, []interface{}{r.Date, r.HolidayName, r.ServiceAs}
+    case ServiceException:
+        query, args = insertServiceException, []interface{}{tripOrAll(r.TripNumber), r.Date, r.ExceptionType, r.Reason}
+    default:
+        return fmt.Errorf("Cannot insert %T", row)
+    }
+    if _, err := db.exec(query, args...); err != nil {
+        return err
+    }
+    return db.record(nil, row)
+}
+
+// insert inserts a single row and logs it in one transaction
+func (db *Database) insert(row interface{}) error {
+    return db.WithTx(func(tx *Database) error {
+        return tx.insertRow(row)
+    })
+}
+
+// nullIfEmpty stores an empty string as NULL
+func nullIfEmpty(s string) interface{} {
+    if s == "" {
+        return nil
+    }
+    return s
+}
@@ -0,0 +1,287 @@
+// Service dates and times of day
+package transit
+
+import (
+    "database/sql/driver"
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    serviceDateLayout = "2006-01-02"
+    // MaxServiceHours bounds times of day, allowing service that runs past
+    // midnight to be written as 24:00 to 47:59 on the day it started
+    MaxServiceHours = 48
+)
+
+// ServiceDate is a calendar day of service. The zero value means no date.
+type ServiceDate struct {
+    t time.Time // midnight UTC
+}
+
+// NewServiceDate returns the service date for a year, month and day,
+// normalising out of range values as time.Date does
+func NewServiceDate(year int, month time.Month, day int) ServiceDate {
+    return ServiceDate{time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+// ServiceDateOf returns the calendar day of t in its own location
+func ServiceDateOf(t time.Time) ServiceDate {
+    return NewServiceDate(t.Year(), t.Month(), t.Day())
+}
+
+// Today returns the service date of the current local day
+func Today() ServiceDate {
+    return ServiceDateOf(time.Now())
+}
+
+// ParseServiceDate parses a YYYY-MM-DD date
+func ParseServiceDate(s string) (ServiceDate, error) {
+    t, err := time.Parse(serviceDateLayout, strings.TrimSpace(s))
+    if err != nil {
+        return ServiceDate{}, invalidf("Invalid date %q, expected YYYY-MM-DD", s)
+    }
+    return ServiceDate{t}, nil
+}
+
+// IsZero reports whether d is the zero value
+func (d ServiceDate) IsZero() bool {
+    return d.t.IsZero()
+}
+
+func (d ServiceDate) String() string {
+    if d.IsZero() {
+        return ""
+    }
+    return d.t.Format(serviceDateLayout)
+}
+
+// Time returns midnight UTC at the start of d
+func (d ServiceDate) Time() time.Time {
+    return d.t
+}
+
+// Weekday returns the day of the week of d
+func (d ServiceDate) Weekday() time.Weekday {
+    return d.t.Weekday()
+}
+
+// AddDays returns the date n days after d, or before it if n is negative
+func (d ServiceDate) AddDays(n int) ServiceDate {
+    return ServiceDate{d.t.AddDate(0, 0, n)}
+}
+
+// DaysSince returns the number of days from u to d
+func (d ServiceDate) DaysSince(u ServiceDate) int {
+    return int(d.t.Sub(u.t).Hours() / 24)
+}
+
+// Before reports whether d is earlier than u
+func (d ServiceDate) Before(u ServiceDate) bool {
+    return d.t.Before(u.t)
+}
+
+// After reports whether d is later than u
+func (d ServiceDate) After(u ServiceDate) bool {
+    return d.t.After(u.t)
+}
+
+// Equal reports whether d and u are the same day
+func (d ServiceDate) Equal(u ServiceDate) bool {
+    return d.t.Equal(u.t)
+}
+
+// SameWeek reports whether d and u fall in the same ISO week
+func (d ServiceDate) SameWeek(u ServiceDate) bool {
+    year1, week1 := d.t.ISOWeek()
+    year2, week2 := u.t.ISOWeek()
+    return year1 == year2 && week1 == week2
+}
+
+// At returns the instant a time of day on d falls at in loc. Times past
+// midnight fall on the following days.
+func (d ServiceDate) At(t TimeOfDay, loc *time.Location) time.Time {
+    return time.Date(d.t.Year(), d.t.Month(), d.t.Day(), 0, 0, t.seconds, 0, loc)
+}
+
+// Scan reads a DATE column. The driver returns values of DATE columns as
+// time.Time when they parse as dates and as text otherwise.
+func (d *ServiceDate) Scan(value interface{}) error {
+    switch v := value.(type) {
+    case time.Time:
+        *d = ServiceDateOf(v)
+        return nil
+    case string:
+        return d.UnmarshalText([]byte(v))
+    case []byte:
+        return d.UnmarshalText(v)
+    case nil:
+        *d = ServiceDate{}
+        return nil
+    }
+    return fmt.Errorf("Cannot scan %T as a date", value)
+}
+
+// Value stores d as YYYY-MM-DD text, or NULL for the zero value
+func (d ServiceDate) Value() (driver.Value, error) {
+    if d.IsZero() {
+        return nil, nil
+    }
+    return d.String(), nil
+}
+
+func (d ServiceDate) MarshalText() ([]byte, error) {
+    return []byte(d.String()), nil
+}
+
+func (d *ServiceDate) UnmarshalText(text []byte) error {
+    if len(text) == 0 {
+        *d = ServiceDate{}
+        return nil
+    }
+    // Tolerate timestamps written by older versions of the driver
+    s := string(text)
+    if len(s) > len(serviceDateLayout) && s[len(serviceDateLayout)] == 'T' {
+        s = s[:len(serviceDateLayout)]
+    }
+    parsed, err := ParseServiceDate(s)
+    if err != nil {
+        return err
+    }
+    *d = parsed
+    return nil
+}
+
+// TimeOfDay is a time measured from midnight at the start of the service
+// day. Service that runs past midnight may be written as 24:00 or later, so
+// 25:10 is ten past one the next morning. The zero value means no time.
+type TimeOfDay struct {
+    seconds int
+    valid   bool
+}
+
+// NewTimeOfDay returns the time the given hours, minutes and seconds after
+// the start of the service day
+func NewTimeOfDay(hours, minutes, seconds int) TimeOfDay {
+    return TimeOfDay{seconds: hours*3600 + minutes*60 + seconds, valid: true}
+}
+
+// ParseTimeOfDay parses an HH:MM or HH:MM:SS time. Hours may run up to
+// MaxServiceHours for service after midnight.
+func ParseTimeOfDay(s string) (TimeOfDay, error) {
+    parts := strings.Split(strings.TrimSpace(s), ":")
+    if len(parts) < 2 || len(parts) > 3 {
+        return TimeOfDay{}, invalidf("Invalid time %q, expected HH:MM", s)
+    }
+    values := []int{0, 0, 0}
+    for i, p := range parts {
+        n, err := strconv.Atoi(p)
+        if err != nil || n < 0 || (i > 0 && (n > 59 || len(p) != 2)) || (i == 0 && n >= MaxServiceHours) {
+            return TimeOfDay{}, invalidf("Invalid time %q, expected HH:MM", s)
+        }
+        values[i] = n
+    }
+    return NewTimeOfDay(values[0], values[1], values[2]), nil
+}
+
+// IsZero reports whether t is the zero value, which is not midnight
+func (t TimeOfDay) IsZero() bool {
+    return !t.valid
+}
+
+// String formats t as HH:MM, or HH:MM:SS if it has seconds
+func (t TimeOfDay) String() string {
+    if t.IsZero() {
+        return ""
+    }
+    if t.seconds%60 != 0 {
+        return t.StringWithSeconds()
+    }
+    return fmt.Sprintf("%02d:%02d", t.seconds/3600, t.seconds/60%60)
+}
+
+// StringWithSeconds formats t as HH:MM:SS
+func (t TimeOfDay) StringWithSeconds() string {
+    if t.IsZero() {
+        return ""
+    }
+    return fmt.Sprintf("%02d:%02d:%02d", t.seconds/3600, t.seconds/60%60, t.seconds%60)
+}
+
+// Seconds returns the seconds since the start of the service day
+func (t TimeOfDay) Seconds() int {
+    return t.seconds
+}
+
+// Minutes returns the whole minutes since the start of the service day
+func (t TimeOfDay) Minutes() int {
+    return t.seconds / 60
+}
+
+// Add returns t moved by d
+func (t TimeOfDay) Add(d time.Duration) TimeOfDay {
+    return TimeOfDay{seconds: t.seconds + int(d/time.Second), valid: t.valid}
+}
+
+// Sub returns the duration from u to t
+func (t TimeOfDay) Sub(u TimeOfDay) time.Duration {
+    return time.Duration(t.seconds-u.seconds) * time.Second
+}
+
+// Before reports whether t is earlier than u
+func (t TimeOfDay) Before(u TimeOfDay) bool {
+    return t.seconds < u.seconds
+}
+
+// After reports whether t is later than u
+func (t TimeOfDay) After(u TimeOfDay) bool {
+    return t.seconds > u.seconds
+}
+
+// Normalize returns t as a clock time before 24:00 together with the
+// number of days past the service day it falls on
+func (t TimeOfDay) Normalize() (TimeOfDay, int) {
+    day := 24 * 3600
+    return TimeOfDay{seconds: t.seconds % day, valid: t.valid}, t.seconds / day
+}
+
+// Scan reads a time column stored as text
+func (t *TimeOfDay) Scan(value interface{}) error {
+    switch v := value.(type) {
+    case string:
+        return t.UnmarshalText([]byte(v))
+    case []byte:
+        return t.UnmarshalText(v)
+    case nil:
+        *t = TimeOfDay{}
+        return nil
+    }
+    return fmt.Errorf("Cannot scan %T as a time", value)
+}
+
+// Value stores t as text, or NULL for the zero value
+func (t TimeOfDay) Value() (driver.Value, error) {
+    if t.IsZero() {
+        return nil, nil
+    }
+    return t.String(), nil
+}
+
+func (t TimeOfDay) MarshalText() ([]byte, error) {
+    return []byte(t.String()), nil
+}
+
+func (t *TimeOfDay) UnmarshalText(text []byte) error {
+    if len(text) == 0 {
+        *t = TimeOfDay{}
+        return nil
+    }
+    parsed, err := ParseTimeOfDay(string(text))
+    if err != nil {
+        return err
+    }
+    *t = parsed
+    return nil
+}
@@ -0,0 +1,209 @@
+package transit_test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+func TestParseServiceDate(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"2026-10-19", "2026-10-19", true},
+		{" 2026-10-19 ", "2026-10-19", true},
+		{"2024-02-29", "2024-02-29", true},
+		{"2026-02-29", "", false},
+		{"2026-13-01", "", false},
+		{"19/10/2026", "", false},
+		{"2026-10-19T00:00:00Z", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		d, err := transit.ParseServiceDate(tt.in)
+		if !tt.ok {
+			if !errors.Is(err, transit.ErrInvalid) {
+				t.Errorf("ParseServiceDate(%q) = %v, %v, want an invalid input error", tt.in, d, err)
+			}
+			continue
+		}
+		if err != nil || d.String() != tt.want {
+			t.Errorf("ParseServiceDate(%q) = %v, %v, want %s", tt.in, d, err, tt.want)
+		}
+	}
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"08:05", "08:05", true},
+		{"8:05", "08:05", true},
+		{"00:00", "00:00", true},
+		{"23:59:30", "23:59:30", true},
+		{"24:00", "24:00", true},
+		{"25:10", "25:10", true},
+		{"47:59", "47:59", true},
+		{"48:00", "", false},
+		{"12:60", "", false},
+		{"12:5", "", false},
+		{"-1:00", "", false},
+		{"12", "", false},
+		{"1:2:3:4", "", false},
+		{"noon", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		tod, err := transit.ParseTimeOfDay(tt.in)
+		if !tt.ok {
+			if !errors.Is(err, transit.ErrInvalid) {
+				t.Errorf("ParseTimeOfDay(%q) = %v, %v, want an invalid input error", tt.in, tod, err)
+			}
+			continue
+		}
+		if err != nil || tod.String() != tt.want {
+			t.Errorf("ParseTimeOfDay(%q) = %v, %v, want %s", tt.in, tod, err, tt.want)
+		}
+	}
+}
+
+func TestTimeOfDayAfterMidnight(t *testing.T) {
+	tests := []struct {
+		in         string
+		add        time.Duration
+		want       string
+		normalized string
+		days       int
+	}{
+		{"23:50", 20 * time.Minute, "24:10", "00:10", 1},
+		{"22:00", 3 * time.Hour, "25:00", "01:00", 1},
+		{"47:00", 30 * time.Minute, "47:30", "23:30", 1},
+		{"00:30", -20 * time.Minute, "00:10", "00:10", 0},
+		{"12:00", 0, "12:00", "12:00", 0},
+	}
+	for _, tt := range tests {
+		start, err := transit.ParseTimeOfDay(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := start.Add(tt.add)
+		if got.String() != tt.want {
+			t.Errorf("%s + %v = %s, want %s", tt.in, tt.add, got, tt.want)
+		}
+		if d := got.Sub(start); d != tt.add {
+			t.Errorf("%s - %s = %v, want %v", got, start, d, tt.add)
+		}
+		if norm, days := got.Normalize(); norm.String() != tt.normalized || days != tt.days {
+			t.Errorf("%s normalizes to %s and %d days, want %s and %d", got, norm, days, tt.normalized, tt.days)
+		}
+	}
+
+	date, err := transit.ParseServiceDate("2026-10-31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	late, err := transit.ParseTimeOfDay("25:10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := date.At(late, time.UTC), time.Date(2026, 11, 1, 1, 10, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("%s at %s = %v, want %v", date, late, got, want)
+	}
+	if got := date.AddDays(1).String(); got != "2026-11-01" {
+		t.Errorf("%s plus a day = %s, want 2026-11-01", date, got)
+	}
+}
+
+func TestZeroDatesAndTimes(t *testing.T) {
+	var d transit.ServiceDate
+	var tod transit.TimeOfDay
+	if !d.IsZero() || d.String() != "" {
+		t.Errorf("Zero date %q, want empty", d)
+	}
+	if !tod.IsZero() || tod.String() != "" {
+		t.Errorf("Zero time %q, want empty", tod)
+	}
+	// Midnight is a time, not the absence of one
+	if midnight := transit.NewTimeOfDay(0, 0, 0); midnight.IsZero() || midnight.String() != "00:00" {
+		t.Errorf("Midnight %q, IsZero %v, want 00:00 and not zero", midnight, midnight.IsZero())
+	}
+	for _, v := range []interface {
+		Value() (driver.Value, error)
+	}{d, tod} {
+		if got, err := v.Value(); got != nil || err != nil {
+			t.Errorf("Value of zero %T = %v, %v, want NULL", v, got, err)
+		}
+	}
+}
+
+func TestScanValueRoundTrip(t *testing.T) {
+	dates := []struct {
+		stored interface{}
+		want   string
+	}{
+		{"2026-10-19", "2026-10-19"},
+		{[]byte("2026-10-19"), "2026-10-19"},
+		{time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), "2026-10-19"},
+		{"2026-10-19T00:00:00Z", "2026-10-19"},
+		{nil, ""},
+	}
+	for _, tt := range dates {
+		var d transit.ServiceDate
+		if err := d.Scan(tt.stored); err != nil {
+			t.Errorf("Scanning date %#v: %v", tt.stored, err)
+			continue
+		}
+		if d.String() != tt.want {
+			t.Errorf("Scanned date %#v as %q, want %q", tt.stored, d, tt.want)
+		}
+		var again transit.ServiceDate
+		v, err := d.Value()
+		if err == nil {
+			err = again.Scan(v)
+		}
+		if err != nil || !again.Equal(d) {
+			t.Errorf("Date %q stored as %#v scans back as %q, %v", d, v, again, err)
+		}
+	}
+	var d transit.ServiceDate
+	if err := d.Scan(19); err == nil {
+		t.Errorf("Scanned an int as the date %q, want an error", d)
+	}
+
+	times := []struct {
+		stored interface{}
+		want   string
+	}{
+		{"08:05", "08:05"},
+		{[]byte("25:10"), "25:10"},
+		{"23:59:30", "23:59:30"},
+		{nil, ""},
+	}
+	for _, tt := range times {
+		var tod transit.TimeOfDay
+		if err := tod.Scan(tt.stored); err != nil {
+			t.Errorf("Scanning time %#v: %v", tt.stored, err)
+			continue
+		}
+		if tod.String() != tt.want {
+			t.Errorf("Scanned time %#v as %q, want %q", tt.stored, tod, tt.want)
+		}
+		var again transit.TimeOfDay
+		v, err := tod.Value()
+		if err == nil {
+			err = again.Scan(v)
+		}
+		if err != nil || again != tod {
+			t.Errorf("Time %q stored as %#v scans back as %q, %v", tod, v, again, err)
+		}
+	}
+	var tod transit.TimeOfDay
+	if err := tod.Scan("half past"); !errors.Is(err, transit.ErrInvalid) {
+		t.Errorf("Scanning an unparsable time: got %v, want an invalid input error", err)
+	}
+}
@@ -0,0 +1,152 @@
+// Multi-leg journey planning over trips and their offerings
+package transit
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+)
+
+const selectOfferingsByDate = selectTripOfferings + ` WHERE Date = ?`
+
+// Leg is one ride on a trip offering within an itinerary
+type Leg struct {
+    Trip     Trip
+    Offering TripOffering
+    depart   int // minutes after midnight
+    arrive   int
+}
+
+func (l Leg) String() string {
+    return fmt.Sprintf("Trip %d: %s %s -> %s %s (driver %s, bus %s)", l.Trip.TripNumber, l.Trip.StartLocationName, l.Offering.ScheduledStartTime, l.Trip.DestinationName, l.Offering.ScheduledArrivalTime, l.Offering.DriverName, BusText(l.Offering.BusID))
+}
+
+// Itinerary is a sequence of connecting legs from an origin to a destination
+type Itinerary struct {
+    Legs []Leg
+}
+
+// Departure returns the scheduled start time of the first leg
+func (it Itinerary) Departure() TimeOfDay {
+    return it.Legs[0].Offering.ScheduledStartTime
+}
+
+// Arrival returns the scheduled arrival time of the last leg
+func (it Itinerary) Arrival() TimeOfDay {
+    return it.Legs[len(it.Legs)-1].Offering.ScheduledArrivalTime
+}
+
+// Transfers returns the number of changes between trips
+func (it Itinerary) Transfers() int {
+    return len(it.Legs) - 1
+}
+
+func (it Itinerary) String() string {
+    legs := []string{}
+    for _, l := range it.Legs {
+        legs = append(legs, l.String())
+    }
+    return fmt.Sprintf("Depart: %s\nArrive: %s\nTransfers: %d\n%s", it.Departure(), it.Arrival(), it.Transfers(), strings.Join(legs, "\n"))
+}
+
+// JourneyOptions configures PlanJourney. Zero MaxResults uses the default
+// below; MinTransferTime and MaxTransfers are used as given, so 0 allows
+// catching a trip that leaves the minute the last one arrives, and no
+// transfers at all.
+type JourneyOptions struct {
+    MinTransferTime int // minutes needed to change between trips
+    MaxTransfers    int
+    MaxResults      int
+}
+
+const (
+    DefaultMinTransferTime = 5
+    DefaultMaxTransfers    = 3
+    DefaultMaxResults      = 5
+)
+
+// PlanJourney finds itineraries from origin to destination on date that leave
+// no earlier than earliest. Itineraries are ranked by arrival time, then by
+// number of transfers, then by latest departure.
+func (db *Database) PlanJourney(origin, destination string, date ServiceDate, earliest TimeOfDay, opts JourneyOptions) ([]Itinerary, error) {
+    if opts.MinTransferTime < 0 {
+        return []Itinerary{}, invalidf("Minimum transfer time cannot be negative, got %d", opts.MinTransferTime)
+    }
+    if opts.MaxTransfers < 0 {
+        return []Itinerary{}, invalidf("Maximum transfers cannot be negative, got %d", opts.MaxTransfers)
+    }
+    if opts.MaxResults == 0 {
+        opts.MaxResults = DefaultMaxResults
+    }
+    result := []Itinerary{}
+    if earliest.IsZero() {
+        return result, invalidf("An earliest departure time is required")
+    }
+    start := earliest.Minutes()
+    trips, err := db.GetTripTable()
+    if err != nil {
+        return result, err
+    }
+    tripByNumber := make(map[int]Trip)
+    for _, t := range trips {
+        tripByNumber[t.TripNumber] = t
+    }
+    row, err := db.query(selectOfferingsByDate, date)
+    if err != nil {
+        return result, err
+    }
+    offerings := RowToTripOfferings(row)
+    row.Close()
+    // Index the day's legs by the location they leave from
+    departures := make(map[string][]Leg)
+    for _, o := range offerings {
+        t, ok := tripByNumber[o.TripNumber]
+        if !ok {
+            continue
+        }
+        depart, arrive, err := offeringWindow(o)
+        if err != nil {
+            continue
+        }
+        departures[t.StartLocationName] = append(departures[t.StartLocationName], Leg{Trip: t, Offering: o, depart: depart, arrive: arrive})
+    }
+    var search func(location string, ready int, legs []Leg, visited map[string]bool)
+    search = func(location string, ready int, legs []Leg, visited map[string]bool) {
+        for _, l := range departures[location] {
+            if l.depart < ready || visited[l.Trip.DestinationName] {
+                continue
+            }
+            path := append(append([]Leg{}, legs...), l)
+            if l.Trip.DestinationName == destination {
+                result = append(result, Itinerary{Legs: path})
+                continue
+            }
+            if len(path) > opts.MaxTransfers {
+                continue
+            }
+            visited[l.Trip.DestinationName] = true
+            search(l.Trip.DestinationName, l.arrive+opts.MinTransferTime, path, visited)
+            delete(visited, l.Trip.DestinationName)
+        }
+    }
+    search(origin, start, []Leg{}, map[string]bool{origin: true})
+    sort.SliceStable(result, func(i, j int) bool {
+        a, b := result[i], result[j]
+        if a.arrival() != b.arrival() {
+            return a.arrival() < b.arrival()
+        }
+        if a.Transfers() != b.Transfers() {
+            return a.Transfers() < b.Transfers()
+        }
+        return a.Legs[0].depart > b.Legs[0].depart
+    })
+    if len(result) > opts.MaxResults {
+        result = result[:opts.MaxResults]
+    }
+    return result, nil
+}
+
+// arrival returns the final arrival in minutes after midnight
+func (it Itinerary) arrival() int {
+    return it.Legs[len(it.Legs)-1].arrive
+}
@@ -0,0 +1,72 @@
+package transit_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+func TestJourneyMinTransferTime(t *testing.T) {
+	db := openMemory(t)
+	date := mustParseDate(t, "2026-10-19")
+	for _, err := range []error{
+		db.AddTrip(1, "Pomona", "Claremont"),
+		db.AddTrip(2, "Claremont", "Upland"),
+		db.AddBus(1, "Gillig", 2015),
+		db.AddBus(2, "Gillig", 2015),
+		db.AddBus(3, "Gillig", 2015),
+		db.AddDriver("Ann", "555-0100"),
+		db.AddDriver("Bob", "555-0101"),
+		db.AddDriver("Cy", "555-0102"),
+		db.AddOffering(1, date, mustParseTime(t, "10:00"), mustParseTime(t, "10:30"), "Ann", 1),
+		db.AddOffering(2, date, mustParseTime(t, "10:30"), mustParseTime(t, "11:00"), "Bob", 2),
+		db.AddOffering(2, date, mustParseTime(t, "10:45"), mustParseTime(t, "11:15"), "Cy", 3),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		minTransfer int
+		arrival     string
+	}{
+		{0, "11:00"},
+		{transit.DefaultMinTransferTime, "11:15"},
+		{20, ""},
+	}
+	for _, tt := range tests {
+		itineraries, err := db.PlanJourney("Pomona", "Upland", date, mustParseTime(t, "09:00"), transit.JourneyOptions{MinTransferTime: tt.minTransfer, MaxTransfers: transit.DefaultMaxTransfers})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if len(itineraries) > 0 {
+			got = itineraries[0].Arrival().String()
+		}
+		if got != tt.arrival {
+			t.Errorf("With %d min to transfer got the first arrival %q, want %q", tt.minTransfer, got, tt.arrival)
+		}
+	}
+	for _, opts := range []transit.JourneyOptions{{MinTransferTime: -1}, {MaxTransfers: -1}} {
+		if _, err := db.PlanJourney("Pomona", "Upland", date, mustParseTime(t, "09:00"), opts); !errors.Is(err, transit.ErrInvalid) {
+			t.Errorf("Negative options %+v: got %v, want an invalid input error", opts, err)
+		}
+	}
+	// With no transfers allowed only the direct trip is found
+	for _, tt := range []struct {
+		destination string
+		want        int
+	}{
+		{"Upland", 0},
+		{"Claremont", 1},
+	} {
+		itineraries, err := db.PlanJourney("Pomona", tt.destination, date, mustParseTime(t, "09:00"), transit.JourneyOptions{MaxTransfers: 0})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(itineraries) != tt.want {
+			t.Errorf("To %s with no transfers got %v, want %d itineraries", tt.destination, itineraries, tt.want)
+		}
+	}
+}
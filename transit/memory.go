@@ -0,0 +1,470 @@
+// A Store kept in memory, for tests and tools that need no database file
+package transit
+
+import (
+    "fmt"
+    "sort"
+    "sync"
+)
+
+// MemoryStore is a Store that keeps its rows in memory. It enforces the same
+// keys and references as the SQLite schema and returns rows in the same
+// order, so code written against Store behaves the same on either backend.
+// Holidays and service exceptions are not stored, so every trip runs on
+// every date.
+type MemoryStore struct {
+    data       *memoryData
+    onConflict func(*ConflictError) // nil rejects double-bookings
+}
+
+// memoryData holds the rows of every table in the order they were added
+type memoryData struct {
+    mu           sync.Mutex
+    trips        []Trip
+    offerings    []TripOffering
+    buses        []Bus
+    drivers      []Driver
+    stops        []Stop
+    tripStops    []TripStopInfo
+    observations []ActualTripStopInfo
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+    return &MemoryStore{data: &memoryData{}}
+}
+
+// Override returns a handle on the same store that accepts double-bookings,
+// passing each conflict to warn instead of rejecting the change
+func (m *MemoryStore) Override(warn func(*ConflictError)) *MemoryStore {
+    o := *m
+    o.onConflict = warn
+    return &o
+}
+
+// uniquef reports a duplicate key in the words SQLite uses
+func uniquef(columns string) error {
+    return constraintError{"UNIQUE constraint failed: " + columns}
+}
+
+// errForeignKey reports a reference to a missing row, or a delete that
+// would leave references behind, in the words SQLite uses
+var errForeignKey = constraintError{"FOREIGN KEY constraint failed"}
+
+// GetTripTable returns all the trips in the store
+func (m *MemoryStore) GetTripTable() ([]Trip, error) {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    return append([]Trip{}, m.data.trips...), nil
+}
+
+// AddTrip adds a trip to the store
+func (m *MemoryStore) AddTrip(tripNumber int, startLocationName string, destinationName string) error {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    if m.data.hasTrip(tripNumber) {
+        return uniquef("Trip.TripNumber")
+    }
+    m.data.trips = append(m.data.trips, Trip{tripNumber, startLocationName, destinationName})
+    return nil
+}
+
+// GetTripStopInfoTable returns all the trip stop info in the store
+func (m *MemoryStore) GetTripStopInfoTable() ([]TripStopInfo, error) {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    return append([]TripStopInfo{}, m.data.tripStops...), nil
+}
+
+// AddTripStopInfo adds a trip stop info to the store
+func (m *MemoryStore) AddTripStopInfo(tripNumber int, stopNumber int, sequenceNumber int, drivingTime float32) error {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    for _, t := range m.data.tripStops {
+        if t.TripNumber == tripNumber && t.StopNumber == stopNumber {
+            return uniquef("TripStopInfo.TripNumber, TripStopInfo.StopNumber")
+        }
+        if t.TripNumber == tripNumber && t.SequenceNumber == sequenceNumber {
+            return uniquef("TripStopInfo.TripNumber, TripStopInfo.SequenceNumber")
+        }
+    }
+    if !m.data.hasTrip(tripNumber) || !m.data.hasStop(stopNumber) {
+        return errForeignKey
+    }
+    m.data.tripStops = append(m.data.tripStops, TripStopInfo{tripNumber, stopNumber, sequenceNumber, drivingTime})
+    return nil
+}
+
+// GetStops returns all stops for a given trip number
+func (m *MemoryStore) GetStops(tripNumber int) ([]TripStopInfo, error) {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    stops := []TripStopInfo{}
+    for _, t := range m.data.tripStops {
+        if t.TripNumber == tripNumber {
+            stops = append(stops, t)
+        }
+    }
+    sort.SliceStable(stops, func(i, j int) bool { return stops[i].SequenceNumber < stops[j].SequenceNumber })
+    return stops, nil
+}
+
+// GetTripOfferingTable returns all the offerings in the store
+func (m *MemoryStore) GetTripOfferingTable() ([]TripOffering, error) {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    return append([]TripOffering{}, m.data.offerings...), nil
+}
+
+// GetSchedule returns all trip offerings for the given information
+func (m *MemoryStore) GetSchedule(startLocationName, destinationName string, date ServiceDate) ([]Trip, map[int][]TripOffering, error) {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    trips := []Trip{}
+    offerings := make(map[int][]TripOffering)
+    for _, t := range m.data.trips {
+        if t.StartLocationName != startLocationName || t.DestinationName != destinationName {
+            continue
+        }
+        trips = append(trips, t)
+        found := []TripOffering{}
+        for _, o := range m.data.offerings {
+            if o.TripNumber == t.TripNumber && o.Date.Equal(date) {
+                found = append(found, o)
+            }
+        }
+        sortOfferings(found)
+        offerings[t.TripNumber] = found
+    }
+    return trips, offerings, nil
+}
+
+// GetDriverWeeklySchedule returns the driver's offerings in the Monday to
+// Sunday week containing date
+func (m *MemoryStore) GetDriverWeeklySchedule(driverName string, date ServiceDate) ([]TripOffering, error) {
+    monday := date.AddDays(-((int(date.Weekday()) + 6) % 7))
+    return m.GetDriverSchedule(driverName, monday, monday.AddDays(6))
+}
+
+// GetDriverSchedule returns the offerings assigned to a driver between the
+// dates from and to (inclusive), in date and start time order
+func (m *MemoryStore) GetDriverSchedule(driverName string, from ServiceDate, to ServiceDate) ([]TripOffering, error) {
+    result := []TripOffering{}
+    if from.IsZero() || to.IsZero() {
+        return result, invalidf("A date range is required")
+    }
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    for _, o := range m.data.offerings {
+        if o.DriverName == driverName && !o.Date.Before(from) && !o.Date.After(to) {
+            result = append(result, o)
+        }
+    }
+    sortOfferings(result)
+    return result, nil
+}
+
+// AddOffering adds a trip offering to the store
+func (m *MemoryStore) AddOffering(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay, scheduledArrivalTime TimeOfDay, driverName string, busID int) error {
+    return m.AddOfferings([]TripOffering{{
+        TripNumber:           tripNumber,
+        Date:                 date,
+        ScheduledStartTime:   scheduledStartTime,
+        ScheduledArrivalTime: scheduledArrivalTime,
+        DriverName:           driverName,
+        BusID:                &busID,
+    }})
+}
+
+// AddOfferings adds the set of offerings to the store. If any offering
+// cannot be added none of them are.
+func (m *MemoryStore) AddOfferings(offerings []TripOffering) (err error) {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    added := len(m.data.offerings)
+    defer func() {
+        if err != nil {
+            m.data.offerings = m.data.offerings[:added]
+        }
+    }()
+    for _, offer := range offerings {
+        if offer.Date.IsZero() {
+            return invalidf("Trip %d has no date", offer.TripNumber)
+        }
+        found, err := m.data.findConflicts(offer)
+        if err != nil {
+            return err
+        }
+        if err := resolveConflicts(found, m.onConflict, nil); err != nil {
+            return err
+        }
+        if m.data.offeringIndex(offer.TripNumber, offer.Date, offer.ScheduledStartTime) >= 0 {
+            return uniquef("TripOffering.TripNumber, TripOffering.Date, TripOffering.ScheduledStartTime")
+        }
+        if !m.data.hasTrip(offer.TripNumber) || !m.data.hasDriver(offer.DriverName) || offer.BusID != nil && !m.data.hasBus(*offer.BusID) {
+            return errForeignKey
+        }
+        m.data.offerings = append(m.data.offerings, offer)
+    }
+    return nil
+}
+
+// DeleteOffering deletes the trip offering with the given primary keys and
+// the observations recorded for it
+func (m *MemoryStore) DeleteOffering(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay) error {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    i := m.data.offeringIndex(tripNumber, date, scheduledStartTime)
+    if i < 0 {
+        return fmt.Errorf("No offering for trip %d on %s at %s: %w", tripNumber, date, scheduledStartTime, ErrNotFound)
+    }
+    m.data.offerings = append(m.data.offerings[:i], m.data.offerings[i+1:]...)
+    kept := []ActualTripStopInfo{}
+    for _, a := range m.data.observations {
+        if a.TripNumber != tripNumber || !a.Date.Equal(date) || a.ScheduledStartTime != scheduledStartTime {
+            kept = append(kept, a)
+        }
+    }
+    m.data.observations = kept
+    return nil
+}
+
+// ChangeDriver will change the driverName of the driver of the trip given by the composite key info
+func (m *MemoryStore) ChangeDriver(driverName string, tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay) error {
+    return m.changeOffering(tripNumber, date, scheduledStartTime, "driver", func(o *TripOffering) bool {
+        o.DriverName = driverName
+        return m.data.hasDriver(driverName)
+    })
+}
+
+// ChangeBus will change the BusID of the trip given the composite key info
+func (m *MemoryStore) ChangeBus(busID int, tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay) error {
+    return m.changeOffering(tripNumber, date, scheduledStartTime, "bus", func(o *TripOffering) bool {
+        o.BusID = &busID
+        return m.data.hasBus(busID)
+    })
+}
+
+// changeOffering applies change to a copy of the offering with the given
+// key, reporting whether the new reference exists, and stores the copy if
+// it neither double-books resource nor refers to a missing row
+func (m *MemoryStore) changeOffering(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay, resource string, change func(*TripOffering) bool) error {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    i := m.data.offeringIndex(tripNumber, date, scheduledStartTime)
+    if i < 0 {
+        return fmt.Errorf("No offering for trip %d on %s at %s: %w", tripNumber, date, scheduledStartTime, ErrNotFound)
+    }
+    offer := m.data.offerings[i]
+    exists := change(&offer)
+    found, err := m.data.findConflicts(offer)
+    if err != nil {
+        return err
+    }
+    if err := resolveConflicts(found, m.onConflict, []string{resource}); err != nil {
+        return err
+    }
+    if !exists {
+        return errForeignKey
+    }
+    m.data.offerings[i] = offer
+    return nil
+}
+
+// FindConflicts returns every offering that shares a driver or bus with o and
+// overlaps its scheduled window, including offerings of the days around its
+// date that run past midnight
+func (m *MemoryStore) FindConflicts(o TripOffering) ([]*ConflictError, error) {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    return m.data.findConflicts(o)
+}
+
+// GetBusTable returns all the buses in the store
+func (m *MemoryStore) GetBusTable() ([]Bus, error) {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    return append([]Bus{}, m.data.buses...), nil
+}
+
+// AddBus adds a bus to the store
+func (m *MemoryStore) AddBus(busID int, model string, year int) error {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    if m.data.hasBus(busID) {
+        return uniquef("Bus.BusID")
+    }
+    m.data.buses = append(m.data.buses, Bus{BusID: busID, Model: model, Year: year})
+    return nil
+}
+
+// DeleteBus deletes a bus that no offering is assigned to
+func (m *MemoryStore) DeleteBus(busID int) error {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    for i, b := range m.data.buses {
+        if b.BusID != busID {
+            continue
+        }
+        for _, o := range m.data.offerings {
+            if o.HasBus(busID) {
+                return errForeignKey
+            }
+        }
+        m.data.buses = append(m.data.buses[:i], m.data.buses[i+1:]...)
+        return nil
+    }
+    return fmt.Errorf("No bus %d: %w", busID, ErrNotFound)
+}
+
+// GetDriverTable returns all the drivers in the store
+func (m *MemoryStore) GetDriverTable() ([]Driver, error) {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    return append([]Driver{}, m.data.drivers...), nil
+}
+
+// AddDriver adds a driver to the store
+func (m *MemoryStore) AddDriver(driverName string, driverTelephoneNumber string) error {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    if m.data.hasDriver(driverName) {
+        return uniquef("Driver.DriverName")
+    }
+    m.data.drivers = append(m.data.drivers, Driver{DriverName: driverName, DriverTelephoneNumber: driverTelephoneNumber})
+    return nil
+}
+
+// GetStopTable returns all the stops in the store
+func (m *MemoryStore) GetStopTable() ([]Stop, error) {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    return append([]Stop{}, m.data.stops...), nil
+}
+
+// AddStop adds a stop to the store
+func (m *MemoryStore) AddStop(stopNumber int, stopAddress string) error {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    if m.data.hasStop(stopNumber) {
+        return uniquef("Stop.StopNumber")
+    }
+    m.data.stops = append(m.data.stops, Stop{stopNumber, stopAddress})
+    return nil
+}
+
+// GetActualTripStopInfoTable returns all the actual stop info in the store
+func (m *MemoryStore) GetActualTripStopInfoTable() ([]ActualTripStopInfo, error) {
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    return append([]ActualTripStopInfo{}, m.data.observations...), nil
+}
+
+// AddActualTripStopInfo adds an actual trip stop info to the store
+func (m *MemoryStore) AddActualTripStopInfo(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay, stopNumber int, scheduledArrivalTime TimeOfDay, actualStartTime TimeOfDay, actualArrivalTime TimeOfDay, numberOfPassengerIn int, numberOfPassengerOut int) error {
+    if date.IsZero() || scheduledStartTime.IsZero() {
+        return invalidf("A date and scheduled start time are required")
+    }
+    m.data.mu.Lock()
+    defer m.data.mu.Unlock()
+    for _, a := range m.data.observations {
+        if a.TripNumber == tripNumber && a.Date.Equal(date) && a.ScheduledStartTime == scheduledStartTime && a.StopNumber == stopNumber {
+            return uniquef("ActualTripStopInfo.TripNumber, ActualTripStopInfo.Date, ActualTripStopInfo.ScheduledStartTime, ActualTripStopInfo.StopNumber")
+        }
+    }
+    if m.data.offeringIndex(tripNumber, date, scheduledStartTime) < 0 || !m.data.hasStop(stopNumber) {
+        return errForeignKey
+    }
+    m.data.observations = append(m.data.observations, ActualTripStopInfo{
+        TripNumber:           tripNumber,
+        Date:                 date,
+        ScheduledStartTime:   scheduledStartTime,
+        StopNumber:           stopNumber,
+        ScheduledArrivalTime: scheduledArrivalTime,
+        ActualStartTime:      actualStartTime,
+        ActualArrivalTime:    actualArrivalTime,
+        NumberOfPassengerIn:  numberOfPassengerIn,
+        NumberOfPassengerOut: numberOfPassengerOut,
+    })
+    return nil
+}
+
+// The methods of memoryData expect the caller to hold mu
+
+// findConflicts is FindConflicts over the offerings in memory
+func (d *memoryData) findConflicts(o TripOffering) ([]*ConflictError, error) {
+    start, end, err := offeringWindow(o)
+    if err != nil {
+        return []*ConflictError{}, err
+    }
+    others := []TripOffering{}
+    for _, other := range d.offerings {
+        days := other.Date.DaysSince(o.Date)
+        if days < -conflictDays || days > conflictDays || other.DriverName != o.DriverName && !sharesBus(other, o) {
+            continue
+        }
+        if other.TripNumber == o.TripNumber && other.Date.Equal(o.Date) && other.ScheduledStartTime == o.ScheduledStartTime {
+            continue
+        }
+        others = append(others, other)
+    }
+    return findConflicts(o, start, end, others), nil
+}
+
+// offeringIndex returns the position of the offering with the given key, or
+// -1 if there is none
+func (d *memoryData) offeringIndex(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay) int {
+    for i, o := range d.offerings {
+        if o.TripNumber == tripNumber && o.Date.Equal(date) && o.ScheduledStartTime == scheduledStartTime {
+            return i
+        }
+    }
+    return -1
+}
+
+func (d *memoryData) hasTrip(tripNumber int) bool {
+    for _, t := range d.trips {
+        if t.TripNumber == tripNumber {
+            return true
+        }
+    }
+    return false
+}
+
+func (d *memoryData) hasBus(busID int) bool {
+    for _, b := range d.buses {
+        if b.BusID == busID {
+            return true
+        }
+    }
+    return false
+}
+
+func (d *memoryData) hasDriver(driverName string) bool {
+    for _, dr := range d.drivers {
+        if dr.DriverName == driverName {
+            return true
+        }
+    }
+    return false
+}
+
+func (d *memoryData) hasStop(stopNumber int) bool {
+    for _, s := range d.stops {
+        if s.StopNumber == stopNumber {
+            return true
+        }
+    }
+    return false
+}
+
+// sortOfferings sorts offerings by date and then start time, as the SQL
+// queries order them
+func sortOfferings(offerings []TripOffering) {
+    sort.SliceStable(offerings, func(i, j int) bool {
+        if !offerings[i].Date.Equal(offerings[j].Date) {
+            return offerings[i].Date.Before(offerings[j].Date)
+        }
+        return offerings[i].ScheduledStartTime.Before(offerings[j].ScheduledStartTime)
+    })
+}
@@ -0,0 +1,204 @@
+// Schema migration runner for the transit database
+package transit
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/mattn/go-sqlite3"
+)
+
+const (
+    createSchemaVersion = `CREATE TABLE IF NOT EXISTS schema_version (Version INT NOT NULL PRIMARY KEY, Name VARCHAR(50), AppliedAt VARCHAR(50))`
+    selectSchemaVersion = `SELECT COALESCE(MAX(Version), 0) FROM schema_version`
+    insertSchemaVersion = `INSERT INTO schema_version (Version, Name, AppliedAt) VALUES (?, ?, ?)`
+    deleteSchemaVersion = `DELETE FROM schema_version WHERE Version = ?`
+
+    // A migration that cannot copy every row of a table counts the rows it
+    // set aside here
+    createRejectedRows = `CREATE TEMP TABLE IF NOT EXISTS RejectedRows (TableName VARCHAR(50), Rows INT)`
+    selectRejectedRows = `SELECT TableName, Rows FROM temp.RejectedRows WHERE Rows > 0 ORDER BY rowid`
+    dropRejectedRows   = `DROP TABLE temp.RejectedRows`
+)
+
+// LatestSchemaVersion returns the version of the newest known migration
+func LatestSchemaVersion() int {
+    return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the schema version recorded in the database
+func (db *Database) SchemaVersion() (int, error) {
+    // A read-only database has no table to create when it is up to date
+    if _, err := db.sqlConn().Exec(createSchemaVersion); err != nil && !isReadOnly(err) {
+        return 0, err
+    }
+    var version int
+    err := db.sqlConn().QueryRow(selectSchemaVersion).Scan(&version)
+    return version, err
+}
+
+// checkSchemaVersion reports a schema that is not at the latest version,
+// for databases that cannot be migrated
+func (db *Database) checkSchemaVersion() error {
+    current, err := db.SchemaVersion()
+    if err != nil {
+        return err
+    }
+    if current != LatestSchemaVersion() {
+        return fmt.Errorf("Database schema is at version %d but this program needs version %d, open it read-write to migrate", current, LatestSchemaVersion())
+    }
+    return nil
+}
+
+// isReadOnly reports whether err is SQLite refusing to write
+func isReadOnly(err error) bool {
+    var sqliteErr sqlite3.Error
+    return errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrReadonly
+}
+
+// Migrate brings the schema up to the latest version
+func (db *Database) Migrate() error {
+    return db.MigrateTo(LatestSchemaVersion())
+}
+
+// MigrateTo applies up or down migrations until the schema is at the given version
+func (db *Database) MigrateTo(version int) error {
+    if version < 0 || version > LatestSchemaVersion() {
+        return invalidf("Unknown schema version %d", version)
+    }
+    // Migrations need a connection of their own to turn off foreign keys
+    if db.tx != nil {
+        return invalidf("Cannot migrate the schema inside a transaction")
+    }
+    current, err := db.SchemaVersion()
+    if err != nil {
+        return err
+    }
+    if current > LatestSchemaVersion() {
+        return fmt.Errorf("Database schema version %d is newer than this program (%d)", current, LatestSchemaVersion())
+    }
+    for current < version {
+        m := migrations[current]
+        log.Printf("Migrating schema up to version %d (%s)\n", m.Version, m.Name)
+        if err := db.applyMigration(m.Up, func(tx *sql.Tx) error {
+            _, err := tx.Exec(insertSchemaVersion, m.Version, m.Name, time.Now().Format(time.RFC3339))
+            return err
+        }); err != nil {
+            return fmt.Errorf("Migration %d (%s) failed: %v", m.Version, m.Name, err)
+        }
+        current = m.Version
+    }
+    for current > version {
+        m := migrations[current-1]
+        log.Printf("Migrating schema down from version %d (%s)\n", m.Version, m.Name)
+        if err := db.applyMigration(m.Down, func(tx *sql.Tx) error {
+            _, err := tx.Exec(deleteSchemaVersion, m.Version)
+            return err
+        }); err != nil {
+            return fmt.Errorf("Reverting migration %d (%s) failed: %v", m.Version, m.Name, err)
+        }
+        current = m.Version - 1
+    }
+    return nil
+}
+
+// applyMigration runs script and record in one transaction. Foreign keys are
+// switched off while tables are rebuilt and checked before committing.
+func (db *Database) applyMigration(script string, record func(*sql.Tx) error) error {
+    ctx := context.Background()
+    conn, err := db.DB.Conn(ctx)
+    if err != nil {
+        return err
+    }
+    defer conn.Close()
+    // The pragma is a no-op inside a transaction so it must be set first
+    if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+        return err
+    }
+    defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+    tx, err := conn.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    if _, err := tx.Exec(createRejectedRows); err != nil {
+        tx.Rollback()
+        return err
+    }
+    if _, err := tx.Exec(script); err != nil {
+        tx.Rollback()
+        return err
+    }
+    if err := logRejectedRows(tx); err != nil {
+        tx.Rollback()
+        return err
+    }
+    if err := record(tx); err != nil {
+        tx.Rollback()
+        return err
+    }
+    if err := foreignKeyCheck(tx); err != nil {
+        tx.Rollback()
+        return err
+    }
+    return tx.Commit()
+}
+
+// logRejectedRows reports the rows a migration set aside from each table.
+// They are no longer seen by the program, so the warning goes to stderr
+// rather than to the log, which the command line discards.
+func logRejectedRows(tx *sql.Tx) error {
+    row, err := tx.Query(selectRejectedRows)
+    if err != nil {
+        return err
+    }
+    for row.Next() {
+        var table string
+        var n int
+        if err := row.Scan(&table, &n); err != nil {
+            row.Close()
+            return err
+        }
+        rows := "rows"
+        if n == 1 {
+            rows = "row"
+        }
+        fmt.Fprintf(os.Stderr, "Warning: moved %d %s of %s with a repeated or missing key, or a missing parent row, to %s_rejected\n", n, rows, table, table)
+    }
+    row.Close()
+    if err := row.Err(); err != nil {
+        return err
+    }
+    _, err = tx.Exec(dropRejectedRows)
+    return err
+}
+
+// foreignKeyCheck reports every row that references a missing parent row
+func foreignKeyCheck(tx *sql.Tx) error {
+    row, err := tx.Query("PRAGMA foreign_key_check")
+    if err != nil {
+        return err
+    }
+    defer row.Close()
+    violations := []string{}
+    for row.Next() {
+        var table, parent string
+        var rowID, index sql.NullInt64
+        if err := row.Scan(&table, &rowID, &parent, &index); err != nil {
+            return err
+        }
+        violations = append(violations, fmt.Sprintf("%s row %d references missing %s", table, rowID.Int64, parent))
+    }
+    if err := row.Err(); err != nil {
+        return err
+    }
+    if len(violations) > 0 {
+        return fmt.Errorf("Foreign key violations: %s", strings.Join(violations, "; "))
+    }
+    return nil
+}
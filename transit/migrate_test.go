@@ -0,0 +1,156 @@
+package transit_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+// openVersion0 returns a database file migrated down to the original schema,
+// which has no keys, holding buses that share an ID and an offering of a
+// missing driver
+func openVersion0(t *testing.T) *transit.Database {
+	t.Helper()
+	db, err := transit.GetDatabase(transit.Options{Path: filepath.Join(t.TempDir(), "lab4.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.MigrateTo(0); err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO Bus VALUES (0, 'Grayhound', '2020'), (0, 'Greyhound', '2021'), (5, 'Greyhound', '2022'), (5, 'Gillig', '2015'), (6, 'Gillig', '2015')`,
+		`INSERT INTO Driver VALUES ('Ann', '555-0101')`,
+		`INSERT INTO Trip VALUES (1, 'Pomona', 'Ontario')`,
+		`INSERT INTO TripOffering VALUES (1, '2026-10-19', '08:00', '09:00', 'Ann', 0), (1, '2026-10-19', '10:00', '11:00', 'Nobody', 5)`,
+	} {
+		if _, err := db.DB.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// tableRows returns every row of table as text, in rowid order
+func tableRows(t *testing.T, db *transit.Database, table string) [][]string {
+	t.Helper()
+	row, err := db.DB.Query(`SELECT * FROM ` + table + ` ORDER BY rowid`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer row.Close()
+	columns, err := row.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := [][]string{}
+	for row.Next() {
+		values := make([]interface{}, len(columns))
+		texts := make([]string, len(columns))
+		for i := range values {
+			values[i] = &texts[i]
+		}
+		if err := row.Scan(values...); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, texts)
+	}
+	return result
+}
+
+func TestMigrationSetsAsideRejectedRows(t *testing.T) {
+	db := openVersion0(t)
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	err = db.Migrate()
+	os.Stderr = stderr
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"moved 2 rows of Bus", "to Bus_rejected", "moved 1 row of TripOffering"} {
+		if !strings.Contains(string(warnings), want) {
+			t.Errorf("Warnings %q, want them to say %q", warnings, want)
+		}
+	}
+	if strings.Contains(string(warnings), "Driver") {
+		t.Errorf("Warnings %q mention a table that lost nothing", warnings)
+	}
+	buses, err := db.GetBusTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buses) != 3 || buses[0].Model != "Grayhound" {
+		t.Errorf("Buses after the migration %v, want the first copy of each ID", buses)
+	}
+	want := [][]string{{"0", "Greyhound", "2021"}, {"5", "Gillig", "2015"}}
+	if got := tableRows(t, db, "Bus_rejected"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Rejected buses %v, want %v", got, want)
+	}
+	if got := tableRows(t, db, "TripOffering_rejected"); len(got) != 1 || got[0][4] != "Nobody" {
+		t.Errorf("Rejected offerings %v, want the one of the missing driver", got)
+	}
+}
+
+func TestMigrationUpThenDown(t *testing.T) {
+	db := openVersion0(t)
+	tables := []string{"Bus", "Driver", "Stop", "Trip", "TripOffering", "TripStopInfo", "ActualTripStopInfo"}
+	before := map[string][][]string{}
+	for _, table := range tables {
+		before[table] = tableRows(t, db, table)
+	}
+	// Leave the warnings about the rejected rows out of the test output
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	stderr := os.Stderr
+	os.Stderr = null
+	err = db.Migrate()
+	os.Stderr = stderr
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MigrateTo(0); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range tables {
+		// Rejected rows come back after the rows that were kept
+		got, want := tableRows(t, db, table), before[table]
+		if len(got) != len(want) {
+			t.Errorf("%s after migrating up and down: %v, want %v", table, got, want)
+			continue
+		}
+		for _, r := range want {
+			found := false
+			for _, g := range got {
+				found = found || reflect.DeepEqual(r, g)
+			}
+			if !found {
+				t.Errorf("%s lost row %v migrating up and down, got %v", table, r, got)
+			}
+		}
+	}
+	var rejected int
+	if err := db.DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name LIKE '%_rejected'`).Scan(&rejected); err != nil {
+		t.Fatal(err)
+	}
+	if rejected != 0 {
+		t.Errorf("Found %d rejected tables after migrating down, want none", rejected)
+	}
+}
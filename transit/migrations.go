@@ -0,0 +1,353 @@
+// Numbered schema migrations applied on top of the built-in schema
+package transit
+
+// migration is a single numbered step in the schema history. Up moves the
+// schema from Version-1 to Version and Down reverses it.
+type migration struct {
+    Version int
+    Name    string
+    Up      string
+    Down    string
+}
+
+// migrations lists every schema step in order. Version 0 is the schema
+// created by lab4_create-tables.sql.
+var migrations = []migration{
+    {
+        Version: 1,
+        Name:    "keys",
+        // Tables are rebuilt because SQLite cannot add constraints in place.
+        // Rows that repeat a key keep the first copy inserted. The other
+        // copies, rows with a missing key and rows whose parent row is
+        // missing are moved to a *_rejected table for each table, and the
+        // runner warns how many each one holds.
+        Up: `
+ALTER TABLE Bus RENAME TO Bus_v0;
+ALTER TABLE Driver RENAME TO Driver_v0;
+ALTER TABLE Stop RENAME TO Stop_v0;
+ALTER TABLE Trip RENAME TO Trip_v0;
+ALTER TABLE TripOffering RENAME TO TripOffering_v0;
+ALTER TABLE TripStopInfo RENAME TO TripStopInfo_v0;
+ALTER TABLE ActualTripStopInfo RENAME TO ActualTripStopInfo_v0;
+
+CREATE TABLE Bus (
+    BusID INT NOT NULL PRIMARY KEY,
+    Model VARCHAR(50),
+    Year VARCHAR(50)
+);
+
+CREATE TABLE Driver (
+    DriverName VARCHAR(50) NOT NULL PRIMARY KEY,
+    DriverTelephoneNumber VARCHAR(50)
+);
+
+CREATE TABLE Stop (
+    StopNumber INT NOT NULL PRIMARY KEY,
+    StopAddress VARCHAR(50)
+);
+
+CREATE TABLE Trip (
+    TripNumber INT NOT NULL PRIMARY KEY,
+    StartLocationName VARCHAR(50),
+    DestinationName VARCHAR(50)
+);
+
+CREATE TABLE TripOffering (
+    TripNumber INT NOT NULL,
+    Date DATE NOT NULL,
+    ScheduledStartTime VARCHAR(50) NOT NULL,
+    ScheduledArrivalTime VARCHAR(50),
+    DriverName VARCHAR(50),
+    BusID INT,
+    PRIMARY KEY (TripNumber, Date, ScheduledStartTime),
+    FOREIGN KEY (TripNumber) REFERENCES Trip (TripNumber) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (DriverName) REFERENCES Driver (DriverName) ON DELETE RESTRICT ON UPDATE CASCADE,
+    FOREIGN KEY (BusID) REFERENCES Bus (BusID) ON DELETE RESTRICT ON UPDATE CASCADE
+);
+
+CREATE TABLE TripStopInfo (
+    TripNumber INT NOT NULL,
+    StopNumber INT NOT NULL,
+    SequenceNumber INT NOT NULL,
+    DrivingTime DECIMAL(4,1),
+    PRIMARY KEY (TripNumber, StopNumber),
+    UNIQUE (TripNumber, SequenceNumber),
+    FOREIGN KEY (TripNumber) REFERENCES Trip (TripNumber) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (StopNumber) REFERENCES Stop (StopNumber) ON DELETE RESTRICT ON UPDATE CASCADE
+);
+
+CREATE TABLE ActualTripStopInfo (
+    TripNumber INT NOT NULL,
+    Date DATE NOT NULL,
+    ScheduledStartTime VARCHAR(50) NOT NULL,
+    StopNumber INT NOT NULL,
+    ScheduledArrivalTime VARCHAR(50),
+    ActualStartTime VARCHAR(50),
+    ActualArrivalTime VARCHAR(50),
+    NumberOfPassengersIn INT,
+    NumberOfPassengersOut INT,
+    PRIMARY KEY (TripNumber, Date, ScheduledStartTime, StopNumber),
+    FOREIGN KEY (TripNumber, Date, ScheduledStartTime) REFERENCES TripOffering (TripNumber, Date, ScheduledStartTime) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (StopNumber) REFERENCES Stop (StopNumber) ON DELETE RESTRICT ON UPDATE CASCADE
+);
+
+CREATE TABLE Bus_rejected AS SELECT * FROM Bus_v0 WHERE 0;
+CREATE TABLE Driver_rejected AS SELECT * FROM Driver_v0 WHERE 0;
+CREATE TABLE Stop_rejected AS SELECT * FROM Stop_v0 WHERE 0;
+CREATE TABLE Trip_rejected AS SELECT * FROM Trip_v0 WHERE 0;
+CREATE TABLE TripOffering_rejected AS SELECT * FROM TripOffering_v0 WHERE 0;
+CREATE TABLE TripStopInfo_rejected AS SELECT * FROM TripStopInfo_v0 WHERE 0;
+CREATE TABLE ActualTripStopInfo_rejected AS SELECT * FROM ActualTripStopInfo_v0 WHERE 0;
+
+INSERT OR IGNORE INTO Bus (rowid, BusID, Model, Year) SELECT rowid, BusID, Model, Year FROM Bus_v0 ORDER BY rowid;
+INSERT OR IGNORE INTO Driver (rowid, DriverName, DriverTelephoneNumber) SELECT rowid, DriverName, DriverTelephoneNumber FROM Driver_v0 ORDER BY rowid;
+INSERT OR IGNORE INTO Stop (rowid, StopNumber, StopAddress) SELECT rowid, StopNumber, StopAddress FROM Stop_v0 ORDER BY rowid;
+INSERT OR IGNORE INTO Trip (rowid, TripNumber, StartLocationName, DestinationName) SELECT rowid, TripNumber, StartLocationName, DestinationName FROM Trip_v0 ORDER BY rowid;
+INSERT OR IGNORE INTO TripOffering (rowid, TripNumber, Date, ScheduledStartTime, ScheduledArrivalTime, DriverName, BusID) SELECT rowid, TripNumber, Date, ScheduledStartTime, ScheduledArrivalTime, DriverName, BusID FROM TripOffering_v0 ORDER BY rowid;
+INSERT OR IGNORE INTO TripStopInfo (rowid, TripNumber, StopNumber, SequenceNumber, DrivingTime) SELECT rowid, TripNumber, StopNumber, SequenceNumber, DrivingTime FROM TripStopInfo_v0 ORDER BY rowid;
+INSERT OR IGNORE INTO ActualTripStopInfo (rowid, TripNumber, Date, ScheduledStartTime, StopNumber, ScheduledArrivalTime, ActualStartTime, ActualArrivalTime, NumberOfPassengersIn, NumberOfPassengersOut) SELECT rowid, TripNumber, Date, ScheduledStartTime, StopNumber, ScheduledArrivalTime, ActualStartTime, ActualArrivalTime, NumberOfPassengersIn, NumberOfPassengersOut FROM ActualTripStopInfo_v0 ORDER BY rowid;
+
+INSERT INTO Bus_rejected SELECT * FROM Bus_v0 WHERE rowid NOT IN (SELECT rowid FROM Bus) ORDER BY rowid;
+INSERT INTO Driver_rejected SELECT * FROM Driver_v0 WHERE rowid NOT IN (SELECT rowid FROM Driver) ORDER BY rowid;
+INSERT INTO Stop_rejected SELECT * FROM Stop_v0 WHERE rowid NOT IN (SELECT rowid FROM Stop) ORDER BY rowid;
+INSERT INTO Trip_rejected SELECT * FROM Trip_v0 WHERE rowid NOT IN (SELECT rowid FROM Trip) ORDER BY rowid;
+INSERT INTO TripOffering_rejected SELECT * FROM TripOffering_v0 WHERE rowid NOT IN (SELECT rowid FROM TripOffering) ORDER BY rowid;
+INSERT INTO TripStopInfo_rejected SELECT * FROM TripStopInfo_v0 WHERE rowid NOT IN (SELECT rowid FROM TripStopInfo) ORDER BY rowid;
+INSERT INTO ActualTripStopInfo_rejected SELECT * FROM ActualTripStopInfo_v0 WHERE rowid NOT IN (SELECT rowid FROM ActualTripStopInfo) ORDER BY rowid;
+
+INSERT INTO TripOffering_rejected SELECT * FROM TripOffering WHERE TripNumber NOT IN (SELECT TripNumber FROM Trip) OR DriverName NOT IN (SELECT DriverName FROM Driver) OR BusID NOT IN (SELECT BusID FROM Bus) ORDER BY rowid;
+DELETE FROM TripOffering WHERE TripNumber NOT IN (SELECT TripNumber FROM Trip) OR DriverName NOT IN (SELECT DriverName FROM Driver) OR BusID NOT IN (SELECT BusID FROM Bus);
+INSERT INTO TripStopInfo_rejected SELECT * FROM TripStopInfo WHERE TripNumber NOT IN (SELECT TripNumber FROM Trip) OR StopNumber NOT IN (SELECT StopNumber FROM Stop) ORDER BY rowid;
+DELETE FROM TripStopInfo WHERE TripNumber NOT IN (SELECT TripNumber FROM Trip) OR StopNumber NOT IN (SELECT StopNumber FROM Stop);
+INSERT INTO ActualTripStopInfo_rejected SELECT * FROM ActualTripStopInfo WHERE (TripNumber, Date, ScheduledStartTime) NOT IN (SELECT TripNumber, Date, ScheduledStartTime FROM TripOffering) OR StopNumber NOT IN (SELECT StopNumber FROM Stop) ORDER BY rowid;
+DELETE FROM ActualTripStopInfo WHERE (TripNumber, Date, ScheduledStartTime) NOT IN (SELECT TripNumber, Date, ScheduledStartTime FROM TripOffering) OR StopNumber NOT IN (SELECT StopNumber FROM Stop);
+
+INSERT INTO temp.RejectedRows SELECT 'Bus', COUNT(*) FROM Bus_rejected;
+INSERT INTO temp.RejectedRows SELECT 'Driver', COUNT(*) FROM Driver_rejected;
+INSERT INTO temp.RejectedRows SELECT 'Stop', COUNT(*) FROM Stop_rejected;
+INSERT INTO temp.RejectedRows SELECT 'Trip', COUNT(*) FROM Trip_rejected;
+INSERT INTO temp.RejectedRows SELECT 'TripOffering', COUNT(*) FROM TripOffering_rejected;
+INSERT INTO temp.RejectedRows SELECT 'TripStopInfo', COUNT(*) FROM TripStopInfo_rejected;
+INSERT INTO temp.RejectedRows SELECT 'ActualTripStopInfo', COUNT(*) FROM ActualTripStopInfo_rejected;
+
+DROP TABLE Bus_v0;
+DROP TABLE Driver_v0;
+DROP TABLE Stop_v0;
+DROP TABLE Trip_v0;
+DROP TABLE TripOffering_v0;
+DROP TABLE TripStopInfo_v0;
+DROP TABLE ActualTripStopInfo_v0;
+`,
+        Down: `
+ALTER TABLE Bus RENAME TO Bus_v1;
+ALTER TABLE Driver RENAME TO Driver_v1;
+ALTER TABLE Stop RENAME TO Stop_v1;
+ALTER TABLE Trip RENAME TO Trip_v1;
+ALTER TABLE TripOffering RENAME TO TripOffering_v1;
+ALTER TABLE TripStopInfo RENAME TO TripStopInfo_v1;
+ALTER TABLE ActualTripStopInfo RENAME TO ActualTripStopInfo_v1;
+
+CREATE TABLE Bus (
+    BusID INT,
+    Model VARCHAR(50),
+    Year VARCHAR(50)
+);
+
+CREATE TABLE Driver (
+    DriverName VARCHAR(50),
+    DriverTelephoneNumber VARCHAR(50)
+);
+
+CREATE TABLE Stop (
+    StopNumber INT,
+    StopAddress VARCHAR(50)
+);
+
+CREATE TABLE Trip (
+    TripNumber INT,
+    StartLocationName VARCHAR(50),
+    DestinationName VARCHAR(50)
+);
+
+CREATE TABLE TripOffering (
+    TripNumber INT,
+    Date DATE,
+    ScheduledStartTime VARCHAR(50),
+    ScheduledArrivalTime VARCHAR(50),
+    DriverName VARCHAR(50),
+    BusID INT
+);
+
+CREATE TABLE TripStopInfo (
+    TripNumber INT,
+    StopNumber INT,
+    SequenceNumber INT,
+    DrivingTime DECIMAL(4,1)
+);
+
+CREATE TABLE ActualTripStopInfo (
+    TripNumber INT,
+    Date DATE,
+    ScheduledStartTime VARCHAR(50),
+    StopNumber INT,
+    ScheduledArrivalTime VARCHAR(50),
+    ActualStartTime VARCHAR(50),
+    ActualArrivalTime VARCHAR(50),
+    NumberOfPassengersIn INT,
+    NumberOfPassengersOut INT
+);
+
+INSERT INTO Bus SELECT * FROM Bus_v1;
+INSERT INTO Driver SELECT * FROM Driver_v1;
+INSERT INTO Stop SELECT * FROM Stop_v1;
+INSERT INTO Trip SELECT * FROM Trip_v1;
+INSERT INTO TripOffering SELECT * FROM TripOffering_v1;
+INSERT INTO TripStopInfo SELECT * FROM TripStopInfo_v1;
+INSERT INTO ActualTripStopInfo SELECT * FROM ActualTripStopInfo_v1;
+
+INSERT INTO Bus SELECT * FROM Bus_rejected;
+INSERT INTO Driver SELECT * FROM Driver_rejected;
+INSERT INTO Stop SELECT * FROM Stop_rejected;
+INSERT INTO Trip SELECT * FROM Trip_rejected;
+INSERT INTO TripOffering SELECT * FROM TripOffering_rejected;
+INSERT INTO TripStopInfo SELECT * FROM TripStopInfo_rejected;
+INSERT INTO ActualTripStopInfo SELECT * FROM ActualTripStopInfo_rejected;
+
+DROP TABLE ActualTripStopInfo_rejected;
+DROP TABLE TripStopInfo_rejected;
+DROP TABLE TripOffering_rejected;
+DROP TABLE Trip_rejected;
+DROP TABLE Stop_rejected;
+DROP TABLE Driver_rejected;
+DROP TABLE Bus_rejected;
+
+DROP TABLE ActualTripStopInfo_v1;
+DROP TABLE TripStopInfo_v1;
+DROP TABLE TripOffering_v1;
+DROP TABLE Trip_v1;
+DROP TABLE Stop_v1;
+DROP TABLE Driver_v1;
+DROP TABLE Bus_v1;
+`,
+    },
+    {
+        Version: 2,
+        Name:    "service patterns",
+        Up: `
+CREATE TABLE ServicePattern (
+    PatternName VARCHAR(50) NOT NULL PRIMARY KEY,
+    TripNumber INT NOT NULL,
+    DaysOfWeek VARCHAR(7) NOT NULL,
+    ScheduledStartTime VARCHAR(50) NOT NULL,
+    ScheduledArrivalTime VARCHAR(50) NOT NULL,
+    EffectiveFrom DATE NOT NULL,
+    EffectiveTo DATE NOT NULL,
+    DriverName VARCHAR(50),
+    BusID INT,
+    FOREIGN KEY (TripNumber) REFERENCES Trip (TripNumber) ON DELETE CASCADE ON UPDATE CASCADE,
+    FOREIGN KEY (DriverName) REFERENCES Driver (DriverName) ON DELETE RESTRICT ON UPDATE CASCADE,
+    FOREIGN KEY (BusID) REFERENCES Bus (BusID) ON DELETE RESTRICT ON UPDATE CASCADE
+);
+`,
+        Down: `
+DROP TABLE ServicePattern;
+`,
+    },
+    {
+        Version: 3,
+        Name:    "service calendar",
+        // A NULL TripNumber makes an exception apply to every trip
+        Up: `
+CREATE TABLE Holiday (
+    Date DATE NOT NULL PRIMARY KEY,
+    HolidayName VARCHAR(50) NOT NULL,
+    ServiceAs VARCHAR(10)
+);
+
+CREATE TABLE ServiceException (
+    TripNumber INT,
+    Date DATE NOT NULL,
+    ExceptionType VARCHAR(10) NOT NULL CHECK (ExceptionType IN ('added', 'removed')),
+    Reason VARCHAR(100),
+    FOREIGN KEY (TripNumber) REFERENCES Trip (TripNumber) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX ServiceExceptionKey ON ServiceException (IFNULL(TripNumber, 0), Date);
+`,
+        Down: `
+DROP INDEX ServiceExceptionKey;
+DROP TABLE ServiceException;
+DROP TABLE Holiday;
+`,
+    },
+    {
+        Version: 4,
+        Name:    "audit log",
+        // Triggers keep the log append-only
+        Up: `
+CREATE TABLE AuditLog (
+    AuditID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Entity VARCHAR(50) NOT NULL,
+    EntityKey VARCHAR(100) NOT NULL,
+    Action VARCHAR(10) NOT NULL CHECK (Action IN ('insert', 'update', 'delete')),
+    Before TEXT,
+    After TEXT,
+    ChangedAt VARCHAR(50) NOT NULL,
+    Operator VARCHAR(50) NOT NULL
+);
+
+CREATE INDEX AuditLogEntity ON AuditLog (Entity, EntityKey);
+
+CREATE TRIGGER AuditLogNoUpdate BEFORE UPDATE ON AuditLog
+BEGIN
+    SELECT RAISE(ABORT, 'AuditLog is append-only');
+END;
+
+CREATE TRIGGER AuditLogNoDelete BEFORE DELETE ON AuditLog
+BEGIN
+    SELECT RAISE(ABORT, 'AuditLog is append-only');
+END;
+`,
+        Down: `
+DROP TRIGGER AuditLogNoDelete;
+DROP TRIGGER AuditLogNoUpdate;
+DROP INDEX AuditLogEntity;
+DROP TABLE AuditLog;
+`,
+    },
+    {
+        Version: 5,
+        Name:    "edit log",
+        // Each edit spans a run of audit records, which undo reverts
+        Up: `
+CREATE TABLE EditLog (
+    EditID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Session VARCHAR(50) NOT NULL,
+    Command VARCHAR(200) NOT NULL,
+    FirstAuditID INTEGER NOT NULL REFERENCES AuditLog (AuditID),
+    LastAuditID INTEGER NOT NULL REFERENCES AuditLog (AuditID),
+    Undone BOOLEAN NOT NULL DEFAULT 0,
+    MadeAt VARCHAR(50) NOT NULL
+);
+
+CREATE INDEX EditLogSession ON EditLog (Session, Undone);
+`,
+        Down: `
+DROP INDEX EditLogSession;
+DROP TABLE EditLog;
+`,
+    },
+    {
+        Version: 6,
+        Name:    "retirement",
+        // A NULL RetiredOn means the bus or driver is in service
+        Up: `
+ALTER TABLE Bus ADD COLUMN RetiredOn DATE;
+ALTER TABLE Driver ADD COLUMN RetiredOn DATE;
+`,
+        Down: `
+ALTER TABLE Driver DROP COLUMN RetiredOn;
+ALTER TABLE Bus DROP COLUMN RetiredOn;
+`,
+    },
+}
@@ -0,0 +1,208 @@
+// On-time performance reporting from ActualTripStopInfo
+package transit
+
+import (
+    "fmt"
+    "math"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+const selectObservationsByDates = `SELECT A.TripNumber, A.Date, A.ScheduledStartTime, A.StopNumber, A.ScheduledArrivalTime, A.ActualStartTime, A.ActualArrivalTime, IFNULL(O.DriverName, '') FROM ActualTripStopInfo A LEFT JOIN TripOffering O ON O.TripNumber = A.TripNumber AND O.Date = A.Date AND O.ScheduledStartTime = A.ScheduledStartTime WHERE A.Date BETWEEN ? AND ? ORDER BY A.Date, A.TripNumber, A.ScheduledStartTime, A.StopNumber`
+
+// The thresholds the report command uses unless given others
+const (
+    DefaultLateThreshold  = 5
+    DefaultEarlyThreshold = 1
+)
+
+// OnTimeOptions configures OnTimeReport. An arrival counts as on time when
+// it is at most EarlyThreshold minutes early and LateThreshold minutes late,
+// so zero thresholds count only arrivals on the minute.
+type OnTimeOptions struct {
+    From           ServiceDate // first date, inclusive
+    To             ServiceDate // last date, inclusive
+    LateThreshold  int
+    EarlyThreshold int
+}
+
+// OnTimeStats summarises punctuality for one group of stop observations.
+// Lateness is actual minus scheduled arrival in minutes, negative when early.
+type OnTimeStats struct {
+    Key             string
+    Observations    int
+    OnTime          int
+    Late            int
+    Early           int
+    EarlyDepartures int
+    AverageLateness float64
+    P95Lateness     float64
+    lateness        []float64
+}
+
+// OnTimePercent returns the share of observations that were on time
+func (s OnTimeStats) OnTimePercent() float64 {
+    if s.Observations == 0 {
+        return 0
+    }
+    return 100 * float64(s.OnTime) / float64(s.Observations)
+}
+
+// OnTimeReport groups on-time statistics by trip, stop, driver and day
+type OnTimeReport struct {
+    Options  OnTimeOptions
+    Overall  OnTimeStats
+    ByTrip   []OnTimeStats
+    ByStop   []OnTimeStats
+    ByDriver []OnTimeStats
+    ByDay    []OnTimeStats
+    Skipped  int // observations whose times could not be parsed
+}
+
+func (r OnTimeReport) String() string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "On-time performance %s to %s (on time = %d min early to %d min late)\n", r.Options.From, r.Options.To, r.Options.EarlyThreshold, r.Options.LateThreshold)
+    sections := []struct {
+        title string
+        stats []OnTimeStats
+    }{
+        {"Overall", []OnTimeStats{r.Overall}},
+        {"Trip", r.ByTrip},
+        {"Stop", r.ByStop},
+        {"Driver", r.ByDriver},
+        {"Date", r.ByDay},
+    }
+    for _, section := range sections {
+        fmt.Fprintf(&b, "\n%-12s %6s %8s %6s %6s %9s %8s %8s\n", section.title, "Obs", "OnTime%", "Late", "Early", "EarlyDep", "AvgLate", "P95Late")
+        for _, s := range section.stats {
+            fmt.Fprintf(&b, "%-12s %6d %8.1f %6d %6d %9d %8.1f %8.1f\n", s.Key, s.Observations, s.OnTimePercent(), s.Late, s.Early, s.EarlyDepartures, s.AverageLateness, s.P95Lateness)
+        }
+    }
+    if r.Skipped > 0 {
+        fmt.Fprintf(&b, "\n%d observations skipped because their times could not be parsed\n", r.Skipped)
+    }
+    return b.String()
+}
+
+// OnTimeReport computes on-time statistics for the observations between
+// opts.From and opts.To
+func (db *Database) OnTimeReport(opts OnTimeOptions) (OnTimeReport, error) {
+    if opts.LateThreshold < 0 || opts.EarlyThreshold < 0 {
+        return OnTimeReport{Options: opts}, invalidf("Thresholds cannot be negative, got %d min early and %d min late", opts.EarlyThreshold, opts.LateThreshold)
+    }
+    report := OnTimeReport{Options: opts, Overall: OnTimeStats{Key: "All"}}
+    row, err := db.query(selectObservationsByDates, opts.From, opts.To)
+    if err != nil {
+        return report, err
+    }
+    defer row.Close()
+    byTrip := make(map[string]*OnTimeStats)
+    byStop := make(map[string]*OnTimeStats)
+    byDriver := make(map[string]*OnTimeStats)
+    byDay := make(map[string]*OnTimeStats)
+    for row.Next() {
+        var tripNumber, stopNumber int
+        var date ServiceDate
+        var scheduledStart, scheduledArrival, actualStart, actualArrival TimeOfDay
+        var driverName string
+        row.Scan(&tripNumber, &date, &scheduledStart, &stopNumber, &scheduledArrival, &actualStart, &actualArrival, &driverName)
+        lateness, err := minutesBetween(scheduledArrival, actualArrival)
+        if err != nil {
+            report.Skipped++
+            continue
+        }
+        earlyDeparture := false
+        if startDelay, err := minutesBetween(scheduledStart, actualStart); err == nil {
+            earlyDeparture = startDelay < -float64(opts.EarlyThreshold)
+        }
+        for _, group := range []struct {
+            stats map[string]*OnTimeStats
+            key   string
+        }{
+            {byTrip, strconv.Itoa(tripNumber)},
+            {byStop, strconv.Itoa(stopNumber)},
+            {byDriver, driverName},
+            {byDay, date.String()},
+        } {
+            s, ok := group.stats[group.key]
+            if !ok {
+                s = &OnTimeStats{Key: group.key}
+                group.stats[group.key] = s
+            }
+            s.add(lateness, earlyDeparture, opts)
+        }
+        report.Overall.add(lateness, earlyDeparture, opts)
+    }
+    report.Overall.finish()
+    report.ByTrip = finishStats(byTrip)
+    report.ByStop = finishStats(byStop)
+    report.ByDriver = finishStats(byDriver)
+    report.ByDay = finishStats(byDay)
+    return report, nil
+}
+
+func (s *OnTimeStats) add(lateness float64, earlyDeparture bool, opts OnTimeOptions) {
+    s.Observations++
+    s.lateness = append(s.lateness, lateness)
+    switch {
+    case lateness > float64(opts.LateThreshold):
+        s.Late++
+    case lateness < -float64(opts.EarlyThreshold):
+        s.Early++
+    default:
+        s.OnTime++
+    }
+    if earlyDeparture {
+        s.EarlyDepartures++
+    }
+}
+
+// finish computes the average and 95th percentile (nearest rank) lateness
+func (s *OnTimeStats) finish() {
+    if len(s.lateness) == 0 {
+        return
+    }
+    sort.Float64s(s.lateness)
+    total := 0.0
+    for _, l := range s.lateness {
+        total += l
+    }
+    s.AverageLateness = total / float64(len(s.lateness))
+    rank := int(math.Ceil(0.95*float64(len(s.lateness)))) - 1
+    s.P95Lateness = s.lateness[rank]
+    s.lateness = nil
+}
+
+// finishStats finishes every group and returns them ordered by key
+func finishStats(groups map[string]*OnTimeStats) []OnTimeStats {
+    result := []OnTimeStats{}
+    for _, s := range groups {
+        s.finish()
+        result = append(result, *s)
+    }
+    sort.Slice(result, func(i, j int) bool {
+        a, errA := strconv.Atoi(result[i].Key)
+        b, errB := strconv.Atoi(result[j].Key)
+        if errA == nil && errB == nil {
+            return a < b
+        }
+        return result[i].Key < result[j].Key
+    })
+    return result
+}
+
+// minutesBetween returns actual minus scheduled in minutes. Differences of
+// more than twelve hours are taken to cross midnight.
+func minutesBetween(scheduled, actual TimeOfDay) (float64, error) {
+    if scheduled.IsZero() || actual.IsZero() {
+        return 0, invalidf("Missing time")
+    }
+    diff := actual.Minutes() - scheduled.Minutes()
+    if diff > 12*60 {
+        diff -= 24 * 60
+    } else if diff < -12*60 {
+        diff += 24 * 60
+    }
+    return float64(diff), nil
+}
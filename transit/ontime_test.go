@@ -0,0 +1,50 @@
+package transit_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+func TestOnTimeThresholds(t *testing.T) {
+	db := openMemory(t)
+	date, start := mustParseDate(t, "2026-10-19"), mustParseTime(t, "10:00")
+	for _, err := range []error{
+		db.AddTrip(1, "A", "B"),
+		db.AddStop(1, "1 Main St"),
+		db.AddStop(2, "2 Main St"),
+		db.AddStop(3, "3 Main St"),
+		db.AddBus(1, "Gillig", 2015),
+		db.AddDriver("Ann", "555-0100"),
+		db.AddOffering(1, date, start, mustParseTime(t, "11:00"), "Ann", 1),
+		db.AddActualTripStopInfo(1, date, start, 1, mustParseTime(t, "10:10"), start, mustParseTime(t, "10:10"), 1, 0),
+		db.AddActualTripStopInfo(1, date, start, 2, mustParseTime(t, "10:20"), start, mustParseTime(t, "10:22"), 1, 0),
+		db.AddActualTripStopInfo(1, date, start, 3, mustParseTime(t, "10:30"), start, mustParseTime(t, "10:29"), 0, 2),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		late, early                     int
+		wantOnTime, wantLate, wantEarly int
+	}{
+		{0, 0, 1, 1, 1},
+		{2, 0, 2, 0, 1},
+		{0, 1, 2, 1, 0},
+		{transit.DefaultLateThreshold, transit.DefaultEarlyThreshold, 3, 0, 0},
+	}
+	for _, tt := range tests {
+		report, err := db.OnTimeReport(transit.OnTimeOptions{From: date, To: date, LateThreshold: tt.late, EarlyThreshold: tt.early})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := report.Overall; s.OnTime != tt.wantOnTime || s.Late != tt.wantLate || s.Early != tt.wantEarly {
+			t.Errorf("%d min late, %d early: got %d on time, %d late, %d early, want %d, %d, %d", tt.late, tt.early, s.OnTime, s.Late, s.Early, tt.wantOnTime, tt.wantLate, tt.wantEarly)
+		}
+	}
+	if _, err := db.OnTimeReport(transit.OnTimeOptions{From: date, To: date, LateThreshold: -1}); !errors.Is(err, transit.ErrInvalid) {
+		t.Errorf("Negative threshold: got %v, want an invalid input error", err)
+	}
+}
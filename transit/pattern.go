@@ -0,0 +1,196 @@
+// Recurring service patterns that expand into trip offerings
+package transit
+
+import (
+    "database/sql"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+)
+
+const (
+    // weekdayLetters gives the letter used for each day in DaysOfWeek, Monday first
+    weekdayLetters = "MTWTFSS"
+
+    selectServicePatterns      = `SELECT PatternName, TripNumber, DaysOfWeek, ScheduledStartTime, ScheduledArrivalTime, EffectiveFrom, EffectiveTo, DriverName, BusID FROM ServicePattern`
+    selectServicePatternByName = selectServicePatterns + ` WHERE PatternName = ?`
+    insertServicePattern       = `INSERT INTO ServicePattern (PatternName, TripNumber, DaysOfWeek, ScheduledStartTime, ScheduledArrivalTime, EffectiveFrom, EffectiveTo, DriverName, BusID) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+    deleteServicePattern       = `DELETE FROM ServicePattern WHERE PatternName = ?`
+)
+
+// ServicePattern describes a trip that runs at the same time on the same days
+// of every week between EffectiveFrom and EffectiveTo
+type ServicePattern struct {
+    PatternName          string
+    TripNumber           int
+    DaysOfWeek           string // seven characters Monday to Sunday, '-' where there is no service, e.g. "MTWTF--"
+    ScheduledStartTime   TimeOfDay
+    ScheduledArrivalTime TimeOfDay
+    EffectiveFrom        ServiceDate
+    EffectiveTo          ServiceDate
+    DriverName           string
+    BusID                int
+}
+
+func (p ServicePattern) String() string {
+    return fmt.Sprintf("PatternName: %s\nTripNumber: %d\nDaysOfWeek: %s\nScheduledStartTime: %s\nScheduledArrivalTime: %s\nEffectiveFrom: %s\nEffectiveTo: %s\nDriverName: %s\nBusID: %d", p.PatternName, p.TripNumber, p.DaysOfWeek, p.ScheduledStartTime, p.ScheduledArrivalTime, p.EffectiveFrom, p.EffectiveTo, p.DriverName, p.BusID)
+}
+
+// Validate checks that the days, times and effective dates are well formed
+func (p ServicePattern) Validate() error {
+    if p.PatternName == "" {
+        return invalidf("Pattern name is required")
+    }
+    if len(p.DaysOfWeek) != 7 {
+        return invalidf("Invalid days of week %q, expected seven characters such as MTWTF--", p.DaysOfWeek)
+    }
+    for i := 0; i < 7; i++ {
+        if p.DaysOfWeek[i] != '-' && p.DaysOfWeek[i] != weekdayLetters[i] {
+            return invalidf("Invalid days of week %q, position %d must be %c or -", p.DaysOfWeek, i+1, weekdayLetters[i])
+        }
+    }
+    if _, _, err := offeringWindow(TripOffering{ScheduledStartTime: p.ScheduledStartTime, ScheduledArrivalTime: p.ScheduledArrivalTime}); err != nil {
+        return err
+    }
+    if p.EffectiveFrom.IsZero() || p.EffectiveTo.IsZero() {
+        return invalidf("Pattern %s needs effective from and to dates", p.PatternName)
+    }
+    if p.EffectiveTo.Before(p.EffectiveFrom) {
+        return invalidf("Pattern %s ends on %s before it starts on %s", p.PatternName, p.EffectiveTo, p.EffectiveFrom)
+    }
+    return nil
+}
+
+// RunsOn reports whether the pattern has service on the given weekday
+func (p ServicePattern) RunsOn(day time.Weekday) bool {
+    // time.Weekday counts from Sunday, DaysOfWeek from Monday
+    i := (int(day) + 6) % 7
+    return len(p.DaysOfWeek) == 7 && p.DaysOfWeek[i] != '-'
+}
+
+// Expand returns one offering for every date between from and to (inclusive)
+// that falls inside the effective range and on one of the pattern's days
+func (p ServicePattern) Expand(from, to ServiceDate) ([]TripOffering, error) {
+    result := []TripOffering{}
+    if err := p.Validate(); err != nil {
+        return result, err
+    }
+    if from.IsZero() || to.IsZero() {
+        return result, invalidf("A date range is required")
+    }
+    if from.Before(p.EffectiveFrom) {
+        from = p.EffectiveFrom
+    }
+    if to.After(p.EffectiveTo) {
+        to = p.EffectiveTo
+    }
+    for d := from; !d.After(to); d = d.AddDays(1) {
+        if !p.RunsOn(d.Weekday()) {
+            continue
+        }
+        result = append(result, TripOffering{
+            TripNumber:           p.TripNumber,
+            Date:                 d,
+            ScheduledStartTime:   p.ScheduledStartTime,
+            ScheduledArrivalTime: p.ScheduledArrivalTime,
+            DriverName:           p.DriverName,
+            BusID:                BusRef(p.BusID),
+        })
+    }
+    return result, nil
+}
+
+// AddServicePattern adds a service pattern to the database
+func (db *Database) AddServicePattern(p ServicePattern) error {
+    p.DaysOfWeek = strings.ToUpper(p.DaysOfWeek)
+    if err := p.Validate(); err != nil {
+        return err
+    }
+    return db.insert(p)
+}
+
+// DeleteServicePattern deletes the service pattern with the given name
+func (db *Database) DeleteServicePattern(patternName string) error {
+    return db.WithTx(func(tx *Database) error {
+        p, err := tx.GetServicePattern(patternName)
+        if err != nil {
+            return err
+        }
+        if _, err := tx.exec(deleteServicePattern, patternName); err != nil {
+            return err
+        }
+        return tx.record(p, nil)
+    })
+}
+
+// GetServicePatternTable returns all the service patterns in the database
+func (db *Database) GetServicePatternTable() ([]ServicePattern, error) {
+    result := []ServicePattern{}
+    row, err := db.query(selectServicePatterns)
+    if err != nil {
+        return result, err
+    }
+    defer row.Close()
+    result = RowToServicePatterns(row)
+    return result, nil
+}
+
+// GetServicePattern returns the service pattern with the given name
+func (db *Database) GetServicePattern(patternName string) (ServicePattern, error) {
+    row, err := db.query(selectServicePatternByName, patternName)
+    if err != nil {
+        return ServicePattern{}, err
+    }
+    defer row.Close()
+    patterns := RowToServicePatterns(row)
+    if len(patterns) == 0 {
+        return ServicePattern{}, fmt.Errorf("No service pattern %q: %w", patternName, ErrNotFound)
+    }
+    return patterns[0], nil
+}
+
+// RowToServicePatterns converts a sql row to a slice of service patterns
+func RowToServicePatterns(row *sql.Rows) []ServicePattern {
+    result := []ServicePattern{}
+    for row.Next() {
+        var p ServicePattern
+        row.Scan(&p.PatternName, &p.TripNumber, &p.DaysOfWeek, &p.ScheduledStartTime, &p.ScheduledArrivalTime, &p.EffectiveFrom, &p.EffectiveTo, &p.DriverName, &p.BusID)
+        result = append(result, p)
+    }
+    return result
+}
+
+// GenerateOfferings expands the named pattern over the dates from..to and adds
+// the resulting offerings, skipping any that already exist and any dates the
+// holiday and exception calendar rules out. With dryRun set
+// nothing is written. The offerings that were (or would be) added are returned.
+func (db *Database) GenerateOfferings(patternName string, from, to ServiceDate, dryRun bool) ([]TripOffering, error) {
+    pending := []TripOffering{}
+    p, err := db.GetServicePattern(patternName)
+    if err != nil {
+        return pending, err
+    }
+    cal, err := db.GetCalendar()
+    if err != nil {
+        return pending, err
+    }
+    offerings, err := cal.Expand(p, from, to)
+    if err != nil {
+        return pending, err
+    }
+    for _, o := range offerings {
+        _, err := db.GetOffering(o.TripNumber, o.Date, o.ScheduledStartTime)
+        if err == nil {
+            continue
+        }
+        if !errors.Is(err, ErrNotFound) {
+            return pending, err
+        }
+        pending = append(pending, o)
+    }
+    if dryRun {
+        return pending, nil
+    }
+    return pending, db.AddOfferings(pending)
+}
@@ -0,0 +1,154 @@
+package transit_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+// weekdayPattern returns a pattern running trip 1 at 08:00 on weekdays in
+// the two weeks from Monday 2026-10-19
+func weekdayPattern(t *testing.T) transit.ServicePattern {
+	t.Helper()
+	return transit.ServicePattern{
+		PatternName:          "weekday",
+		TripNumber:           1,
+		DaysOfWeek:           "MTWTF--",
+		ScheduledStartTime:   mustParseTime(t, "08:00"),
+		ScheduledArrivalTime: mustParseTime(t, "09:00"),
+		EffectiveFrom:        mustParseDate(t, "2026-10-19"),
+		EffectiveTo:          mustParseDate(t, "2026-11-01"),
+		DriverName:           "Ann",
+		BusID:                0,
+	}
+}
+
+// offeringDates lists the dates of offerings, separated by spaces
+func offeringDates(offerings []transit.TripOffering) string {
+	result := []string{}
+	for _, o := range offerings {
+		result = append(result, o.Date.String())
+	}
+	return strings.Join(result, " ")
+}
+
+func TestPatternExpand(t *testing.T) {
+	tests := []struct {
+		name, days, from, to, want string
+	}{
+		{"weekdays", "MTWTF--", "2026-10-19", "2026-10-25", "2026-10-19 2026-10-20 2026-10-21 2026-10-22 2026-10-23"},
+		{"weekend", "-----SS", "2026-10-19", "2026-10-25", "2026-10-24 2026-10-25"},
+		{"clipped to the effective range", "M------", "2026-10-01", "2026-12-31", "2026-10-19 2026-10-26"},
+		{"range before the pattern", "MTWTFSS", "2026-10-01", "2026-10-18", ""},
+		{"single day", "--W----", "2026-10-28", "2026-10-28", "2026-10-28"},
+	}
+	for _, tt := range tests {
+		p := weekdayPattern(t)
+		p.DaysOfWeek = tt.days
+		offerings, err := p.Expand(mustParseDate(t, tt.from), mustParseDate(t, tt.to))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := offeringDates(offerings); got != tt.want {
+			t.Errorf("%s: offerings on %q, want %q", tt.name, got, tt.want)
+		}
+		for _, o := range offerings {
+			if o.TripNumber != 1 || o.DriverName != "Ann" || !o.HasBus(0) || o.ScheduledStartTime.String() != "08:00" {
+				t.Errorf("%s: offering %v does not match the pattern", tt.name, o)
+			}
+		}
+	}
+}
+
+func TestPatternValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(p *transit.ServicePattern)
+	}{
+		{"no name", func(p *transit.ServicePattern) { p.PatternName = "" }},
+		{"six days", func(p *transit.ServicePattern) { p.DaysOfWeek = "MTWTF-" }},
+		{"day out of place", func(p *transit.ServicePattern) { p.DaysOfWeek = "TMWTF--" }},
+		{"no arrival time", func(p *transit.ServicePattern) { p.ScheduledArrivalTime = transit.TimeOfDay{} }},
+		{"no end date", func(p *transit.ServicePattern) { p.EffectiveTo = transit.ServiceDate{} }},
+		{"ends before it starts", func(p *transit.ServicePattern) { p.EffectiveTo = mustParseDate(t, "2026-10-01") }},
+	}
+	for _, tt := range tests {
+		p := weekdayPattern(t)
+		tt.change(&p)
+		if err := p.Validate(); !errors.Is(err, transit.ErrInvalid) {
+			t.Errorf("%s: Validate returned %v, want an invalid input error", tt.name, err)
+		}
+		if _, err := p.Expand(p.EffectiveFrom, p.EffectiveTo); err == nil {
+			t.Errorf("%s: expanded an invalid pattern", tt.name)
+		}
+	}
+	if err := weekdayPattern(t).Validate(); err != nil {
+		t.Errorf("Valid pattern: %v", err)
+	}
+}
+
+func TestGenerateOfferingsSkipsExisting(t *testing.T) {
+	db := openMemory(t)
+	for _, err := range []error{
+		db.AddTrip(1, "A", "B"),
+		db.AddBus(0, "Gillig", 2015),
+		db.AddDriver("Ann", "555-0100"),
+		db.AddServicePattern(weekdayPattern(t)),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	from, to := mustParseDate(t, "2026-10-19"), mustParseDate(t, "2026-10-25")
+	if err := db.AddOffering(1, mustParseDate(t, "2026-10-21"), mustParseTime(t, "08:00"), mustParseTime(t, "09:00"), "Ann", 0); err != nil {
+		t.Fatal(err)
+	}
+	preview, err := db.GenerateOfferings("weekday", from, to, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "2026-10-19 2026-10-20 2026-10-22 2026-10-23"
+	if got := offeringDates(preview); got != want {
+		t.Errorf("Dry run would add offerings on %q, want %q", got, want)
+	}
+	if offerings, err := db.GetTripOfferingTable(); err != nil || len(offerings) != 1 {
+		t.Errorf("Offerings after the dry run %v, %v, want only the one added by hand", offerings, err)
+	}
+	added, err := db.GenerateOfferings("weekday", from, to, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := offeringDates(added); got != want {
+		t.Errorf("Added offerings on %q, want %q", got, want)
+	}
+	again, err := db.GenerateOfferings("weekday", from, to, false)
+	if err != nil || len(again) != 0 {
+		t.Errorf("Generating again added %v, %v, want nothing", again, err)
+	}
+	if _, err := db.GenerateOfferings("nightly", from, to, true); !errors.Is(err, transit.ErrNotFound) {
+		t.Errorf("Generating from a missing pattern returned %v, want a not found error", err)
+	}
+}
+
+func TestDeleteServicePattern(t *testing.T) {
+	db := openMemory(t)
+	for _, err := range []error{
+		db.AddTrip(1, "A", "B"),
+		db.AddBus(0, "Gillig", 2015),
+		db.AddDriver("Ann", "555-0100"),
+		db.AddServicePattern(weekdayPattern(t)),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.DeleteServicePattern("weekday"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteServicePattern("weekday"); !errors.Is(err, transit.ErrNotFound) {
+		t.Errorf("Deleting a missing pattern returned %v, want a not found error", err)
+	}
+}
@@ -0,0 +1,320 @@
+// Retiring buses and drivers, and what deleting a bus or offering affects
+package transit
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+const (
+    selectOfferingsByBus     = selectTripOfferings + ` WHERE BusID = ? ORDER BY Date, ScheduledStartTime`
+    selectBusOfferingsFrom   = selectTripOfferings + ` WHERE BusID = ? AND Date >= ? ORDER BY Date, ScheduledStartTime`
+    selectDriverOfferingFrom = selectTripOfferings + ` WHERE DriverName = ? AND Date >= ? ORDER BY Date, ScheduledStartTime`
+    updateBusRetiredOn       = `UPDATE Bus SET RetiredOn = ? WHERE BusID = ?`
+)
+
+// DeletePolicy says what DeleteBus and DeleteDriver do with a bus or driver
+// that offerings are assigned to
+type DeletePolicy string
+
+const (
+    // DeleteRestrict refuses to delete the bus or driver
+    DeleteRestrict DeletePolicy = "restrict"
+    // DeleteCascade deletes its offerings, and their observations, with it
+    DeleteCascade DeletePolicy = "cascade"
+    // DeleteRetire retires the bus or driver from today instead of deleting
+    // it, which keeps the offerings it has run but refuses while later ones
+    // use it
+    DeleteRetire DeletePolicy = "retire"
+)
+
+// deletePolicies are the policies ParseDeletePolicy accepts
+var deletePolicies = []DeletePolicy{DeleteRestrict, DeleteCascade, DeleteRetire}
+
+// ParseDeletePolicy parses the name of a delete policy. The empty name is
+// DeleteRestrict.
+func ParseDeletePolicy(s string) (DeletePolicy, error) {
+    if s == "" {
+        return DeleteRestrict, nil
+    }
+    names := []string{}
+    for _, p := range deletePolicies {
+        if strings.EqualFold(s, string(p)) {
+            return p, nil
+        }
+        names = append(names, string(p))
+    }
+    return "", invalidf("Unknown delete policy %q, expected one of %s", s, strings.Join(names, ", "))
+}
+
+// WithDeletePolicy returns a handle on the same database whose DeleteBus and
+// DeleteDriver follow policy
+func (db *Database) WithDeletePolicy(policy DeletePolicy) *Database {
+    d := *db
+    d.onDelete = policy
+    return &d
+}
+
+// DeletePolicy returns what the handle's DeleteBus and DeleteDriver do with a
+// bus or driver that offerings are assigned to
+func (db *Database) DeletePolicy() DeletePolicy {
+    return db.onDelete
+}
+
+// Effects of a deletion on a dependent row
+const (
+    EffectDelete   = "delete"   // deleted along with the row
+    EffectBlock    = "block"    // stops the row being deleted
+    EffectKeep     = "keep"     // left as it is
+    EffectReassign = "reassign" // moved to the replacement bus first
+)
+
+// Dependent is a row that refers to a row being deleted, and what the
+// deletion would do to it
+type Dependent struct {
+    Entity string // the table of the row
+    Key    string // its primary key, space separated as in the audit log
+    Effect string // one of the Effect constants
+}
+
+func (d Dependent) String() string {
+    return fmt.Sprintf("Entity: %s\nKey: %s\nEffect: %s", d.Entity, d.Key, d.Effect)
+}
+
+// BusDependents returns every offering the bus is assigned to, each followed
+// by its observations, and what deleting the bus under the handle's policy
+// would do to them. With a replacement bus the offerings from today on are
+// taken to be reassigned to it first, as by ReassignBus.
+func (db *Database) BusDependents(busID int, replacement int) ([]Dependent, error) {
+    result := []Dependent{}
+    if _, err := db.GetBus(busID); err != nil {
+        return result, err
+    }
+    row, err := db.query(selectOfferingsByBus, busID)
+    if err != nil {
+        return result, err
+    }
+    offerings := RowToTripOfferings(row)
+    row.Close()
+    now := Today()
+    for _, o := range offerings {
+        effect := EffectBlock
+        switch {
+        case replacement != 0 && !o.Date.Before(now):
+            effect = EffectReassign
+        case db.onDelete == DeleteCascade:
+            effect = EffectDelete
+        case db.onDelete == DeleteRetire && o.Date.Before(now):
+            effect = EffectKeep
+        }
+        observations := EffectKeep
+        if effect == EffectDelete {
+            observations = EffectDelete
+        }
+        dependents, err := db.offeringDependents(o, effect, observations)
+        if err != nil {
+            return result, err
+        }
+        result = append(result, dependents...)
+    }
+    return result, nil
+}
+
+// OfferingDependents returns the observations recorded for an offering,
+// which deleting it deletes too
+func (db *Database) OfferingDependents(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay) ([]Dependent, error) {
+    o, err := db.GetOffering(tripNumber, date, scheduledStartTime)
+    if err != nil {
+        return []Dependent{}, err
+    }
+    dependents, err := db.offeringDependents(o, "", EffectDelete)
+    if err != nil {
+        return []Dependent{}, err
+    }
+    return dependents, nil
+}
+
+// offeringDependents lists o with the given effect, unless it is empty, and
+// then its observations with theirs
+func (db *Database) offeringDependents(o TripOffering, effect string, observations string) ([]Dependent, error) {
+    result := []Dependent{}
+    if effect != "" {
+        result = append(result, Dependent{Entity: "TripOffering", Key: offeringKey(o.TripNumber, o.Date, o.ScheduledStartTime), Effect: effect})
+    }
+    row, err := db.query(selectObservationsByOffering, o.TripNumber, o.Date, o.ScheduledStartTime)
+    if err != nil {
+        return result, err
+    }
+    defer row.Close()
+    for _, a := range RowToActualStopInfos(row) {
+        _, key, _ := auditKey(a)
+        result = append(result, Dependent{Entity: "ActualTripStopInfo", Key: key, Effect: observations})
+    }
+    return result, nil
+}
+
+// ReassignBus moves the offerings of a bus on and after from to the
+// replacement bus, checking each for double-booking, and returns them as
+// they now are. Nothing is moved if any one of them cannot be.
+func (db *Database) ReassignBus(busID int, replacement int, from ServiceDate) ([]TripOffering, error) {
+    moved := []TripOffering{}
+    if busID == replacement {
+        return moved, invalidf("Bus %d cannot replace itself", busID)
+    }
+    err := db.WithTx(func(tx *Database) error {
+        if _, err := tx.GetBus(busID); err != nil {
+            return err
+        }
+        if _, err := tx.GetBus(replacement); err != nil {
+            return err
+        }
+        row, err := tx.query(selectBusOfferingsFrom, busID, from)
+        if err != nil {
+            return err
+        }
+        offerings := RowToTripOfferings(row)
+        row.Close()
+        for _, o := range offerings {
+            if err := tx.ChangeBus(replacement, o.TripNumber, o.Date, o.ScheduledStartTime); err != nil {
+                return err
+            }
+            o.BusID = BusRef(replacement)
+            moved = append(moved, o)
+        }
+        return nil
+    })
+    if err != nil {
+        return []TripOffering{}, err
+    }
+    return moved, nil
+}
+
+// RetireBus takes a bus out of service from the given date. The offerings it
+// ran before then keep it, but it cannot be assigned to any on or after it,
+// and it is not retired while any are.
+func (db *Database) RetireBus(busID int, on ServiceDate) error {
+    if on.IsZero() {
+        return invalidf("Bus %d needs a retirement date", busID)
+    }
+    return db.WithTx(func(tx *Database) error {
+        bus, err := tx.GetBus(busID)
+        if err != nil {
+            return err
+        }
+        if !bus.RetiredOn.IsZero() {
+            return invalidf("Bus %d already retired on %s", busID, bus.RetiredOn)
+        }
+        row, err := tx.query(selectBusOfferingsFrom, busID, on)
+        if err != nil {
+            return err
+        }
+        later := RowToTripOfferings(row)
+        row.Close()
+        if len(later) > 0 {
+            return constraintError{fmt.Sprintf("Bus %d is assigned to %s on or after %s, reassign them first", busID, offeringCount(len(later)), on)}
+        }
+        before := bus
+        bus.RetiredOn = on
+        return tx.updateRow(before, bus)
+    })
+}
+
+// RetireDriver takes a driver out of service from the given date, as
+// RetireBus does for a bus
+func (db *Database) RetireDriver(driverName string, on ServiceDate) error {
+    if on.IsZero() {
+        return invalidf("Driver %s needs a retirement date", driverName)
+    }
+    return db.WithTx(func(tx *Database) error {
+        driver, err := tx.GetDriver(driverName)
+        if err != nil {
+            return err
+        }
+        if !driver.RetiredOn.IsZero() {
+            return invalidf("Driver %s already retired on %s", driverName, driver.RetiredOn)
+        }
+        row, err := tx.query(selectDriverOfferingFrom, driverName, on)
+        if err != nil {
+            return err
+        }
+        later := RowToTripOfferings(row)
+        row.Close()
+        if len(later) > 0 {
+            return constraintError{fmt.Sprintf("Driver %s is assigned to %s on or after %s, reassign them first", driverName, offeringCount(len(later)), on)}
+        }
+        before := driver
+        driver.RetiredOn = on
+        return tx.updateRow(before, driver)
+    })
+}
+
+// checkRetired rejects o if its driver or bus has retired by its date. If
+// resources are given only those resources are checked.
+func (db *Database) checkRetired(o TripOffering, resources ...string) error {
+    if o.DriverName != "" && (len(resources) == 0 || containsString(resources, "driver")) {
+        row, err := db.query(selectDriverByName, o.DriverName)
+        if err != nil {
+            return err
+        }
+        drivers := RowToDrivers(row)
+        row.Close()
+        if len(drivers) > 0 && retiredBy(drivers[0].RetiredOn, o.Date) {
+            return invalidf("Driver %s retired on %s", o.DriverName, drivers[0].RetiredOn)
+        }
+    }
+    if o.BusID != nil && (len(resources) == 0 || containsString(resources, "bus")) {
+        row, err := db.query(selectBusByID, *o.BusID)
+        if err != nil {
+            return err
+        }
+        buses := RowToBuses(row)
+        row.Close()
+        if len(buses) > 0 && retiredBy(buses[0].RetiredOn, o.Date) {
+            return invalidf("Bus %d retired on %s", *o.BusID, buses[0].RetiredOn)
+        }
+    }
+    return nil
+}
+
+// retiredBy reports whether something retired on retiredOn is out of
+// service on date
+func retiredBy(retiredOn ServiceDate, date ServiceDate) bool {
+    return !retiredOn.IsZero() && !date.Before(retiredOn)
+}
+
+// GetBus returns the bus with the given ID
+func (db *Database) GetBus(busID int) (Bus, error) {
+    row, err := db.query(selectBusByID, busID)
+    if err != nil {
+        return Bus{}, err
+    }
+    defer row.Close()
+    buses := RowToBuses(row)
+    if len(buses) == 0 {
+        return Bus{}, fmt.Errorf("No bus %d: %w", busID, ErrNotFound)
+    }
+    return buses[0], nil
+}
+
+// GetDriver returns the driver with the given name
+func (db *Database) GetDriver(driverName string) (Driver, error) {
+    row, err := db.query(selectDriverByName, driverName)
+    if err != nil {
+        return Driver{}, err
+    }
+    defer row.Close()
+    drivers := RowToDrivers(row)
+    if len(drivers) == 0 {
+        return Driver{}, fmt.Errorf("No driver %s: %w", driverName, ErrNotFound)
+    }
+    return drivers[0], nil
+}
+
+// offeringCount describes n offerings
+func offeringCount(n int) string {
+    if n == 1 {
+        return "1 offering"
+    }
+    return strconv.Itoa(n) + " offerings"
+}
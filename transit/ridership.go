@@ -0,0 +1,189 @@
+// Ridership and on-board load reporting from passenger counts
+package transit
+
+import (
+    "database/sql"
+    "fmt"
+    "sort"
+    "strings"
+)
+
+const selectPassengerCounts = `SELECT A.TripNumber, A.Date, A.ScheduledStartTime, A.StopNumber, TSI.SequenceNumber, A.NumberOfPassengersIn, A.NumberOfPassengersOut FROM ActualTripStopInfo A LEFT JOIN TripStopInfo TSI ON TSI.TripNumber = A.TripNumber AND TSI.StopNumber = A.StopNumber WHERE A.Date BETWEEN ? AND ? ORDER BY A.Date, A.TripNumber, A.ScheduledStartTime, TSI.SequenceNumber IS NULL, TSI.SequenceNumber`
+
+// StopLoad is the passenger movement at one stop of an offering. Load is
+// the number on board when the bus leaves the stop.
+type StopLoad struct {
+    StopNumber     int
+    SequenceNumber int // 0 when the stop is not part of the trip
+    Boardings      int
+    Alightings     int
+    Load           int
+}
+
+// OfferingLoad is the reconstructed on-board load along one offering
+type OfferingLoad struct {
+    TripNumber         int
+    Date               ServiceDate
+    ScheduledStartTime TimeOfDay
+    Stops              []StopLoad
+    Boardings          int
+    Alightings         int
+    PeakLoad           int
+    PeakFromStop       int // the busiest segment leaves this stop
+    PeakToStop         int // and ends at this one, 0 if it is the last stop
+    Issues             []string
+}
+
+// StopRidership totals boardings and alightings at a stop
+type StopRidership struct {
+    StopNumber int
+    Boardings  int
+    Alightings int
+}
+
+// TripRidership totals passenger movement over every offering of a trip
+type TripRidership struct {
+    TripNumber int
+    Offerings  int
+    Boardings  int
+    Alightings int
+    PeakLoad   int
+}
+
+// RidershipReport aggregates passenger counts between From and To
+type RidershipReport struct {
+    From      ServiceDate
+    To        ServiceDate
+    Offerings []OfferingLoad
+    ByStop    []StopRidership
+    ByTrip    []TripRidership
+}
+
+func (r RidershipReport) String() string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "Ridership %s to %s\n", r.From, r.To)
+    fmt.Fprintf(&b, "\n%-6s %9s %10s %10s %8s\n", "Trip", "Offerings", "Boardings", "Alightings", "PeakLoad")
+    for _, t := range r.ByTrip {
+        fmt.Fprintf(&b, "%-6d %9d %10d %10d %8d\n", t.TripNumber, t.Offerings, t.Boardings, t.Alightings, t.PeakLoad)
+    }
+    fmt.Fprintf(&b, "\n%-6s %10s %10s\n", "Stop", "Boardings", "Alightings")
+    for _, s := range r.ByStop {
+        fmt.Fprintf(&b, "%-6d %10d %10d\n", s.StopNumber, s.Boardings, s.Alightings)
+    }
+    for _, o := range r.Offerings {
+        fmt.Fprintf(&b, "\nTrip %d on %s at %s: peak load %d leaving stop %d\n", o.TripNumber, o.Date, o.ScheduledStartTime, o.PeakLoad, o.PeakFromStop)
+        fmt.Fprintf(&b, "%-5s %-6s %4s %4s %5s\n", "Seq", "Stop", "In", "Out", "Load")
+        for _, s := range o.Stops {
+            fmt.Fprintf(&b, "%-5d %-6d %4d %4d %5d\n", s.SequenceNumber, s.StopNumber, s.Boardings, s.Alightings, s.Load)
+        }
+        for _, issue := range o.Issues {
+            fmt.Fprintf(&b, "Warning: %s\n", issue)
+        }
+    }
+    return b.String()
+}
+
+// RidershipReport reconstructs the load of every observed offering between
+// from and to, ordering stops by their TripStopInfo sequence number
+func (db *Database) RidershipReport(from, to ServiceDate) (RidershipReport, error) {
+    report := RidershipReport{From: from, To: to, Offerings: []OfferingLoad{}, ByStop: []StopRidership{}, ByTrip: []TripRidership{}}
+    row, err := db.query(selectPassengerCounts, from, to)
+    if err != nil {
+        return report, err
+    }
+    defer row.Close()
+    for row.Next() {
+        var tripNumber, stopNumber int
+        var date ServiceDate
+        var scheduledStart TimeOfDay
+        var sequence, in, out sql.NullInt64
+        row.Scan(&tripNumber, &date, &scheduledStart, &stopNumber, &sequence, &in, &out)
+        n := len(report.Offerings)
+        if n == 0 || report.Offerings[n-1].TripNumber != tripNumber || !report.Offerings[n-1].Date.Equal(date) || report.Offerings[n-1].ScheduledStartTime != scheduledStart {
+            report.Offerings = append(report.Offerings, OfferingLoad{TripNumber: tripNumber, Date: date, ScheduledStartTime: scheduledStart, Stops: []StopLoad{}, Issues: []string{}})
+            n++
+        }
+        report.Offerings[n-1].Stops = append(report.Offerings[n-1].Stops, StopLoad{
+            StopNumber:     stopNumber,
+            SequenceNumber: int(sequence.Int64),
+            Boardings:      int(in.Int64),
+            Alightings:     int(out.Int64),
+        })
+    }
+    if err := row.Err(); err != nil {
+        return report, err
+    }
+    byStop := make(map[int]*StopRidership)
+    byTrip := make(map[int]*TripRidership)
+    for i := range report.Offerings {
+        o := &report.Offerings[i]
+        o.reconstruct()
+        t, ok := byTrip[o.TripNumber]
+        if !ok {
+            t = &TripRidership{TripNumber: o.TripNumber}
+            byTrip[o.TripNumber] = t
+        }
+        t.Offerings++
+        t.Boardings += o.Boardings
+        t.Alightings += o.Alightings
+        if o.PeakLoad > t.PeakLoad {
+            t.PeakLoad = o.PeakLoad
+        }
+        for _, s := range o.Stops {
+            st, ok := byStop[s.StopNumber]
+            if !ok {
+                st = &StopRidership{StopNumber: s.StopNumber}
+                byStop[s.StopNumber] = st
+            }
+            st.Boardings += s.Boardings
+            st.Alightings += s.Alightings
+        }
+    }
+    for _, t := range byTrip {
+        report.ByTrip = append(report.ByTrip, *t)
+    }
+    sort.Slice(report.ByTrip, func(i, j int) bool { return report.ByTrip[i].TripNumber < report.ByTrip[j].TripNumber })
+    for _, s := range byStop {
+        report.ByStop = append(report.ByStop, *s)
+    }
+    sort.Slice(report.ByStop, func(i, j int) bool { return report.ByStop[i].StopNumber < report.ByStop[j].StopNumber })
+    return report, nil
+}
+
+// reconstruct walks the stops in order computing the load after each one,
+// the peak segment and any inconsistencies in the counts
+func (o *OfferingLoad) reconstruct() {
+    load := 0
+    for i := range o.Stops {
+        s := &o.Stops[i]
+        if s.SequenceNumber == 0 {
+            o.Issues = append(o.Issues, fmt.Sprintf("stop %d is not a stop of trip %d", s.StopNumber, o.TripNumber))
+        }
+        if i > 0 && s.SequenceNumber != 0 && s.SequenceNumber == o.Stops[i-1].SequenceNumber {
+            o.Issues = append(o.Issues, fmt.Sprintf("stops %d and %d share sequence number %d", o.Stops[i-1].StopNumber, s.StopNumber, s.SequenceNumber))
+        }
+        if s.Boardings < 0 || s.Alightings < 0 {
+            o.Issues = append(o.Issues, fmt.Sprintf("negative passenger count at stop %d", s.StopNumber))
+        }
+        if load-s.Alightings < 0 {
+            o.Issues = append(o.Issues, fmt.Sprintf("%d passengers alight at stop %d but only %d are on board", s.Alightings, s.StopNumber, load))
+        }
+        load += s.Boardings - s.Alightings
+        s.Load = load
+        o.Boardings += s.Boardings
+        o.Alightings += s.Alightings
+        if i == 0 || load > o.PeakLoad {
+            o.PeakLoad = load
+            o.PeakFromStop = s.StopNumber
+            o.PeakToStop = 0
+            if i+1 < len(o.Stops) {
+                o.PeakToStop = o.Stops[i+1].StopNumber
+            }
+        }
+    }
+    if load < 0 {
+        o.Issues = append(o.Issues, fmt.Sprintf("load ends negative at %d", load))
+    } else if load > 0 {
+        o.Issues = append(o.Issues, fmt.Sprintf("%d passengers are still on board after the last stop", load))
+    }
+}
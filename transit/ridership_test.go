@@ -0,0 +1,93 @@
+package transit_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+func TestRidershipLoad(t *testing.T) {
+	db := openMemory(t)
+	for _, err := range []error{
+		db.AddTrip(1, "Pomona", "Ontario"),
+		db.AddBus(0, "Gillig", 2015),
+		db.AddDriver("Ann", "555-0100"),
+		db.AddStop(10, "1 Main St"),
+		db.AddStop(11, "2 Holt Ave"),
+		db.AddStop(12, "3 Mission Blvd"),
+		db.AddStop(13, "4 Euclid Ave"),
+		db.AddTripStopInfo(1, 10, 1, 0),
+		db.AddTripStopInfo(1, 11, 2, 10),
+		db.AddTripStopInfo(1, 12, 3, 10),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	start, arrival := mustParseTime(t, "08:00"), mustParseTime(t, "08:20")
+	monday, tuesday := mustParseDate(t, "2026-10-19"), mustParseDate(t, "2026-10-20")
+	for _, date := range []transit.ServiceDate{monday, tuesday, mustParseDate(t, "2026-10-26")} {
+		if err := db.AddOffering(1, date, start, arrival, "Ann", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	observe := func(date transit.ServiceDate, stop, in, out int) {
+		t.Helper()
+		if err := db.AddActualTripStopInfo(1, date, start, stop, arrival, start, arrival, in, out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Counts are added out of stop order to check the sequence numbers are followed
+	observe(monday, 12, 0, 7)
+	observe(monday, 10, 5, 0)
+	observe(monday, 11, 4, 2)
+	// Tuesday's counts do not add up, and stop 13 is not on the trip
+	observe(tuesday, 10, 2, 0)
+	observe(tuesday, 11, 0, 3)
+	observe(tuesday, 13, 1, 0)
+	// Outside the report's dates
+	observe(mustParseDate(t, "2026-10-26"), 10, 50, 50)
+
+	report, err := db.RidershipReport(monday, mustParseDate(t, "2026-10-25"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Offerings) != 2 {
+		t.Fatalf("Report has offerings %v, want Monday's and Tuesday's", report.Offerings)
+	}
+	mon := report.Offerings[0]
+	loads := []transit.StopLoad{
+		{StopNumber: 10, SequenceNumber: 1, Boardings: 5, Alightings: 0, Load: 5},
+		{StopNumber: 11, SequenceNumber: 2, Boardings: 4, Alightings: 2, Load: 7},
+		{StopNumber: 12, SequenceNumber: 3, Boardings: 0, Alightings: 7, Load: 0},
+	}
+	if !reflect.DeepEqual(mon.Stops, loads) {
+		t.Errorf("Monday's loads %v, want %v", mon.Stops, loads)
+	}
+	if mon.PeakLoad != 7 || mon.PeakFromStop != 11 || mon.PeakToStop != 12 || len(mon.Issues) != 0 {
+		t.Errorf("Monday's peak %d from stop %d to %d with issues %q, want 7 from 11 to 12 and no issues", mon.PeakLoad, mon.PeakFromStop, mon.PeakToStop, mon.Issues)
+	}
+	tue := report.Offerings[1]
+	issues := strings.Join(tue.Issues, "\n")
+	for _, want := range []string{
+		"3 passengers alight at stop 11 but only 2 are on board",
+		"stop 13 is not a stop of trip 1",
+	} {
+		if !strings.Contains(issues, want) {
+			t.Errorf("Tuesday's issues %q, want %q", issues, want)
+		}
+	}
+	if last := tue.Stops[len(tue.Stops)-1]; last.StopNumber != 13 || last.SequenceNumber != 0 {
+		t.Errorf("Tuesday's last stop %v, want stop 13, which is off the trip, after the trip's stops", last)
+	}
+	byTrip := []transit.TripRidership{{TripNumber: 1, Offerings: 2, Boardings: 12, Alightings: 12, PeakLoad: 7}}
+	if !reflect.DeepEqual(report.ByTrip, byTrip) {
+		t.Errorf("Ridership by trip %v, want %v", report.ByTrip, byTrip)
+	}
+	byStop := []transit.StopRidership{{10, 7, 0}, {11, 4, 5}, {12, 0, 7}, {13, 1, 0}}
+	if !reflect.DeepEqual(report.ByStop, byStop) {
+		t.Errorf("Ridership by stop %v, want %v", report.ByStop, byStop)
+	}
+}
@@ -0,0 +1,163 @@
+// Schema of a new database, compiled into the binary
+package transit
+
+import (
+    _ "embed"
+    "fmt"
+    "io/ioutil"
+    "log"
+    "os"
+    "strings"
+)
+
+// schema creates the tables that the migrations build on
+//go:embed lab4_create-tables.sql
+var schema string
+
+// createTables runs the schema script in one transaction, so a failure
+// leaves no tables behind. The script is read from schemaPath if it is set.
+func (db *Database) createTables(schemaPath string) error {
+    script := schema
+    if schemaPath != "" {
+        f, err := ioutil.ReadFile(schemaPath)
+        if err != nil {
+            return fmt.Errorf("Error reading schema: %v", err)
+        }
+        script = string(f)
+    }
+    statements, err := splitSQL(script)
+    if err != nil {
+        return fmt.Errorf("Error reading schema: %v", err)
+    }
+    log.Println("Executing table schemas")
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    for i, s := range statements {
+        if _, err := tx.Exec(s); err != nil {
+            tx.Rollback()
+            return fmt.Errorf("Schema statement %d failed: %v", i+1, err)
+        }
+    }
+    return tx.Commit()
+}
+
+// removeDatabaseFiles deletes a database file that could not be set up,
+// along with any journal SQLite left beside it
+func removeDatabaseFiles(path string) {
+    for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+        os.Remove(path + suffix)
+    }
+}
+
+// splitSQL splits a script into its statements. Semicolons only end a
+// statement outside of comments, quoted strings and identifiers, and the
+// body of a CREATE TRIGGER. Statements holding nothing but comments are
+// dropped.
+func splitSQL(script string) ([]string, error) {
+    statements := []string{}
+    var current strings.Builder
+    words := []string{} // upper-cased words of the current statement
+    empty := true       // the current statement is only space and comments
+    for i := 0; i < len(script); i++ {
+        c := script[i]
+        switch {
+        case c == '-' && strings.HasPrefix(script[i:], "--"):
+            end := strings.IndexByte(script[i:], '\n')
+            if end < 0 {
+                end = len(script) - i
+            }
+            i += end - 1
+            current.WriteByte(' ')
+            continue
+        case c == '/' && strings.HasPrefix(script[i:], "/*"):
+            end := strings.Index(script[i+2:], "*/")
+            if end < 0 {
+                return nil, invalidf("Unterminated comment at offset %d", i)
+            }
+            i += end + 3
+            current.WriteByte(' ')
+            continue
+        case c == '\'' || c == '"' || c == '`' || c == '[':
+            closing := c
+            if c == '[' {
+                closing = ']'
+            }
+            end := i + 1
+            for {
+                next := strings.IndexByte(script[end:], closing)
+                if next < 0 {
+                    return nil, invalidf("Unterminated quote at offset %d", i)
+                }
+                end += next + 1
+                // A doubled quote is an escaped one, except for brackets
+                if closing == ']' || end >= len(script) || script[end] != closing {
+                    break
+                }
+                end++
+            }
+            current.WriteString(script[i:end])
+            i = end - 1
+            empty = false
+            words = append(words, "")
+            continue
+        case c == ';':
+            if inTriggerBody(words) {
+                current.WriteByte(c)
+                words = append(words, ";")
+                continue
+            }
+            if !empty {
+                statements = append(statements, strings.TrimSpace(current.String()))
+            }
+            current.Reset()
+            words = words[:0]
+            empty = true
+            continue
+        case isWordByte(c):
+            end := i
+            for end < len(script) && isWordByte(script[end]) {
+                end++
+            }
+            words = append(words, strings.ToUpper(script[i:end]))
+            current.WriteString(script[i:end])
+            i = end - 1
+            empty = false
+            continue
+        }
+        current.WriteByte(c)
+        if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+            empty = false
+        }
+    }
+    if !empty {
+        statements = append(statements, strings.TrimSpace(current.String()))
+    }
+    return statements, nil
+}
+
+// inTriggerBody reports whether the words of a statement so far leave it
+// inside the BEGIN ... END body of a CREATE TRIGGER. CASE ... END
+// expressions in the body are counted so their END does not close it.
+func inTriggerBody(words []string) bool {
+    if len(words) == 0 || words[0] != "CREATE" {
+        return false
+    }
+    trigger, depth := false, 0
+    for _, w := range words {
+        switch {
+        case w == "TRIGGER":
+            trigger = true
+        case (w == "BEGIN" || w == "CASE") && trigger:
+            depth++
+        case w == "END" && depth > 0:
+            depth--
+        }
+    }
+    return depth > 0
+}
+
+func isWordByte(c byte) bool {
+    return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
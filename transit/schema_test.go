@@ -0,0 +1,84 @@
+package transit
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSplitSQL(t *testing.T) {
+	tests := []struct {
+		name, script string
+		want         []string
+	}{
+		{"statements", "CREATE TABLE A (x);\nCREATE TABLE B (y);", []string{"CREATE TABLE A (x)", "CREATE TABLE B (y)"}},
+		{"no final semicolon", "SELECT 1;SELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"empty statements", ";; SELECT 1;;", []string{"SELECT 1"}},
+		{"line comment", "SELECT 1; -- the second; not a statement\nSELECT 2;", []string{"SELECT 1", "SELECT 2"}},
+		{"comment at the end", "SELECT 1; -- done", []string{"SELECT 1"}},
+		{"block comment", "SELECT /* a; b */ 1;", []string{"SELECT   1"}},
+		{"only comments", "/* header; */\n-- nothing here;\n", []string{}},
+		{"quoted semicolon", "INSERT INTO A VALUES ('a;b');", []string{"INSERT INTO A VALUES ('a;b')"}},
+		{"doubled quote", "INSERT INTO A VALUES ('it''s; fine');", []string{"INSERT INTO A VALUES ('it''s; fine')"}},
+		{"quoted comment", "SELECT '-- not a comment; really';", []string{"SELECT '-- not a comment; really'"}},
+		{"identifiers", "SELECT \"a;b\", `c;d`, [e;f] FROM A;", []string{"SELECT \"a;b\", `c;d`, [e;f] FROM A"}},
+		{"doubled bracket is not an escape", "SELECT [a]];", []string{"SELECT [a]]"}},
+		{
+			"trigger body",
+			"CREATE TRIGGER T AFTER INSERT ON A BEGIN DELETE FROM B; DELETE FROM C; END; SELECT 1;",
+			[]string{"CREATE TRIGGER T AFTER INSERT ON A BEGIN DELETE FROM B; DELETE FROM C; END", "SELECT 1"},
+		},
+		{
+			"CASE in a trigger body",
+			"CREATE TRIGGER T BEFORE INSERT ON A BEGIN SELECT CASE WHEN NEW.x < 0 THEN RAISE(ABORT, 'negative') END; UPDATE B SET n = n + 1; END;\nSELECT 2;",
+			[]string{"CREATE TRIGGER T BEFORE INSERT ON A BEGIN SELECT CASE WHEN NEW.x < 0 THEN RAISE(ABORT, 'negative') END; UPDATE B SET n = n + 1; END", "SELECT 2"},
+		},
+		{"CASE outside a trigger", "SELECT CASE WHEN 1 THEN 2 END; SELECT 3;", []string{"SELECT CASE WHEN 1 THEN 2 END", "SELECT 3"}},
+		{"BEGIN transaction", "BEGIN; SELECT 1; END;", []string{"BEGIN", "SELECT 1", "END"}},
+	}
+	for _, tt := range tests {
+		got, err := splitSQL(tt.script)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: splitSQL(%q) = %q, want %q", tt.name, tt.script, got, tt.want)
+		}
+	}
+}
+
+func TestSplitSQLRejectsUnterminated(t *testing.T) {
+	for _, script := range []string{
+		"SELECT 'open;",
+		"SELECT 'it''s;",
+		"SELECT \"open;",
+		"SELECT [open;",
+		"SELECT 1; /* open; SELECT 2;",
+	} {
+		if got, err := splitSQL(script); !errors.Is(err, ErrInvalid) {
+			t.Errorf("splitSQL(%q) = %q, %v, want an invalid input error", script, got, err)
+		}
+	}
+}
+
+func TestInTriggerBody(t *testing.T) {
+	tests := []struct {
+		words []string
+		want  bool
+	}{
+		{nil, false},
+		{[]string{"SELECT", "CASE"}, false},
+		{[]string{"CREATE", "TABLE", "BEGIN"}, false},
+		{[]string{"CREATE", "TRIGGER", "T"}, false},
+		{[]string{"CREATE", "TRIGGER", "T", "BEGIN"}, true},
+		{[]string{"CREATE", "TRIGGER", "T", "BEGIN", "SELECT", "CASE", "END"}, true},
+		{[]string{"CREATE", "TRIGGER", "T", "BEGIN", "SELECT", "CASE", "CASE", "END", "END", "END"}, false},
+		{[]string{"CREATE", "TRIGGER", "T", "BEGIN", ";", "END"}, false},
+	}
+	for _, tt := range tests {
+		if got := inTriggerBody(tt.words); got != tt.want {
+			t.Errorf("inTriggerBody(%q) = %v, want %v", tt.words, got, tt.want)
+		}
+	}
+}
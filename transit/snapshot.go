@@ -0,0 +1,284 @@
+// Whole-database snapshots as JSON or YAML documents
+package transit
+
+import (
+    "bytes"
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "path/filepath"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+)
+
+const (
+    SnapshotJSON = "json"
+    SnapshotYAML = "yaml"
+)
+
+// Rows are dumped in the order they were inserted
+const (
+    selectTripsInOrder               = selectTrips + ` ORDER BY rowid`
+    selectTripOfferingsInOrder       = selectTripOfferings + ` ORDER BY rowid`
+    selectBusesInOrder               = selectBuses + ` ORDER BY rowid`
+    selectDriversInOrder             = selectDrivers + ` ORDER BY rowid`
+    selectStopsInOrder               = selectStops + ` ORDER BY rowid`
+    selectTripStopInfosInOrder       = selectTripStopInfos + ` ORDER BY rowid`
+    selectActualTripStopInfosInOrder = selectActualTripStopInfos + ` ORDER BY rowid`
+    selectServicePatternsInOrder     = selectServicePatterns + ` ORDER BY rowid`
+    selectHolidaysInOrder            = `SELECT Date, HolidayName, ServiceAs FROM Holiday ORDER BY rowid`
+    selectServiceExceptionsInOrder   = `SELECT TripNumber, Date, ExceptionType, Reason FROM ServiceException ORDER BY rowid`
+)
+
+// Snapshot is the full contents of the database keyed by table name
+type Snapshot struct {
+    SchemaVersion      int
+    Bus                []Bus
+    Driver             []Driver
+    Stop               []Stop
+    Trip               []Trip
+    TripStopInfo       []TripStopInfo
+    TripOffering       []TripOffering
+    ActualTripStopInfo []ActualTripStopInfo
+    ServicePattern     []ServicePattern
+    Holiday            []Holiday
+    ServiceException   []ServiceException
+}
+
+// SnapshotFormat returns the snapshot format implied by a file name,
+// YAML for .yaml and .yml files and JSON otherwise
+func SnapshotFormat(path string) string {
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".yaml", ".yml":
+        return SnapshotYAML
+    }
+    return SnapshotJSON
+}
+
+// Dump reads every table into a snapshot
+func (db *Database) Dump() (Snapshot, error) {
+    s := Snapshot{}
+    version, err := db.SchemaVersion()
+    if err != nil {
+        return s, err
+    }
+    s.SchemaVersion = version
+    tables := []struct {
+        query string
+        read  func(*sql.Rows)
+    }{
+        {selectBusesInOrder, func(r *sql.Rows) { s.Bus = RowToBuses(r) }},
+        {selectDriversInOrder, func(r *sql.Rows) { s.Driver = RowToDrivers(r) }},
+        {selectStopsInOrder, func(r *sql.Rows) { s.Stop = RowToStops(r) }},
+        {selectTripsInOrder, func(r *sql.Rows) { s.Trip = RowToTrips(r) }},
+        {selectTripStopInfosInOrder, func(r *sql.Rows) { s.TripStopInfo = RowToTripStopInfos(r) }},
+        {selectTripOfferingsInOrder, func(r *sql.Rows) { s.TripOffering = RowToTripOfferings(r) }},
+        {selectActualTripStopInfosInOrder, func(r *sql.Rows) { s.ActualTripStopInfo = RowToActualStopInfos(r) }},
+        {selectServicePatternsInOrder, func(r *sql.Rows) { s.ServicePattern = RowToServicePatterns(r) }},
+        {selectHolidaysInOrder, func(r *sql.Rows) { s.Holiday = RowToHolidays(r) }},
+        {selectServiceExceptionsInOrder, func(r *sql.Rows) { s.ServiceException = RowToServiceExceptions(r) }},
+    }
+    for _, t := range tables {
+        row, err := db.query(t.query)
+        if err != nil {
+            return s, err
+        }
+        t.read(row)
+        row.Close()
+    }
+    return s, nil
+}
+
+// Validate checks that every row of the snapshot refers only to rows the
+// snapshot contains, reporting all the dangling references at once
+func (s Snapshot) Validate() error {
+    buses := map[int]bool{}
+    for _, b := range s.Bus {
+        buses[b.BusID] = true
+    }
+    drivers := map[string]bool{}
+    for _, d := range s.Driver {
+        drivers[d.DriverName] = true
+    }
+    stops := map[int]bool{}
+    for _, st := range s.Stop {
+        stops[st.StopNumber] = true
+    }
+    trips := map[int]bool{}
+    for _, t := range s.Trip {
+        trips[t.TripNumber] = true
+    }
+    offerings := map[calendarKey]map[TimeOfDay]bool{}
+    problems := []string{}
+    for _, t := range s.TripStopInfo {
+        if !trips[t.TripNumber] {
+            problems = append(problems, fmt.Sprintf("TripStopInfo for stop %d refers to missing trip %d", t.StopNumber, t.TripNumber))
+        }
+        if !stops[t.StopNumber] {
+            problems = append(problems, fmt.Sprintf("TripStopInfo of trip %d refers to missing stop %d", t.TripNumber, t.StopNumber))
+        }
+    }
+    for _, o := range s.TripOffering {
+        key := calendarKey{o.TripNumber, o.Date.String()}
+        if offerings[key] == nil {
+            offerings[key] = map[TimeOfDay]bool{}
+        }
+        offerings[key][o.ScheduledStartTime] = true
+        problems = append(problems, checkAssignment(fmt.Sprintf("TripOffering of trip %d on %s at %s", o.TripNumber, o.Date, o.ScheduledStartTime), o.TripNumber, o.DriverName, o.BusID, trips, drivers, buses)...)
+    }
+    for _, a := range s.ActualTripStopInfo {
+        if !offerings[calendarKey{a.TripNumber, a.Date.String()}][a.ScheduledStartTime] {
+            problems = append(problems, fmt.Sprintf("ActualTripStopInfo for stop %d refers to missing offering of trip %d on %s at %s", a.StopNumber, a.TripNumber, a.Date, a.ScheduledStartTime))
+        }
+        if !stops[a.StopNumber] {
+            problems = append(problems, fmt.Sprintf("ActualTripStopInfo of trip %d on %s refers to missing stop %d", a.TripNumber, a.Date, a.StopNumber))
+        }
+    }
+    for _, p := range s.ServicePattern {
+        problems = append(problems, checkAssignment(fmt.Sprintf("ServicePattern %s", p.PatternName), p.TripNumber, p.DriverName, &p.BusID, trips, drivers, buses)...)
+    }
+    for _, e := range s.ServiceException {
+        if e.TripNumber != 0 && !trips[e.TripNumber] {
+            problems = append(problems, fmt.Sprintf("ServiceException on %s refers to missing trip %d", e.Date, e.TripNumber))
+        }
+    }
+    if len(problems) > 0 {
+        return invalidf("Snapshot is inconsistent: %s", strings.Join(problems, "; "))
+    }
+    return nil
+}
+
+// checkAssignment reports a trip, driver or bus that what refers to but the
+// snapshot does not contain. An empty driver or nil bus is unassigned.
+func checkAssignment(what string, tripNumber int, driverName string, busID *int, trips map[int]bool, drivers map[string]bool, buses map[int]bool) []string {
+    problems := []string{}
+    if !trips[tripNumber] {
+        problems = append(problems, fmt.Sprintf("%s refers to missing trip %d", what, tripNumber))
+    }
+    if driverName != "" && !drivers[driverName] {
+        problems = append(problems, fmt.Sprintf("%s refers to missing driver %s", what, driverName))
+    }
+    if busID != nil && !buses[*busID] {
+        problems = append(problems, fmt.Sprintf("%s refers to missing bus %d", what, *busID))
+    }
+    return problems
+}
+
+// Restore loads a snapshot into a database whose tables are all empty. The
+// snapshot is validated first and loaded in one transaction, keeping the
+// order of the rows in each table.
+func (db *Database) Restore(s Snapshot) error {
+    version, err := db.SchemaVersion()
+    if err != nil {
+        return err
+    }
+    if s.SchemaVersion > version {
+        return invalidf("Snapshot schema version %d is newer than the database (%d)", s.SchemaVersion, version)
+    }
+    if err := s.Validate(); err != nil {
+        return err
+    }
+    current, err := db.Dump()
+    if err != nil {
+        return err
+    }
+    if n := current.rowCount(); n > 0 {
+        return invalidf("Cannot restore into a database that already has %d rows", n)
+    }
+    rows := []interface{}{}
+    for _, r := range s.Bus {
+        rows = append(rows, r)
+    }
+    for _, r := range s.Driver {
+        rows = append(rows, r)
+    }
+    for _, r := range s.Stop {
+        rows = append(rows, r)
+    }
+    for _, r := range s.Trip {
+        rows = append(rows, r)
+    }
+    for _, r := range s.TripStopInfo {
+        rows = append(rows, r)
+    }
+    for _, r := range s.TripOffering {
+        rows = append(rows, r)
+    }
+    for _, r := range s.ActualTripStopInfo {
+        rows = append(rows, r)
+    }
+    for _, r := range s.ServicePattern {
+        rows = append(rows, r)
+    }
+    for _, r := range s.Holiday {
+        rows = append(rows, r)
+    }
+    for _, r := range s.ServiceException {
+        rows = append(rows, r)
+    }
+    return db.WithTx(func(tx *Database) error {
+        for _, r := range rows {
+            if err := tx.insertRow(r); err != nil {
+                return fmt.Errorf("Restoring %T %+v: %v", r, r, err)
+            }
+        }
+        return nil
+    })
+}
+
+func (s Snapshot) rowCount() int {
+    return len(s.Bus) + len(s.Driver) + len(s.Stop) + len(s.Trip) + len(s.TripStopInfo) + len(s.TripOffering) + len(s.ActualTripStopInfo) + len(s.ServicePattern) + len(s.Holiday) + len(s.ServiceException)
+}
+
+// DumpTo writes a snapshot of the database to w in the given format
+func (db *Database) DumpTo(w io.Writer, format string) error {
+    s, err := db.Dump()
+    if err != nil {
+        return err
+    }
+    data, err := json.MarshalIndent(s, "", "  ")
+    if err != nil {
+        return err
+    }
+    if format == SnapshotYAML {
+        // Going through JSON keeps the YAML keys the same as the JSON ones
+        var doc interface{}
+        if err := json.Unmarshal(data, &doc); err != nil {
+            return err
+        }
+        if data, err = yaml.Marshal(doc); err != nil {
+            return err
+        }
+    } else {
+        data = append(data, '\n')
+    }
+    _, err = w.Write(data)
+    return err
+}
+
+// RestoreFrom reads a snapshot in the given format from r and restores it
+func (db *Database) RestoreFrom(r io.Reader, format string) error {
+    data, err := ioutil.ReadAll(r)
+    if err != nil {
+        return err
+    }
+    if format == SnapshotYAML {
+        var doc interface{}
+        if err := yaml.Unmarshal(data, &doc); err != nil {
+            return invalidf("Invalid YAML snapshot: %v", err)
+        }
+        if data, err = json.Marshal(doc); err != nil {
+            return invalidf("Invalid YAML snapshot: %v", err)
+        }
+    }
+    var s Snapshot
+    dec := json.NewDecoder(bytes.NewReader(data))
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(&s); err != nil {
+        return invalidf("Invalid snapshot: %v", err)
+    }
+    return db.Restore(s)
+}
@@ -0,0 +1,154 @@
+package transit_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+// fullDatabase returns a database with a row in every table
+func fullDatabase(t *testing.T) *transit.Database {
+	t.Helper()
+	db := openMemory(t)
+	date := mustParseDate(t, "2026-10-19")
+	start, arrival := mustParseTime(t, "23:50"), mustParseTime(t, "00:20")
+	for _, err := range []error{
+		db.AddTrip(1, "Pomona", "O'Hare"),
+		db.AddBus(0, "Gillig", 2015),
+		db.AddDriver("Ann", "555-0100"),
+		db.AddStop(10, "1 Main St"),
+		db.AddTripStopInfo(1, 10, 1, 30),
+		db.AddOffering(1, date, start, arrival, "Ann", 0),
+		db.AddActualTripStopInfo(1, date, start, 10, arrival, start, mustParseTime(t, "00:25"), 3, 3),
+		db.AddServicePattern(weekdayPattern(t)),
+		db.AddHoliday(transit.Holiday{Date: mustParseDate(t, "2026-12-25"), HolidayName: "Christmas"}),
+		db.AddServiceException(transit.ServiceException{TripNumber: 0, Date: mustParseDate(t, "2026-10-20"), ExceptionType: transit.ServiceRemoved, Reason: "storm"}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// snapshotJSON dumps db as compact JSON for comparing snapshots
+func snapshotJSON(t *testing.T, db *transit.Database) string {
+	t.Helper()
+	s, err := db.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	db := fullDatabase(t)
+	want := snapshotJSON(t, db)
+	for _, format := range []string{transit.SnapshotJSON, transit.SnapshotYAML} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := db.DumpTo(&buf, format); err != nil {
+				t.Fatal(err)
+			}
+			restored := openMemory(t)
+			if err := restored.RestoreFrom(bytes.NewReader(buf.Bytes()), format); err != nil {
+				t.Fatal(err)
+			}
+			if got := snapshotJSON(t, restored); got != want {
+				t.Errorf("Restored snapshot\n%s\nwant\n%s", got, want)
+			}
+			// Restoring again would duplicate every row
+			if err := restored.RestoreFrom(bytes.NewReader(buf.Bytes()), format); !errors.Is(err, transit.ErrInvalid) {
+				t.Errorf("Restoring into a database with rows returned %v, want an invalid input error", err)
+			}
+		})
+	}
+}
+
+func TestSnapshotValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(s *transit.Snapshot)
+		want   []string
+	}{
+		{"consistent", func(s *transit.Snapshot) {}, nil},
+		{"missing bus 0", func(s *transit.Snapshot) { s.Bus = nil }, []string{
+			"TripOffering of trip 1 on 2026-10-19 at 23:50 refers to missing bus 0",
+			"ServicePattern weekday refers to missing bus 0",
+		}},
+		{"unassigned bus", func(s *transit.Snapshot) { s.Bus = nil; s.ServicePattern = nil; s.TripOffering[0].BusID = nil }, nil},
+		{"missing trip", func(s *transit.Snapshot) { s.Trip = nil }, []string{
+			"TripStopInfo for stop 10 refers to missing trip 1",
+			"TripOffering of trip 1 on 2026-10-19 at 23:50 refers to missing trip 1",
+			"ServicePattern weekday refers to missing trip 1",
+		}},
+		{"missing stop", func(s *transit.Snapshot) { s.Stop = nil }, []string{
+			"TripStopInfo of trip 1 refers to missing stop 10",
+			"ActualTripStopInfo of trip 1 on 2026-10-19 refers to missing stop 10",
+		}},
+		{"missing offering", func(s *transit.Snapshot) { s.TripOffering = nil }, []string{
+			"ActualTripStopInfo for stop 10 refers to missing offering of trip 1 on 2026-10-19 at 23:50",
+		}},
+		{"missing driver", func(s *transit.Snapshot) { s.Driver = nil }, []string{
+			"TripOffering of trip 1 on 2026-10-19 at 23:50 refers to missing driver Ann",
+		}},
+		{"exception of a missing trip", func(s *transit.Snapshot) { s.ServiceException[0].TripNumber = 9 }, []string{
+			"ServiceException on 2026-10-20 refers to missing trip 9",
+		}},
+	}
+	for _, tt := range tests {
+		s, err := fullDatabase(t).Dump()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.change(&s)
+		err = s.Validate()
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, transit.ErrInvalid) {
+			t.Errorf("%s: Validate returned %v, want an invalid input error", tt.name, err)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: %v, want it to say %q", tt.name, err, want)
+			}
+		}
+		// Nothing of an inconsistent snapshot is restored
+		db := openMemory(t)
+		if err := db.Restore(s); !errors.Is(err, transit.ErrInvalid) {
+			t.Errorf("%s: Restore returned %v, want an invalid input error", tt.name, err)
+		}
+		if snapshotJSON(t, db) != snapshotJSON(t, openMemory(t)) {
+			t.Errorf("%s: rows were restored from an inconsistent snapshot", tt.name)
+		}
+	}
+}
+
+func TestRestoreRefusesNewerSchema(t *testing.T) {
+	db := fullDatabase(t)
+	s, err := db.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SchemaVersion++
+	if err := openMemory(t).Restore(s); !errors.Is(err, transit.ErrInvalid) {
+		t.Errorf("Restoring a snapshot of a newer schema returned %v, want an invalid input error", err)
+	}
+	unknown := `{"SchemaVersion": 1, "Bus": [], "Depot": []}`
+	if err := openMemory(t).RestoreFrom(strings.NewReader(unknown), transit.SnapshotJSON); !errors.Is(err, transit.ErrInvalid) {
+		t.Errorf("Restoring a snapshot with an unknown table returned %v, want an invalid input error", err)
+	}
+}
@@ -0,0 +1,122 @@
+// Prepared statements used by the transit database
+package transit
+
+import (
+    "database/sql"
+    "sync"
+)
+
+// SQL used by the Database methods. Every value is passed as a bound
+// placeholder so names containing quotes or SQL are stored verbatim.
+const (
+    selectTrips               = `SELECT TripNumber, StartLocationName, DestinationName FROM Trip`
+    selectTripOfferings       = `SELECT TripNumber, Date, ScheduledStartTime, ScheduledArrivalTime, DriverName, BusID FROM TripOffering`
+    selectBuses               = `SELECT BusID, Model, Year, RetiredOn FROM Bus`
+    selectDrivers             = `SELECT DriverName, DriverTelephoneNumber, RetiredOn FROM Driver`
+    selectStops               = `SELECT StopNumber, StopAddress FROM Stop`
+    selectTripStopInfos       = `SELECT TripNumber, StopNumber, SequenceNumber, DrivingTime FROM TripStopInfo`
+    selectActualTripStopInfos = `SELECT TripNumber, Date, ScheduledStartTime, StopNumber, ScheduledArrivalTime, ActualStartTime, ActualArrivalTime, NumberOfPassengersIn, NumberOfPassengersOut FROM ActualTripStopInfo`
+
+    selectTripByNumber       = selectTrips + ` WHERE TripNumber = ?`
+    selectTripsByRoute       = selectTrips + ` WHERE StartLocationName = ? AND DestinationName = ?`
+    selectOfferingsByTripDay = selectTripOfferings + ` WHERE TripNumber = ? AND Date = ? ORDER BY ScheduledStartTime`
+    selectOfferingsByDriver  = selectTripOfferings + ` WHERE DriverName = ?`
+    selectDriverOfferings    = selectTripOfferings + ` WHERE DriverName = ? AND Date BETWEEN ? AND ? ORDER BY Date, ScheduledStartTime`
+    selectStopsByTrip        = selectTripStopInfos + ` WHERE TripNumber = ? ORDER BY SequenceNumber`
+    selectBusByID            = selectBuses + ` WHERE BusID = ?`
+    selectDriverByName       = selectDrivers + ` WHERE DriverName = ?`
+    selectStopByNumber       = selectStops + ` WHERE StopNumber = ?`
+    selectTripStopInfoByKey  = selectTripStopInfos + ` WHERE TripNumber = ? AND StopNumber = ?`
+
+    selectActualTripStopInfoByKey = selectActualTripStopInfos + ` WHERE TripNumber = ? AND Date = ? AND ScheduledStartTime = ? AND StopNumber = ?`
+
+    selectObservationsByOffering = selectActualTripStopInfos + ` WHERE TripNumber = ? AND Date = ? AND ScheduledStartTime = ?`
+
+    insertTrip               = `INSERT INTO Trip (TripNumber, StartLocationName, DestinationName) VALUES (?, ?, ?)`
+    insertTripOffering       = `INSERT INTO TripOffering (TripNumber, Date, ScheduledStartTime, ScheduledArrivalTime, DriverName, BusID) VALUES (?, ?, ?, ?, ?, ?)`
+    insertBus                = `INSERT INTO Bus (BusID, Model, Year, RetiredOn) VALUES (?, ?, ?, ?)`
+    insertDriver             = `INSERT INTO Driver (DriverName, DriverTelephoneNumber, RetiredOn) VALUES (?, ?, ?)`
+    insertStop               = `INSERT INTO Stop (StopNumber, StopAddress) VALUES (?, ?)`
+    insertTripStopInfo       = `INSERT INTO TripStopInfo (TripNumber, StopNumber, SequenceNumber, DrivingTime) VALUES (?, ?, ?, ?)`
+    insertActualTripStopInfo = `INSERT INTO ActualTripStopInfo (TripNumber, Date, ScheduledStartTime, StopNumber, ScheduledArrivalTime, ActualStartTime, ActualArrivalTime, NumberOfPassengersIn, NumberOfPassengersOut) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+    updateOfferingDriver = `UPDATE TripOffering SET DriverName = ? WHERE TripNumber = ? AND Date = ? AND ScheduledStartTime = ?`
+    updateOfferingBus    = `UPDATE TripOffering SET BusID = ? WHERE TripNumber = ? AND Date = ? AND ScheduledStartTime = ?`
+    updateOffering       = `UPDATE TripOffering SET ScheduledArrivalTime = ?, DriverName = ?, BusID = ? WHERE TripNumber = ? AND Date = ? AND ScheduledStartTime = ?`
+    updateTrip           = `UPDATE Trip SET StartLocationName = ?, DestinationName = ? WHERE TripNumber = ?`
+    updateDriver         = `UPDATE Driver SET DriverTelephoneNumber = ?, RetiredOn = ? WHERE DriverName = ?`
+    updateStop           = `UPDATE Stop SET StopAddress = ? WHERE StopNumber = ?`
+    updateTripStopInfo   = `UPDATE TripStopInfo SET SequenceNumber = ?, DrivingTime = ? WHERE TripNumber = ? AND StopNumber = ?`
+
+    updateActualTripStopInfo = `UPDATE ActualTripStopInfo SET ScheduledArrivalTime = ?, ActualStartTime = ?, ActualArrivalTime = ?, NumberOfPassengersIn = ?, NumberOfPassengersOut = ? WHERE TripNumber = ? AND Date = ? AND ScheduledStartTime = ? AND StopNumber = ?`
+
+    deleteTripOffering       = `DELETE FROM TripOffering WHERE TripNumber = ? AND Date = ? AND ScheduledStartTime = ?`
+    deleteBus                = `DELETE FROM Bus WHERE BusID = ?`
+    deleteTrip               = `DELETE FROM Trip WHERE TripNumber = ?`
+    deleteDriver             = `DELETE FROM Driver WHERE DriverName = ?`
+    deleteStop               = `DELETE FROM Stop WHERE StopNumber = ?`
+    deleteTripStopInfo       = `DELETE FROM TripStopInfo WHERE TripNumber = ? AND StopNumber = ?`
+    deleteActualTripStopInfo = `DELETE FROM ActualTripStopInfo WHERE TripNumber = ? AND Date = ? AND ScheduledStartTime = ? AND StopNumber = ?`
+)
+
+// stmtCache holds prepared statements keyed by their query text
+type stmtCache struct {
+    mu    sync.Mutex
+    stmts map[string]*sql.Stmt
+}
+
+func newStmtCache() *stmtCache {
+    return &stmtCache{stmts: make(map[string]*sql.Stmt)}
+}
+
+// prepared returns the cached statement for query, preparing it on first use
+func (db *Database) prepared(query string) (*sql.Stmt, error) {
+    db.stmts.mu.Lock()
+    defer db.stmts.mu.Unlock()
+    if stmt, ok := db.stmts.stmts[query]; ok {
+        return stmt, nil
+    }
+    stmt, err := db.DB.Prepare(query)
+    if err != nil {
+        return nil, err
+    }
+    db.stmts.stmts[query] = stmt
+    return stmt, nil
+}
+
+// exec runs a cached statement that does not return rows, in the handle's
+// transaction if it has one
+func (db *Database) exec(query string, args ...interface{}) (sql.Result, error) {
+    stmt, err := db.prepared(query)
+    if err != nil {
+        return nil, err
+    }
+    if db.tx != nil {
+        return db.tx.Stmt(stmt).Exec(args...)
+    }
+    return stmt.Exec(args...)
+}
+
+// query runs a cached statement that returns rows, in the handle's
+// transaction if it has one
+func (db *Database) query(query string, args ...interface{}) (*sql.Rows, error) {
+    stmt, err := db.prepared(query)
+    if err != nil {
+        return nil, err
+    }
+    if db.tx != nil {
+        return db.tx.Stmt(stmt).Query(args...)
+    }
+    return stmt.Query(args...)
+}
+
+// Close releases the cached statements and closes the underlying database
+func (db *Database) Close() error {
+    db.stmts.mu.Lock()
+    for query, stmt := range db.stmts.stmts {
+        stmt.Close()
+        delete(db.stmts.stmts, query)
+    }
+    db.stmts.mu.Unlock()
+    return db.DB.Close()
+}
@@ -0,0 +1,106 @@
+// Storage interfaces implemented by every backend
+package transit
+
+import (
+    "errors"
+
+    "github.com/mattn/go-sqlite3"
+)
+
+// ErrConstraint is matched, using IsConstraint, by errors reporting a
+// duplicate key or a reference to a row that does not exist
+var ErrConstraint = errors.New("Constraint failed")
+
+// constraintError is a key or reference violation that matches ErrConstraint
+type constraintError struct {
+    msg string
+}
+
+func (e constraintError) Error() string {
+    return e.msg
+}
+
+func (e constraintError) Is(target error) bool {
+    return target == ErrConstraint
+}
+
+// IsConstraint reports whether err is a key or reference violation from any
+// backend, including the constraint errors SQLite returns
+func IsConstraint(err error) bool {
+    var sqliteErr sqlite3.Error
+    return errors.Is(err, ErrConstraint) || errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint
+}
+
+// TripStore holds trips and the stops each one makes
+type TripStore interface {
+    GetTripTable() ([]Trip, error)
+    AddTrip(tripNumber int, startLocationName string, destinationName string) error
+    GetTripStopInfoTable() ([]TripStopInfo, error)
+    AddTripStopInfo(tripNumber int, stopNumber int, sequenceNumber int, drivingTime float32) error
+    // GetStops returns the stops of a trip in sequence order
+    GetStops(tripNumber int) ([]TripStopInfo, error)
+}
+
+// OfferingStore holds the dated trip offerings and who drives them. Adding
+// or changing an offering is refused with a *ConflictError if it double-books
+// a driver or bus.
+type OfferingStore interface {
+    GetTripOfferingTable() ([]TripOffering, error)
+    // GetSchedule returns the trips between two places and their offerings
+    // on date, keyed by trip number in start time order
+    GetSchedule(startLocationName, destinationName string, date ServiceDate) ([]Trip, map[int][]TripOffering, error)
+    GetDriverWeeklySchedule(driverName string, date ServiceDate) ([]TripOffering, error)
+    GetDriverSchedule(driverName string, from ServiceDate, to ServiceDate) ([]TripOffering, error)
+    AddOffering(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay, scheduledArrivalTime TimeOfDay, driverName string, busID int) error
+    AddOfferings(offerings []TripOffering) error
+    // DeleteOffering also deletes the observations recorded for the offering
+    DeleteOffering(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay) error
+    ChangeDriver(driverName string, tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay) error
+    ChangeBus(busID int, tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay) error
+    FindConflicts(o TripOffering) ([]*ConflictError, error)
+}
+
+// FleetStore holds the buses
+type FleetStore interface {
+    GetBusTable() ([]Bus, error)
+    AddBus(busID int, model string, year int) error
+    // DeleteBus refuses to delete a bus that offerings are assigned to,
+    // unless a Database is given another DeletePolicy
+    DeleteBus(busID int) error
+}
+
+// DriverStore holds the drivers
+type DriverStore interface {
+    GetDriverTable() ([]Driver, error)
+    AddDriver(driverName string, driverTelephoneNumber string) error
+}
+
+// StopStore holds the stops
+type StopStore interface {
+    GetStopTable() ([]Stop, error)
+    AddStop(stopNumber int, stopAddress string) error
+}
+
+// ObservationStore holds what actually happened at each stop of an offering
+type ObservationStore interface {
+    GetActualTripStopInfoTable() ([]ActualTripStopInfo, error)
+    AddActualTripStopInfo(tripNumber int, date ServiceDate, scheduledStartTime TimeOfDay, stopNumber int, scheduledArrivalTime TimeOfDay, actualStartTime TimeOfDay, actualArrivalTime TimeOfDay, numberOfPassengerIn int, numberOfPassengerOut int) error
+}
+
+// Store is every aggregate of the transit schedule. Backends reject the same
+// input with the same kinds of error: ErrInvalid for malformed input,
+// ErrNotFound for a missing row, a constraint error (see IsConstraint) for
+// duplicate keys and missing references, and *ConflictError for double-bookings.
+type Store interface {
+    TripStore
+    OfferingStore
+    FleetStore
+    DriverStore
+    StopStore
+    ObservationStore
+}
+
+var (
+    _ Store = (*Database)(nil)
+    _ Store = (*MemoryStore)(nil)
+)
@@ -0,0 +1,26 @@
+package transit_test
+
+import (
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+	"github.com/hlin91/CS4350_Lab4/transit/storetest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	err := storetest.Run(func() (transit.Store, error) {
+		return transit.NewMemoryStore(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDatabaseStore(t *testing.T) {
+	err := storetest.Run(func() (transit.Store, error) {
+		return transit.GetDatabase(transit.Options{InMemory: true})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,566 @@
+// Package storetest checks that an implementation of transit.Store behaves
+// as the SQLite backend does, so backends can be swapped without callers
+// noticing. It is a plain package rather than a test file so that any
+// backend, in any package, can run the same checks from its own tests:
+//
+//	func TestStore(t *testing.T) {
+//		if err := storetest.Run(newStore); err != nil {
+//			t.Fatal(err)
+//		}
+//	}
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+// check is one behaviour every store must have, run against a new store
+type check struct {
+	name string
+	run  func(s transit.Store) error
+}
+
+// Run runs every check against its own empty store from newStore, closing
+// stores that are io.Closers afterwards. It reports all the failed checks.
+func Run(newStore func() (transit.Store, error)) error {
+	failures := []string{}
+	for _, c := range checks {
+		s, err := newStore()
+		if err != nil {
+			return fmt.Errorf("Creating a store for %s: %v", c.name, err)
+		}
+		if err := c.run(s); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", c.name, err))
+		}
+		if closer, ok := s.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d store checks failed:\n%s", len(failures), len(checks), strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+var checks = []check{
+	{"empty tables", checkEmptyTables},
+	{"added rows are listed in order", checkTables},
+	{"duplicate keys", checkDuplicateKeys},
+	{"missing references", checkMissingReferences},
+	{"stops of a trip", checkStops},
+	{"schedule", checkSchedule},
+	{"driver schedule", checkDriverSchedule},
+	{"double-booking", checkConflicts},
+	{"adding offerings is all or nothing", checkAddOfferings},
+	{"change driver and bus", checkChanges},
+	{"delete offering", checkDeleteOffering},
+	{"delete bus", checkDeleteBus},
+	{"input validation", checkValidation},
+}
+
+// Dates and times used by the checks. Monday is 2021-05-03.
+var (
+	monday    = date("2021-05-03")
+	tuesday   = date("2021-05-04")
+	sunday    = date("2021-05-09")
+	nextWeek  = date("2021-05-10")
+	lastWeek  = date("2021-05-02")
+	eight     = clock("08:00")
+	eightHalf = clock("08:30")
+	nine      = clock("09:00")
+	ten       = clock("10:00")
+	lateNight = clock("23:30")
+	afterOne  = clock("25:10")
+)
+
+func date(s string) transit.ServiceDate {
+	d, err := transit.ParseServiceDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func clock(s string) transit.TimeOfDay {
+	t, err := transit.ParseTimeOfDay(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// seed adds two buses, two drivers, three stops and three trips, two of
+// which run from Downtown to Airport
+func seed(s transit.Store) error {
+	steps := []error{
+		s.AddBus(1, "Gillig", 2015),
+		s.AddBus(2, "New Flyer", 2019),
+		s.AddDriver("Ann", "555-0100"),
+		s.AddDriver("Bob", "555-0101"),
+		s.AddStop(1, "1 Main St"),
+		s.AddStop(2, "2 Main St"),
+		s.AddStop(3, "3 Main St"),
+		s.AddTrip(10, "Downtown", "Airport"),
+		s.AddTrip(11, "Downtown", "Airport"),
+		s.AddTrip(12, "Airport", "Harbor"),
+	}
+	for _, err := range steps {
+		if err != nil {
+			return fmt.Errorf("Seeding the store: %v", err)
+		}
+	}
+	return nil
+}
+
+// offer adds an offering, failing with its key if it is refused
+func offer(s transit.Store, trip int, d transit.ServiceDate, start, arrival transit.TimeOfDay, driver string, bus int) error {
+	if err := s.AddOffering(trip, d, start, arrival, driver, bus); err != nil {
+		return fmt.Errorf("Adding trip %d on %s at %s: %v", trip, d, start, err)
+	}
+	return nil
+}
+
+// errorKind names a category of error that every store must agree on
+type errorKind struct {
+	name string
+	is   func(error) bool
+}
+
+var (
+	notFound   = errorKind{"not found", func(err error) bool { return errors.Is(err, transit.ErrNotFound) }}
+	invalid    = errorKind{"invalid", func(err error) bool { return errors.Is(err, transit.ErrInvalid) }}
+	constraint = errorKind{"a constraint error", transit.IsConstraint}
+	conflict   = errorKind{"a conflict", func(err error) bool {
+		var c *transit.ConflictError
+		return errors.As(err, &c)
+	}}
+)
+
+// expectError fails unless err is of the given kind
+func expectError(what string, err error, kind errorKind) error {
+	if err == nil {
+		return fmt.Errorf("%s succeeded, expected %s", what, kind.name)
+	}
+	if !kind.is(err) {
+		return fmt.Errorf("%s returned %q, expected %s", what, err, kind.name)
+	}
+	return nil
+}
+
+// expectRows fails unless got and want print the same. Rows are compared by
+// their text so that equal dates with different internal forms match.
+func expectRows(what string, got, want interface{}) error {
+	g, w := fmt.Sprintf("%v", got), fmt.Sprintf("%v", want)
+	if g != w {
+		return fmt.Errorf("%s returned\n%s\nexpected\n%s", what, g, w)
+	}
+	return nil
+}
+
+// firstError returns the first failure of a check's steps
+func firstError(steps ...error) error {
+	for _, err := range steps {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkEmptyTables(s transit.Store) error {
+	trips, err1 := s.GetTripTable()
+	offerings, err2 := s.GetTripOfferingTable()
+	buses, err3 := s.GetBusTable()
+	drivers, err4 := s.GetDriverTable()
+	stops, err5 := s.GetStopTable()
+	tripStops, err6 := s.GetTripStopInfoTable()
+	observations, err7 := s.GetActualTripStopInfoTable()
+	if err := firstError(err1, err2, err3, err4, err5, err6, err7); err != nil {
+		return err
+	}
+	// Empty tables are empty slices, not nil, so they encode as [] in JSON
+	if trips == nil || offerings == nil || buses == nil || drivers == nil || stops == nil || tripStops == nil || observations == nil {
+		return fmt.Errorf("An empty table was returned as nil")
+	}
+	if n := len(trips) + len(offerings) + len(buses) + len(drivers) + len(stops) + len(tripStops) + len(observations); n != 0 {
+		return fmt.Errorf("A new store has %d rows", n)
+	}
+	return nil
+}
+
+func checkTables(s transit.Store) error {
+	if err := seed(s); err != nil {
+		return err
+	}
+	if err := firstError(
+		s.AddTripStopInfo(10, 2, 1, 4.5),
+		s.AddTripStopInfo(10, 1, 2, 3),
+		offer(s, 11, monday, nine, ten, "Bob", 2),
+		offer(s, 10, monday, eight, eightHalf, "Ann", 1),
+		s.AddActualTripStopInfo(10, monday, eight, 2, eight, eight, clock("08:05"), 3, 1),
+	); err != nil {
+		return err
+	}
+	trips, err1 := s.GetTripTable()
+	offerings, err2 := s.GetTripOfferingTable()
+	buses, err3 := s.GetBusTable()
+	drivers, err4 := s.GetDriverTable()
+	stops, err5 := s.GetStopTable()
+	tripStops, err6 := s.GetTripStopInfoTable()
+	observations, err7 := s.GetActualTripStopInfoTable()
+	if err := firstError(err1, err2, err3, err4, err5, err6, err7); err != nil {
+		return err
+	}
+	return firstError(
+		expectRows("GetTripTable", trips, []transit.Trip{{TripNumber: 10, StartLocationName: "Downtown", DestinationName: "Airport"}, {TripNumber: 11, StartLocationName: "Downtown", DestinationName: "Airport"}, {TripNumber: 12, StartLocationName: "Airport", DestinationName: "Harbor"}}),
+		expectRows("GetTripOfferingTable", offerings, []transit.TripOffering{
+			{TripNumber: 11, Date: monday, ScheduledStartTime: nine, ScheduledArrivalTime: ten, DriverName: "Bob", BusID: transit.BusRef(2)},
+			{TripNumber: 10, Date: monday, ScheduledStartTime: eight, ScheduledArrivalTime: eightHalf, DriverName: "Ann", BusID: transit.BusRef(1)},
+		}),
+		expectRows("GetBusTable", buses, []transit.Bus{{BusID: 1, Model: "Gillig", Year: 2015}, {BusID: 2, Model: "New Flyer", Year: 2019}}),
+		expectRows("GetDriverTable", drivers, []transit.Driver{{DriverName: "Ann", DriverTelephoneNumber: "555-0100"}, {DriverName: "Bob", DriverTelephoneNumber: "555-0101"}}),
+		expectRows("GetStopTable", stops, []transit.Stop{{StopNumber: 1, StopAddress: "1 Main St"}, {StopNumber: 2, StopAddress: "2 Main St"}, {StopNumber: 3, StopAddress: "3 Main St"}}),
+		expectRows("GetTripStopInfoTable", tripStops, []transit.TripStopInfo{{TripNumber: 10, StopNumber: 2, SequenceNumber: 1, DrivingTime: 4.5}, {TripNumber: 10, StopNumber: 1, SequenceNumber: 2, DrivingTime: 3}}),
+		expectRows("GetActualTripStopInfoTable", observations, []transit.ActualTripStopInfo{{
+			TripNumber:           10,
+			Date:                 monday,
+			ScheduledStartTime:   eight,
+			StopNumber:           2,
+			ScheduledArrivalTime: eight,
+			ActualStartTime:      eight,
+			ActualArrivalTime:    clock("08:05"),
+			NumberOfPassengerIn:  3,
+			NumberOfPassengerOut: 1,
+		}}),
+	)
+}
+
+func checkDuplicateKeys(s transit.Store) error {
+	if err := seed(s); err != nil {
+		return err
+	}
+	if err := firstError(
+		s.AddTripStopInfo(10, 1, 1, 2),
+		offer(s, 10, monday, eight, eightHalf, "Ann", 1),
+		s.AddActualTripStopInfo(10, monday, eight, 1, eight, eight, eight, 1, 0),
+	); err != nil {
+		return err
+	}
+	return firstError(
+		expectError("Adding trip 10 again", s.AddTrip(10, "Elsewhere", "Nowhere"), constraint),
+		expectError("Adding bus 1 again", s.AddBus(1, "Other", 2000), constraint),
+		expectError("Adding driver Ann again", s.AddDriver("Ann", "555-0199"), constraint),
+		expectError("Adding stop 1 again", s.AddStop(1, "Elsewhere"), constraint),
+		expectError("Adding stop 1 to trip 10 again", s.AddTripStopInfo(10, 1, 2, 2), constraint),
+		expectError("Reusing sequence number 1 of trip 10", s.AddTripStopInfo(10, 2, 1, 2), constraint),
+		expectError("Adding the offering again", s.AddOffering(10, monday, eight, nine, "Bob", 2), constraint),
+		expectError("Observing stop 1 again", s.AddActualTripStopInfo(10, monday, eight, 1, eight, eight, eight, 2, 0), constraint),
+	)
+}
+
+func checkMissingReferences(s transit.Store) error {
+	if err := seed(s); err != nil {
+		return err
+	}
+	if err := offer(s, 10, monday, eight, eightHalf, "Ann", 1); err != nil {
+		return err
+	}
+	err := firstError(
+		expectError("Adding a stop to missing trip 99", s.AddTripStopInfo(99, 1, 1, 2), constraint),
+		expectError("Adding missing stop 99 to a trip", s.AddTripStopInfo(10, 99, 1, 2), constraint),
+		expectError("Offering missing trip 99", s.AddOffering(99, monday, nine, ten, "Bob", 2), constraint),
+		expectError("Offering with missing driver Zed", s.AddOffering(11, monday, nine, ten, "Zed", 2), constraint),
+		expectError("Offering with missing bus 99", s.AddOffering(11, monday, nine, ten, "Bob", 99), constraint),
+		expectError("Observing a missing offering", s.AddActualTripStopInfo(10, monday, nine, 1, nine, nine, nine, 1, 0), constraint),
+		expectError("Observing missing stop 99", s.AddActualTripStopInfo(10, monday, eight, 99, eight, eight, eight, 1, 0), constraint),
+		expectError("Changing to missing driver Zed", s.ChangeDriver("Zed", 10, monday, eight), constraint),
+		expectError("Changing to missing bus 99", s.ChangeBus(99, 10, monday, eight), constraint),
+	)
+	if err != nil {
+		return err
+	}
+	offerings, err := s.GetTripOfferingTable()
+	if err != nil {
+		return err
+	}
+	return expectRows("GetTripOfferingTable after refused changes", offerings, []transit.TripOffering{
+		{TripNumber: 10, Date: monday, ScheduledStartTime: eight, ScheduledArrivalTime: eightHalf, DriverName: "Ann", BusID: transit.BusRef(1)},
+	})
+}
+
+func checkStops(s transit.Store) error {
+	if err := seed(s); err != nil {
+		return err
+	}
+	if err := firstError(
+		s.AddTripStopInfo(10, 3, 3, 1),
+		s.AddTripStopInfo(10, 1, 1, 2),
+		s.AddTripStopInfo(11, 1, 1, 5),
+		s.AddTripStopInfo(10, 2, 2, 3),
+	); err != nil {
+		return err
+	}
+	stops, err := s.GetStops(10)
+	if err != nil {
+		return err
+	}
+	none, err := s.GetStops(12)
+	if err != nil {
+		return err
+	}
+	return firstError(
+		expectRows("GetStops(10)", stops, []transit.TripStopInfo{{TripNumber: 10, StopNumber: 1, SequenceNumber: 1, DrivingTime: 2}, {TripNumber: 10, StopNumber: 2, SequenceNumber: 2, DrivingTime: 3}, {TripNumber: 10, StopNumber: 3, SequenceNumber: 3, DrivingTime: 1}}),
+		expectRows("GetStops(12)", none, []transit.TripStopInfo{}),
+	)
+}
+
+func checkSchedule(s transit.Store) error {
+	if err := seed(s); err != nil {
+		return err
+	}
+	if err := firstError(
+		offer(s, 10, monday, nine, ten, "Ann", 1),
+		offer(s, 10, monday, eight, eightHalf, "Bob", 2),
+		offer(s, 10, tuesday, eight, eightHalf, "Ann", 1),
+		offer(s, 12, monday, eight, eightHalf, "Ann", 1),
+	); err != nil {
+		return err
+	}
+	trips, offerings, err := s.GetSchedule("Downtown", "Airport", monday)
+	if err != nil {
+		return err
+	}
+	if err := firstError(
+		expectRows("GetSchedule trips", trips, []transit.Trip{{TripNumber: 10, StartLocationName: "Downtown", DestinationName: "Airport"}, {TripNumber: 11, StartLocationName: "Downtown", DestinationName: "Airport"}}),
+		expectRows("GetSchedule offerings of trip 10", offerings[10], []transit.TripOffering{
+			{TripNumber: 10, Date: monday, ScheduledStartTime: eight, ScheduledArrivalTime: eightHalf, DriverName: "Bob", BusID: transit.BusRef(2)},
+			{TripNumber: 10, Date: monday, ScheduledStartTime: nine, ScheduledArrivalTime: ten, DriverName: "Ann", BusID: transit.BusRef(1)},
+		}),
+		expectRows("GetSchedule offerings of trip 11", offerings[11], []transit.TripOffering{}),
+	); err != nil {
+		return err
+	}
+	trips, offerings, err = s.GetSchedule("Harbor", "Downtown", monday)
+	if err != nil {
+		return err
+	}
+	if len(trips) != 0 || len(offerings) != 0 {
+		return fmt.Errorf("GetSchedule of a route with no trips returned %v and %v", trips, offerings)
+	}
+	return nil
+}
+
+func checkDriverSchedule(s transit.Store) error {
+	if err := seed(s); err != nil {
+		return err
+	}
+	if err := firstError(
+		offer(s, 10, tuesday, nine, ten, "Ann", 1),
+		offer(s, 11, monday, nine, ten, "Ann", 1),
+		offer(s, 10, monday, eight, eightHalf, "Ann", 1),
+		offer(s, 12, sunday, eight, eightHalf, "Ann", 1),
+		offer(s, 12, nextWeek, eight, eightHalf, "Ann", 1),
+		offer(s, 12, lastWeek, eight, eightHalf, "Ann", 1),
+		offer(s, 11, tuesday, eight, eightHalf, "Bob", 2),
+	); err != nil {
+		return err
+	}
+	week, err := s.GetDriverWeeklySchedule("Ann", date("2021-05-06"))
+	if err != nil {
+		return err
+	}
+	days, err := s.GetDriverSchedule("Ann", monday, tuesday)
+	if err != nil {
+		return err
+	}
+	mondayToTuesday := []transit.TripOffering{
+		{TripNumber: 10, Date: monday, ScheduledStartTime: eight, ScheduledArrivalTime: eightHalf, DriverName: "Ann", BusID: transit.BusRef(1)},
+		{TripNumber: 11, Date: monday, ScheduledStartTime: nine, ScheduledArrivalTime: ten, DriverName: "Ann", BusID: transit.BusRef(1)},
+		{TripNumber: 10, Date: tuesday, ScheduledStartTime: nine, ScheduledArrivalTime: ten, DriverName: "Ann", BusID: transit.BusRef(1)},
+	}
+	_, rangeErr := s.GetDriverSchedule("Ann", transit.ServiceDate{}, tuesday)
+	return firstError(
+		expectRows("GetDriverWeeklySchedule", week, append(mondayToTuesday, transit.TripOffering{TripNumber: 12, Date: sunday, ScheduledStartTime: eight, ScheduledArrivalTime: eightHalf, DriverName: "Ann", BusID: transit.BusRef(1)})),
+		expectRows("GetDriverSchedule", days, mondayToTuesday),
+		expectError("GetDriverSchedule without a start date", rangeErr, invalid),
+	)
+}
+
+func checkConflicts(s transit.Store) error {
+	if err := seed(s); err != nil {
+		return err
+	}
+	if err := firstError(
+		offer(s, 10, monday, eight, nine, "Ann", 1),
+		offer(s, 12, monday, lateNight, afterOne, "Bob", 2),
+		// Back to back offerings do not overlap
+		offer(s, 11, monday, nine, ten, "Ann", 1),
+	); err != nil {
+		return err
+	}
+	overlap := transit.TripOffering{TripNumber: 11, Date: monday, ScheduledStartTime: eightHalf, ScheduledArrivalTime: nine, DriverName: "Ann", BusID: transit.BusRef(2)}
+	found, err := s.FindConflicts(overlap)
+	if err != nil {
+		return err
+	}
+	if len(found) != 1 || found[0].Resource != "driver" || found[0].Existing.TripNumber != 10 {
+		return fmt.Errorf("FindConflicts returned %v, expected driver Ann on trip 10", found)
+	}
+	overnight := transit.TripOffering{TripNumber: 10, Date: monday, ScheduledStartTime: clock("24:30"), ScheduledArrivalTime: clock("25:30"), DriverName: "Ann", BusID: transit.BusRef(2)}
+	if found, err = s.FindConflicts(overnight); err != nil {
+		return err
+	}
+	if len(found) != 1 || found[0].Resource != "bus" || found[0].Existing.TripNumber != 12 {
+		return fmt.Errorf("FindConflicts returned %v, expected bus 2 on trip 12", found)
+	}
+	return firstError(
+		expectError("Double-booking driver Ann", s.AddOffering(overlap.TripNumber, overlap.Date, overlap.ScheduledStartTime, overlap.ScheduledArrivalTime, overlap.DriverName, *overlap.BusID), conflict),
+		expectError("Adding an offering without an arrival time", s.AddOffering(11, tuesday, eight, transit.TimeOfDay{}, "Ann", 1), invalid),
+		// Another date is free
+		offer(s, 11, tuesday, eightHalf, nine, "Ann", 2),
+	)
+}
+
+func checkAddOfferings(s transit.Store) error {
+	if err := seed(s); err != nil {
+		return err
+	}
+	batch := []transit.TripOffering{
+		{TripNumber: 10, Date: monday, ScheduledStartTime: eight, ScheduledArrivalTime: nine, DriverName: "Ann", BusID: transit.BusRef(1)},
+		{TripNumber: 11, Date: monday, ScheduledStartTime: nine, ScheduledArrivalTime: ten, DriverName: "Bob", BusID: transit.BusRef(2)},
+		// Clashes with the first offering of the same batch
+		{TripNumber: 12, Date: monday, ScheduledStartTime: eightHalf, ScheduledArrivalTime: nine, DriverName: "Ann", BusID: transit.BusRef(2)},
+	}
+	if err := expectError("Adding a batch that double-books Ann", s.AddOfferings(batch), conflict); err != nil {
+		return err
+	}
+	missing := append(batch[:2:2], transit.TripOffering{TripNumber: 99, Date: monday, ScheduledStartTime: eight, ScheduledArrivalTime: nine, DriverName: "Bob", BusID: transit.BusRef(2)})
+	if err := expectError("Adding a batch with missing trip 99", s.AddOfferings(missing), constraint); err != nil {
+		return err
+	}
+	offerings, err := s.GetTripOfferingTable()
+	if err != nil {
+		return err
+	}
+	if err := expectRows("GetTripOfferingTable after refused batches", offerings, []transit.TripOffering{}); err != nil {
+		return err
+	}
+	if err := s.AddOfferings(batch[:2]); err != nil {
+		return err
+	}
+	if offerings, err = s.GetTripOfferingTable(); err != nil {
+		return err
+	}
+	return expectRows("GetTripOfferingTable after a batch", offerings, batch[:2])
+}
+
+func checkChanges(s transit.Store) error {
+	if err := seed(s); err != nil {
+		return err
+	}
+	if err := firstError(
+		offer(s, 10, monday, eight, nine, "Ann", 1),
+		offer(s, 11, monday, eightHalf, ten, "Bob", 2),
+	); err != nil {
+		return err
+	}
+	err := firstError(
+		expectError("Changing the driver of a missing offering", s.ChangeDriver("Bob", 12, monday, eight), notFound),
+		expectError("Changing the bus of a missing offering", s.ChangeBus(2, 12, monday, eight), notFound),
+		expectError("Double-booking driver Ann", s.ChangeDriver("Ann", 11, monday, eightHalf), conflict),
+		expectError("Double-booking bus 1", s.ChangeBus(1, 11, monday, eightHalf), conflict),
+	)
+	if err != nil {
+		return err
+	}
+	if err := firstError(
+		s.DeleteOffering(10, monday, eight),
+		s.ChangeDriver("Ann", 11, monday, eightHalf),
+		s.ChangeBus(1, 11, monday, eightHalf),
+	); err != nil {
+		return err
+	}
+	offerings, err := s.GetTripOfferingTable()
+	if err != nil {
+		return err
+	}
+	return expectRows("GetTripOfferingTable after changes", offerings, []transit.TripOffering{
+		{TripNumber: 11, Date: monday, ScheduledStartTime: eightHalf, ScheduledArrivalTime: ten, DriverName: "Ann", BusID: transit.BusRef(1)},
+	})
+}
+
+func checkDeleteOffering(s transit.Store) error {
+	if err := seed(s); err != nil {
+		return err
+	}
+	if err := firstError(
+		offer(s, 10, monday, eight, nine, "Ann", 1),
+		offer(s, 11, monday, eight, nine, "Bob", 2),
+		s.AddActualTripStopInfo(10, monday, eight, 1, eight, eight, eight, 1, 0),
+		s.AddActualTripStopInfo(11, monday, eight, 1, eight, eight, eight, 2, 0),
+	); err != nil {
+		return err
+	}
+	if err := expectError("Deleting a missing offering", s.DeleteOffering(10, tuesday, eight), notFound); err != nil {
+		return err
+	}
+	if err := s.DeleteOffering(10, monday, eight); err != nil {
+		return err
+	}
+	offerings, err := s.GetTripOfferingTable()
+	if err != nil {
+		return err
+	}
+	observations, err := s.GetActualTripStopInfoTable()
+	if err != nil {
+		return err
+	}
+	if len(offerings) != 1 || offerings[0].TripNumber != 11 {
+		return fmt.Errorf("After deleting trip 10 the offerings are %v", offerings)
+	}
+	// The observations of the deleted offering go with it
+	if len(observations) != 1 || observations[0].TripNumber != 11 {
+		return fmt.Errorf("After deleting trip 10 the observations are %v", observations)
+	}
+	return nil
+}
+
+func checkDeleteBus(s transit.Store) error {
+	if err := seed(s); err != nil {
+		return err
+	}
+	if err := offer(s, 10, monday, eight, nine, "Ann", 1); err != nil {
+		return err
+	}
+	err := firstError(
+		expectError("Deleting missing bus 99", s.DeleteBus(99), notFound),
+		expectError("Deleting bus 1, which trip 10 uses", s.DeleteBus(1), constraint),
+		s.DeleteBus(2),
+	)
+	if err != nil {
+		return err
+	}
+	buses, err := s.GetBusTable()
+	if err != nil {
+		return err
+	}
+	return expectRows("GetBusTable after deleting bus 2", buses, []transit.Bus{{BusID: 1, Model: "Gillig", Year: 2015}})
+}
+
+func checkValidation(s transit.Store) error {
+	if err := seed(s); err != nil {
+		return err
+	}
+	return firstError(
+		expectError("Adding an offering without a date", s.AddOffering(10, transit.ServiceDate{}, eight, nine, "Ann", 1), invalid),
+		expectError("Adding offerings without a date", s.AddOfferings([]transit.TripOffering{{TripNumber: 10, ScheduledStartTime: eight, ScheduledArrivalTime: nine, DriverName: "Ann", BusID: transit.BusRef(1)}}), invalid),
+		expectError("Adding an offering without a start time", s.AddOffering(10, monday, transit.TimeOfDay{}, nine, "Ann", 1), invalid),
+		expectError("Observing without a date", s.AddActualTripStopInfo(10, transit.ServiceDate{}, eight, 1, eight, eight, eight, 1, 0), invalid),
+		expectError("Observing without a start time", s.AddActualTripStopInfo(10, monday, transit.TimeOfDay{}, 1, eight, eight, eight, 1, 0), invalid),
+	)
+}
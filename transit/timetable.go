@@ -0,0 +1,120 @@
+// Stop-by-stop timetables derived from TripStopInfo driving times
+package transit
+
+import (
+    "database/sql"
+    "fmt"
+    "math"
+    "strings"
+)
+
+const selectTimetableStops = `SELECT TSI.SequenceNumber, TSI.StopNumber, S.StopAddress, TSI.DrivingTime FROM TripStopInfo TSI LEFT JOIN Stop S ON S.StopNumber = TSI.StopNumber WHERE TSI.TripNumber = ? ORDER BY TSI.SequenceNumber`
+
+// TimetableStop is one stop of an offering with its computed arrival time.
+// DrivingTime is the minutes driven from the previous stop.
+type TimetableStop struct {
+    SequenceNumber       int
+    StopNumber           int
+    StopAddress          string
+    DrivingTime          float32
+    ScheduledArrivalTime TimeOfDay
+}
+
+// Timetable lists when an offering reaches each of its trip's stops
+type Timetable struct {
+    Trip     Trip
+    Offering TripOffering
+    Stops    []TimetableStop
+    // Drift is the scheduled arrival minus the arrival implied by the
+    // driving times, in minutes
+    Drift float64
+}
+
+// Validate checks that the driving times add up to the scheduled arrival time
+func (t Timetable) Validate() error {
+    if len(t.Stops) == 0 {
+        return nil
+    }
+    if math.Abs(t.Drift) >= 1 {
+        last := t.Stops[len(t.Stops)-1]
+        return invalidf("Trip %d at %s: driving times reach the last stop at %s but the scheduled arrival is %s", t.Offering.TripNumber, t.Offering.ScheduledStartTime, last.ScheduledArrivalTime, t.Offering.ScheduledArrivalTime)
+    }
+    return nil
+}
+
+func (t Timetable) String() string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "Trip %d: %s -> %s on %s\n", t.Trip.TripNumber, t.Trip.StartLocationName, t.Trip.DestinationName, t.Offering.Date)
+    fmt.Fprintf(&b, "%-5s %-6s %-30s %s\n", "Seq", "Stop", "Address", "Arrives")
+    fmt.Fprintf(&b, "%-5s %-6s %-30s %s\n", "", "", t.Trip.StartLocationName, t.Offering.ScheduledStartTime)
+    for _, s := range t.Stops {
+        fmt.Fprintf(&b, "%-5d %-6d %-30s %s\n", s.SequenceNumber, s.StopNumber, s.StopAddress, s.ScheduledArrivalTime)
+    }
+    fmt.Fprintf(&b, "Scheduled arrival at %s: %s", t.Trip.DestinationName, t.Offering.ScheduledArrivalTime)
+    if err := t.Validate(); err != nil {
+        fmt.Fprintf(&b, "\nWarning: %v", err)
+    }
+    return b.String()
+}
+
+// GetTimetable computes the arrival time at every stop of the offering
+func (db *Database) GetTimetable(o TripOffering) (Timetable, error) {
+    t := Timetable{Offering: o, Stops: []TimetableStop{}}
+    start, end, err := offeringWindow(o)
+    if err != nil {
+        return t, err
+    }
+    row, err := db.query(selectTripByNumber, o.TripNumber)
+    if err != nil {
+        return t, err
+    }
+    trips := RowToTrips(row)
+    row.Close()
+    if len(trips) == 0 {
+        return t, fmt.Errorf("No trip %d: %w", o.TripNumber, ErrNotFound)
+    }
+    t.Trip = trips[0]
+    row, err = db.query(selectTimetableStops, o.TripNumber)
+    if err != nil {
+        return t, err
+    }
+    defer row.Close()
+    elapsed := float64(start)
+    for row.Next() {
+        var s TimetableStop
+        var address sql.NullString
+        row.Scan(&s.SequenceNumber, &s.StopNumber, &address, &s.DrivingTime)
+        s.StopAddress = address.String
+        elapsed += float64(s.DrivingTime)
+        // Hours past 23 are kept so service running after midnight stays in order
+        s.ScheduledArrivalTime = NewTimeOfDay(0, int(math.Round(elapsed)), 0)
+        t.Stops = append(t.Stops, s)
+    }
+    if len(t.Stops) > 0 {
+        t.Drift = float64(end) - elapsed
+    }
+    return t, nil
+}
+
+// GetTimetables returns the timetable of every offering on date, optionally
+// only for the given trip number (0 for all trips)
+func (db *Database) GetTimetables(date ServiceDate, tripNumber int) ([]Timetable, error) {
+    result := []Timetable{}
+    row, err := db.query(selectOfferingsByDate+` ORDER BY TripNumber, ScheduledStartTime`, date)
+    if err != nil {
+        return result, err
+    }
+    offerings := RowToTripOfferings(row)
+    row.Close()
+    for _, o := range offerings {
+        if tripNumber != 0 && o.TripNumber != tripNumber {
+            continue
+        }
+        t, err := db.GetTimetable(o)
+        if err != nil {
+            return result, err
+        }
+        result = append(result, t)
+    }
+    return result, nil
+}
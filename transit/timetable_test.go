@@ -0,0 +1,90 @@
+package transit_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+func TestTimetableFromDrivingTimes(t *testing.T) {
+	db := openMemory(t)
+	for _, err := range []error{
+		db.AddTrip(1, "Pomona", "Ontario"),
+		db.AddTrip(2, "Ontario", "Pomona"),
+		db.AddBus(0, "Gillig", 2015),
+		db.AddDriver("Ann", "555-0100"),
+		db.AddStop(10, "1 Main St"),
+		db.AddStop(11, "2 Holt Ave"),
+		db.AddStop(12, "3 Mission Blvd"),
+		// Listed out of order to check the sequence numbers are followed
+		db.AddTripStopInfo(1, 12, 3, 15.5),
+		db.AddTripStopInfo(1, 10, 1, 0),
+		db.AddTripStopInfo(1, 11, 2, 20),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	date := mustParseDate(t, "2026-10-19")
+	tests := []struct {
+		start, arrival string
+		want           string // arrival at each stop
+		drift          float64
+	}{
+		{"08:00", "08:35", "08:00 08:20 08:36", -0.5},
+		{"23:50", "00:30", "23:50 24:10 24:26", 4.5},
+		{"09:00", "10:00", "09:00 09:20 09:36", 24.5},
+	}
+	for _, tt := range tests {
+		if err := db.AddOffering(1, date, mustParseTime(t, tt.start), mustParseTime(t, tt.arrival), "Ann", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.AddOffering(2, date, mustParseTime(t, "12:00"), mustParseTime(t, "13:00"), "Ann", 0); err != nil {
+		t.Fatal(err)
+	}
+	timetables, err := db.GetTimetables(date, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timetables) != len(tests) {
+		t.Fatalf("Got %d timetables for trip 1, want %d", len(timetables), len(tests))
+	}
+	byStart := map[string]transit.Timetable{}
+	for _, tt := range timetables {
+		byStart[tt.Offering.ScheduledStartTime.String()] = tt
+	}
+	for _, tt := range tests {
+		timetable := byStart[tt.start]
+		arrivals := []string{}
+		for _, s := range timetable.Stops {
+			arrivals = append(arrivals, s.ScheduledArrivalTime.String())
+		}
+		if got := strings.Join(arrivals, " "); got != tt.want {
+			t.Errorf("Offering at %s reaches its stops at %q, want %q", tt.start, got, tt.want)
+		}
+		if timetable.Drift != tt.drift {
+			t.Errorf("Offering at %s drifts %v minutes, want %v", tt.start, timetable.Drift, tt.drift)
+		}
+		// Less than a minute of drift is rounding, not a bad schedule
+		if err := timetable.Validate(); (err == nil) != (tt.drift > -1 && tt.drift < 1) {
+			t.Errorf("Offering at %s with drift %v: Validate returned %v", tt.start, tt.drift, err)
+		}
+	}
+	if s := byStart["08:00"].Stops; len(s) != 3 || s[1].StopAddress != "2 Holt Ave" {
+		t.Errorf("Stops %v, want the addresses in sequence", s)
+	}
+	all, err := db.GetTimetables(date, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 || len(all[3].Stops) != 0 || all[3].Validate() != nil {
+		t.Errorf("Timetables for every trip %v, want trip 2 last with no stops and nothing to check", all)
+	}
+	_, err = db.GetTimetable(transit.TripOffering{TripNumber: 9, Date: date, ScheduledStartTime: mustParseTime(t, "08:00"), ScheduledArrivalTime: mustParseTime(t, "09:00")})
+	if !errors.Is(err, transit.ErrNotFound) {
+		t.Errorf("Timetable of a missing trip returned %v, want a not found error", err)
+	}
+}
@@ -0,0 +1,110 @@
+// Transactions spanning several changes to the transit database
+package transit
+
+import (
+    "database/sql"
+    "errors"
+)
+
+// savepoint names the savepoint of a WithTx nested in another transaction.
+// Savepoints of the same name nest, so one name serves every level.
+const savepoint = `with_tx`
+
+// ErrNoTx is returned when committing or rolling back a handle that is not
+// in a transaction
+var ErrNoTx = errors.New("No transaction is open")
+
+// StartTx returns a handle on the same database whose reads and writes all
+// run in a new transaction, until Commit or Rollback is called on it. The
+// handle keeps the conflict policy of db.
+func (db *Database) StartTx() (*Database, error) {
+    if db.tx != nil {
+        return nil, invalidf("A transaction is already open")
+    }
+    tx, err := db.DB.Begin()
+    if err != nil {
+        return nil, err
+    }
+    t := *db
+    t.tx = tx
+    return &t, nil
+}
+
+// InTx reports whether the handle's statements run in a transaction
+func (db *Database) InTx() bool {
+    return db.tx != nil
+}
+
+// Commit makes the changes of a handle from StartTx permanent
+func (db *Database) Commit() error {
+    if db.tx == nil {
+        return ErrNoTx
+    }
+    return db.tx.Commit()
+}
+
+// Rollback discards the changes of a handle from StartTx
+func (db *Database) Rollback() error {
+    if db.tx == nil {
+        return ErrNoTx
+    }
+    return db.tx.Rollback()
+}
+
+// WithTx runs f with a handle whose statements all run in one transaction,
+// which is committed if f returns nil and rolled back otherwise. Called on
+// a handle that is already in a transaction, f runs within a savepoint of
+// it, so a failure undoes only what f did and the outer transaction goes on.
+func (db *Database) WithTx(f func(tx *Database) error) error {
+    if db.tx != nil {
+        return db.withSavepoint(f)
+    }
+    tx, err := db.StartTx()
+    if err != nil {
+        return err
+    }
+    // Roll back if f panics, so the connection is not left in the transaction
+    committed := false
+    defer func() {
+        if !committed {
+            tx.Rollback()
+        }
+    }()
+    if err := f(tx); err != nil {
+        return err
+    }
+    committed = true
+    return tx.Commit()
+}
+
+// withSavepoint runs f within a savepoint of the handle's transaction
+func (db *Database) withSavepoint(f func(tx *Database) error) error {
+    if _, err := db.tx.Exec(`SAVEPOINT ` + savepoint); err != nil {
+        return err
+    }
+    released := false
+    defer func() {
+        if !released {
+            db.tx.Exec(`ROLLBACK TO ` + savepoint)
+            db.tx.Exec(`RELEASE ` + savepoint)
+        }
+    }()
+    if err := f(db); err != nil {
+        return err
+    }
+    released = true
+    _, err := db.tx.Exec(`RELEASE ` + savepoint)
+    return err
+}
+
+// sqlConn returns what the handle runs ad hoc SQL on, its transaction if it
+// has one and otherwise the database
+func (db *Database) sqlConn() interface {
+    Exec(query string, args ...interface{}) (sql.Result, error)
+    QueryRow(query string, args ...interface{}) *sql.Row
+} {
+    if db.tx != nil {
+        return db.tx
+    }
+    return db.DB
+}
@@ -0,0 +1,96 @@
+package transit_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+func TestNestedWithTxUndoesOnlyInnerWork(t *testing.T) {
+	db := openMemory(t)
+	failed := errors.New("inner failure")
+	err := db.WithTx(func(tx *transit.Database) error {
+		if err := tx.AddDriver("Ann", "555-0101"); err != nil {
+			return err
+		}
+		err := tx.WithTx(func(inner *transit.Database) error {
+			if err := inner.AddDriver("Bob", "555-0102"); err != nil {
+				return err
+			}
+			return failed
+		})
+		if err != failed {
+			t.Errorf("Inner WithTx returned %v, want its own error", err)
+		}
+		// The outer transaction carries on after the inner one fails
+		if err := tx.WithTx(func(inner *transit.Database) error {
+			return inner.AddDriver("Cat", "555-0103")
+		}); err != nil {
+			return err
+		}
+		return tx.AddBus(7, "Gillig", 2015)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	drivers, err := db.GetDriverTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, d := range drivers {
+		names[d.DriverName] = true
+	}
+	if !names["Ann"] || names["Bob"] || !names["Cat"] {
+		t.Errorf("Drivers after the outer commit %v, want Ann and Cat but not Bob", drivers)
+	}
+	buses, err := db.GetBusTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buses) != 1 {
+		t.Errorf("Buses after the outer commit %v, want the one added", buses)
+	}
+}
+
+func TestOuterFailureUndoesCommittedSavepoint(t *testing.T) {
+	db := openMemory(t)
+	failed := errors.New("outer failure")
+	err := db.WithTx(func(tx *transit.Database) error {
+		if err := tx.WithTx(func(inner *transit.Database) error {
+			return inner.AddDriver("Ann", "555-0101")
+		}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("WithTx returned %v, want the outer error", err)
+	}
+	drivers, err := db.GetDriverTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drivers) != 0 {
+		t.Errorf("Drivers after the outer rollback %v, want none", drivers)
+	}
+}
+
+func TestStartTxRefusesOpenTransaction(t *testing.T) {
+	db := openMemory(t)
+	tx, err := db.StartTx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if !tx.InTx() || db.InTx() {
+		t.Errorf("InTx of the handle %v and of the database %v, want true and false", tx.InTx(), db.InTx())
+	}
+	if again, err := tx.StartTx(); !errors.Is(err, transit.ErrInvalid) {
+		t.Errorf("StartTx on a handle in a transaction = %v, %v, want an invalid input error", again, err)
+	}
+	if err := db.Commit(); err != transit.ErrNoTx {
+		t.Errorf("Commit outside a transaction returned %v, want ErrNoTx", err)
+	}
+}
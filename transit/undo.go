@@ -0,0 +1,349 @@
+// Undo and redo of edits, replaying the audit log
+package transit
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "reflect"
+    "time"
+)
+
+const (
+    selectLastAuditID = `SELECT IFNULL(MAX(AuditID), 0) FROM AuditLog`
+    selectAuditRange  = selectAuditRecords + ` WHERE AuditID BETWEEN ? AND ? ORDER BY AuditID`
+    selectLatestAudit = selectAuditRecords + ` WHERE Entity = ? AND EntityKey = ? ORDER BY AuditID DESC LIMIT 1`
+
+    selectEdits        = `SELECT EditID, Session, Command, FirstAuditID, LastAuditID, Undone, MadeAt FROM EditLog`
+    selectSessionEdits = selectEdits + ` WHERE Session = ? ORDER BY EditID`
+    selectUndoable     = selectEdits + ` WHERE Session = ? AND Undone = 0 ORDER BY EditID DESC LIMIT ?`
+    selectRedoable     = selectEdits + ` WHERE Session = ? AND Undone = 1 ORDER BY EditID LIMIT ?`
+    insertEdit         = `INSERT INTO EditLog (Session, Command, FirstAuditID, LastAuditID, MadeAt) VALUES (?, ?, ?, ?, ?)`
+    updateEditUndone   = `UPDATE EditLog SET Undone = ? WHERE EditID = ?`
+    deleteRedoable     = `DELETE FROM EditLog WHERE Session = ? AND Undone = 1`
+
+    selectTripReferences   = `SELECT (SELECT COUNT(*) FROM TripOffering WHERE TripNumber = ?), (SELECT COUNT(*) FROM TripStopInfo WHERE TripNumber = ?), (SELECT COUNT(*) FROM ServicePattern WHERE TripNumber = ?), (SELECT COUNT(*) FROM ServiceException WHERE TripNumber = ?)`
+    selectObservationCount = `SELECT COUNT(*) FROM ActualTripStopInfo WHERE TripNumber = ? AND Date = ? AND ScheduledStartTime = ?`
+)
+
+// Edit is one command of a session that changed the database. Its changes
+// are the audit records from FirstAuditID to LastAuditID.
+type Edit struct {
+    EditID       int
+    Session      string
+    Command      string
+    FirstAuditID int
+    LastAuditID  int
+    Undone       bool
+    MadeAt       string // RFC 3339
+}
+
+func (e Edit) String() string {
+    return fmt.Sprintf("EditID: %d\nSession: %s\nCommand: %s\nFirstAuditID: %d\nLastAuditID: %d\nUndone: %t\nMadeAt: %s", e.EditID, e.Session, e.Command, e.FirstAuditID, e.LastAuditID, e.Undone, e.MadeAt)
+}
+
+// RecordEdit runs f in a transaction as one edit of session, described by
+// command, so that Undo can revert it later. f must make its changes
+// through the handle it is given. An edit that changes nothing is not
+// recorded; one that does discards the edits the session could redo.
+func (db *Database) RecordEdit(session string, command string, f func(tx *Database) error) error {
+    return db.WithTx(func(tx *Database) error {
+        first, err := tx.lastAuditID()
+        if err != nil {
+            return err
+        }
+        if err := f(tx); err != nil {
+            return err
+        }
+        last, err := tx.lastAuditID()
+        if err != nil {
+            return err
+        }
+        if last == first {
+            return nil
+        }
+        if _, err := tx.exec(deleteRedoable, session); err != nil {
+            return err
+        }
+        _, err = tx.exec(insertEdit, session, command, first+1, last, time.Now().Format(time.RFC3339))
+        return err
+    })
+}
+
+// Edits returns the edits of session that can be undone or redone, oldest
+// first
+func (db *Database) Edits(session string) ([]Edit, error) {
+    result := []Edit{}
+    row, err := db.query(selectSessionEdits, session)
+    if err != nil {
+        return result, err
+    }
+    defer row.Close()
+    result = RowToEdits(row)
+    return result, nil
+}
+
+// Undo reverts the last n edits of session, newest first, and returns the
+// edits it reverted. Nothing is reverted if a row an edit changed has been
+// changed since by anything but a later edit that is already undone.
+func (db *Database) Undo(session string, n int) ([]Edit, error) {
+    return db.replay(session, n, true)
+}
+
+// Redo makes the last n edits of session that Undo reverted again, oldest
+// first, and returns them
+func (db *Database) Redo(session string, n int) ([]Edit, error) {
+    return db.replay(session, n, false)
+}
+
+// replay reverts or remakes up to n edits of session in one transaction
+func (db *Database) replay(session string, n int, undo bool) ([]Edit, error) {
+    if n < 1 {
+        return []Edit{}, invalidf("Cannot undo or redo %d edits", n)
+    }
+    query, verb := selectRedoable, "redo"
+    if undo {
+        query, verb = selectUndoable, "undo"
+    }
+    edits := []Edit{}
+    err := db.WithTx(func(tx *Database) error {
+        row, err := tx.query(query, session, n)
+        if err != nil {
+            return err
+        }
+        edits = RowToEdits(row)
+        row.Close()
+        for _, e := range edits {
+            row, err := tx.query(selectAuditRange, e.FirstAuditID, e.LastAuditID)
+            if err != nil {
+                return err
+            }
+            records := RowToAuditRecords(row)
+            row.Close()
+            for i := range records {
+                a := records[i]
+                if undo {
+                    a = records[len(records)-1-i]
+                }
+                if err := tx.replayRecord(a, undo); err != nil {
+                    return fmt.Errorf("Cannot %s %q: %w", verb, e.Command, err)
+                }
+            }
+            if _, err := tx.exec(updateEditUndone, undo, e.EditID); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return []Edit{}, err
+    }
+    return edits, nil
+}
+
+// replayRecord reverts the change of an audit record, or makes it again,
+// provided the row is still as the change left it, or as it found it
+func (db *Database) replayRecord(a AuditRecord, undo bool) error {
+    from, to := a.Before, a.After
+    if undo {
+        from, to = a.After, a.Before
+    }
+    row, err := db.query(selectLatestAudit, a.Entity, a.Key)
+    if err != nil {
+        return err
+    }
+    latest := RowToAuditRecords(row)
+    row.Close()
+    if len(latest) == 0 || latest[0].After != from {
+        return invalidf("%s %s has been changed since", a.Entity, a.Key)
+    }
+    var fromRow, toRow interface{}
+    if from != "" {
+        if fromRow, err = auditRow(a.Entity, from); err != nil {
+            return err
+        }
+    }
+    if to != "" {
+        if toRow, err = auditRow(a.Entity, to); err != nil {
+            return err
+        }
+    }
+    // A restored offering must not double-book its driver or bus, or use
+    // one that has retired since
+    if o, ok := toRow.(TripOffering); ok {
+        if err := db.checkConflicts(o); err != nil {
+            return err
+        }
+        if err := db.checkRetired(o); err != nil {
+            return err
+        }
+    }
+    switch {
+    case fromRow == nil:
+        return db.insertRow(toRow)
+    case toRow == nil:
+        return db.deleteRow(fromRow)
+    }
+    return db.updateRow(fromRow, toRow)
+}
+
+// deleteRow deletes a single row of any table and logs it. Callers should
+// hold a transaction.
+func (db *Database) deleteRow(row interface{}) error {
+    var query string
+    var args []interface{}
+    switch r := row.(type) {
+    case Bus:
+        query, args = deleteBus, []interface{}{r.BusID}
+    case Driver:
+        query, args = deleteDriver, []interface{}{r.DriverName}
+    case Stop:
+        query, args = deleteStop, []interface{}{r.StopNumber}
+    case Trip:
+        // The foreign keys would delete the rows that refer to the trip
+        // without logging them
+        if err := db.checkTripUnused(r.TripNumber); err != nil {
+            return err
+        }
+        query, args = deleteTrip, []interface{}{r.TripNumber}
+    case TripStopInfo:
+        query, args = deleteTripStopInfo, []interface{}{r.TripNumber, r.StopNumber}
+    case TripOffering:
+        // The foreign keys would delete its observations without logging
+        // them
+        if err := db.checkOfferingUnused(r); err != nil {
+            return err
+        }
+        query, args = deleteTripOffering, []interface{}{r.TripNumber, r.Date, r.ScheduledStartTime}
+    case ActualTripStopInfo:
+        query, args = deleteActualTripStopInfo, []interface{}{r.TripNumber, r.Date, r.ScheduledStartTime, r.StopNumber}
+    case ServicePattern:
+        query, args = deleteServicePattern, []interface{}{r.PatternName}
+    case Holiday:
+        query, args = deleteHoliday, []interface{}{r.Date}
+    case ServiceException:
+        query, args = deleteServiceException, []interface{}{tripOrAll(r.TripNumber), r.Date}
+    default:
+        return fmt.Errorf("Cannot delete %T", row)
+    }
+    res, err := db.exec(query, args...)
+    if err != nil {
+        return err
+    }
+    if err := expectRows(res, fmt.Sprintf("No %T to delete", row)); err != nil {
+        return err
+    }
+    return db.record(row, nil)
+}
+
+// checkTripUnused refuses, with a constraint error, if any offering, stop,
+// service pattern or service exception refers to the trip
+func (db *Database) checkTripUnused(tripNumber int) error {
+    var offerings, stops, patterns, exceptions int
+    err := db.sqlConn().QueryRow(selectTripReferences, tripNumber, tripNumber, tripNumber, tripNumber).Scan(&offerings, &stops, &patterns, &exceptions)
+    if err != nil {
+        return err
+    }
+    if offerings+stops+patterns+exceptions > 0 {
+        return constraintError{fmt.Sprintf("Trip %d still has %d offerings, %d stops, %d service patterns and %d service exceptions", tripNumber, offerings, stops, patterns, exceptions)}
+    }
+    return nil
+}
+
+// checkOfferingUnused refuses, with a constraint error, if any observation
+// was recorded for the offering
+func (db *Database) checkOfferingUnused(o TripOffering) error {
+    var observations int
+    err := db.sqlConn().QueryRow(selectObservationCount, o.TripNumber, o.Date, o.ScheduledStartTime).Scan(&observations)
+    if err != nil {
+        return err
+    }
+    if observations > 0 {
+        return constraintError{fmt.Sprintf("Trip %d on %s at %s still has %d observations", o.TripNumber, o.Date, o.ScheduledStartTime, observations)}
+    }
+    return nil
+}
+
+// updateRow changes a row from before to after, keeping its key, and logs
+// it. Of a bus only the retirement date is ever updated.
+func (db *Database) updateRow(before interface{}, after interface{}) error {
+    var query string
+    var args []interface{}
+    switch r := after.(type) {
+    case TripOffering:
+        query, args = updateOffering, []interface{}{r.ScheduledArrivalTime, nullIfEmpty(r.DriverName), r.BusID, r.TripNumber, r.Date, r.ScheduledStartTime}
+    case Bus:
+        query, args = updateBusRetiredOn, []interface{}{r.RetiredOn, r.BusID}
+    case Driver:
+        query, args = updateDriver, []interface{}{r.DriverTelephoneNumber, r.RetiredOn, r.DriverName}
+    case Trip:
+        query, args = updateTrip, []interface{}{r.StartLocationName, r.DestinationName, r.TripNumber}
+    case Stop:
+        query, args = updateStop, []interface{}{r.StopAddress, r.StopNumber}
+    case TripStopInfo:
+        query, args = updateTripStopInfo, []interface{}{r.SequenceNumber, r.DrivingTime, r.TripNumber, r.StopNumber}
+    case ActualTripStopInfo:
+        query, args = updateActualTripStopInfo, []interface{}{r.ScheduledArrivalTime, r.ActualStartTime, r.ActualArrivalTime, r.NumberOfPassengerIn, r.NumberOfPassengerOut, r.TripNumber, r.Date, r.ScheduledStartTime, r.StopNumber}
+    default:
+        return fmt.Errorf("Cannot update %T", after)
+    }
+    res, err := db.exec(query, args...)
+    if err != nil {
+        return err
+    }
+    if err := expectRows(res, fmt.Sprintf("No %T to update", after)); err != nil {
+        return err
+    }
+    return db.record(before, after)
+}
+
+// auditRow decodes a row of entity from the JSON of an audit record
+func auditRow(entity string, data string) (interface{}, error) {
+    var row interface{}
+    switch entity {
+    case "Bus":
+        row = &Bus{}
+    case "Driver":
+        row = &Driver{}
+    case "Stop":
+        row = &Stop{}
+    case "Trip":
+        row = &Trip{}
+    case "TripStopInfo":
+        row = &TripStopInfo{}
+    case "TripOffering":
+        row = &TripOffering{}
+    case "ActualTripStopInfo":
+        row = &ActualTripStopInfo{}
+    case "ServicePattern":
+        row = &ServicePattern{}
+    case "Holiday":
+        row = &Holiday{}
+    case "ServiceException":
+        row = &ServiceException{}
+    default:
+        return nil, fmt.Errorf("Cannot restore %s", entity)
+    }
+    if err := json.Unmarshal([]byte(data), row); err != nil {
+        return nil, err
+    }
+    return reflect.ValueOf(row).Elem().Interface(), nil
+}
+
+// lastAuditID returns the ID of the newest audit record, or 0 if there is none
+func (db *Database) lastAuditID() (int, error) {
+    var id int
+    err := db.sqlConn().QueryRow(selectLastAuditID).Scan(&id)
+    return id, err
+}
+
+// RowToEdits converts a sql row to a slice of edits
+func RowToEdits(row *sql.Rows) []Edit {
+    result := []Edit{}
+    for row.Next() {
+        var e Edit
+        row.Scan(&e.EditID, &e.Session, &e.Command, &e.FirstAuditID, &e.LastAuditID, &e.Undone, &e.MadeAt)
+        result = append(result, e)
+    }
+    return result
+}
@@ -0,0 +1,167 @@
+package transit_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hlin91/CS4350_Lab4/transit"
+)
+
+func TestUndoKeepsOtherOperatorsOfferings(t *testing.T) {
+	db := openMemory(t)
+	alice, bob := db.WithOperator("alice"), db.WithOperator("bob")
+	err := alice.RecordEdit("alice", "add trip 2 B C", func(tx *transit.Database) error {
+		return tx.AddTrip(2, "B", "C")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	date, start := mustParseDate(t, "2026-10-19"), mustParseTime(t, "10:00")
+	err = bob.RecordEdit("bob", "add offering 2 2026-10-19 10:00 11:00 Nick 5", func(tx *transit.Database) error {
+		if err := tx.AddDriver("Nick", "555-0100"); err != nil {
+			return err
+		}
+		if err := tx.AddBus(5, "Gillig", 2015); err != nil {
+			return err
+		}
+		return tx.AddOffering(2, date, start, mustParseTime(t, "11:00"), "Nick", 5)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := alice.Undo("alice", 1); !transit.IsConstraint(err) {
+		t.Fatalf("Undo of a trip with an offering: got %v, want a constraint error", err)
+	}
+	offerings, err := db.GetTripOfferingTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offerings) != 1 {
+		t.Fatalf("Got %d offerings after the refused undo, want 1", len(offerings))
+	}
+	history, err := db.OfferingHistory(2, date, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Action != transit.AuditInsert {
+		t.Errorf("Offering history %v, want just its insert", history)
+	}
+	edits, err := db.Edits("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edits) != 1 || edits[0].Undone {
+		t.Errorf("Alice's edits %v, want the add trip still done", edits)
+	}
+
+	// Once bob's offering is undone the trip is unused and can go
+	if _, err := bob.Undo("bob", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.Undo("alice", 1); err != nil {
+		t.Fatalf("Undo of an unused trip: %v", err)
+	}
+	trips, err := db.GetTripTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trips) != 0 {
+		t.Errorf("Got trips %v after undoing the add, want none", trips)
+	}
+}
+
+func TestUndoRefusesObservedOffering(t *testing.T) {
+	db := openMemory(t)
+	date, start := mustParseDate(t, "2026-10-19"), mustParseTime(t, "10:00")
+	err := db.RecordEdit("bob", "add offering 2 2026-10-19 10:00 11:00 Nick 5", func(tx *transit.Database) error {
+		for _, err := range []error{
+			tx.AddTrip(2, "B", "C"),
+			tx.AddDriver("Nick", "555-0100"),
+			tx.AddBus(5, "Gillig", 2015),
+		} {
+			if err != nil {
+				return err
+			}
+		}
+		return tx.AddOffering(2, date, start, mustParseTime(t, "11:00"), "Nick", 5)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{
+		db.AddStop(1, "1 Main St"),
+		db.AddActualTripStopInfo(2, date, start, 1, start, start, start, 3, 0),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := db.Undo("bob", 1); !transit.IsConstraint(err) {
+		t.Fatalf("Undo of an offering with an observation: got %v, want a constraint error", err)
+	}
+	offerings, err := db.GetTripOfferingTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	observations, err := db.GetActualTripStopInfoTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offerings) != 1 || len(observations) != 1 {
+		t.Errorf("Got %d offerings and %d observations after the refused undo, want 1 of each", len(offerings), len(observations))
+	}
+}
+
+func TestUndoKeepsBusZero(t *testing.T) {
+	db := openMemory(t)
+	date, start := mustParseDate(t, "2026-10-19"), mustParseTime(t, "10:00")
+	for _, err := range []error{
+		db.AddTrip(2, "B", "C"),
+		db.AddDriver("Nick", "555-0100"),
+		db.AddBus(0, "Gillig", 2015),
+		db.AddBus(1, "New Flyer", 2020),
+		db.AddOffering(2, date, start, mustParseTime(t, "11:00"), "Nick", 0),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := db.RecordEdit("bob", "change bus 1 2 2026-10-19 10:00", func(tx *transit.Database) error {
+		return tx.ChangeBus(1, 2, date, start)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Undo("bob", 1); err != nil {
+		t.Fatal(err)
+	}
+	offerings, err := db.GetTripOfferingTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offerings) != 1 || !offerings[0].HasBus(0) {
+		t.Fatalf("Offerings %v after undoing the change, want the offering back on bus 0", offerings)
+	}
+
+	// Bus 0 retiring makes it unavailable to the offering restored by redo
+	if err := db.ChangeBus(1, 2, date, start); err != nil {
+		t.Fatal(err)
+	}
+	err = db.RecordEdit("bob", "change bus 0 2 2026-10-19 10:00", func(tx *transit.Database) error {
+		return tx.ChangeBus(0, 2, date, start)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Undo("bob", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RetireBus(0, date); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Redo("bob", 1); !errors.Is(err, transit.ErrInvalid) {
+		t.Errorf("Redo onto retired bus 0: got %v, want an invalid input error", err)
+	}
+}